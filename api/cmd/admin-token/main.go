@@ -0,0 +1,69 @@
+// Command admin-token creates a bearer token for the admin endpoints.
+//
+//	go run ./cmd/admin-token -name cron -scopes prices:update -expires 8760h
+//
+// The token is printed once. Only its hash is stored in the database.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samlof/ehin/internal/auth"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+)
+
+func main() {
+	name := flag.String("name", "", "Name of the token, shown in logs")
+	scopes := flag.String("scopes", strings.Join(model.AdminScopes, ","), "Comma-separated scopes to grant")
+	expires := flag.Duration("expires", 0, "How long the token is valid, 0 for no expiry")
+	flag.Parse()
+
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "-name is required")
+		os.Exit(2)
+	}
+	token := model.AdminToken{Name: *name}
+	for scope := range strings.SplitSeq(*scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(model.AdminScopes, scope) {
+			fmt.Fprintf(os.Stderr, "Unknown scope %q. Valid scopes: %s\n", scope, strings.Join(model.AdminScopes, ", "))
+			os.Exit(2)
+		}
+		token.Scopes = append(token.Scopes, scope)
+	}
+	if *expires > 0 {
+		t := time.Now().Add(*expires)
+		token.Expires = &t
+	}
+
+	cfg := config.LoadConfig()
+	if cfg.DatabaseURL == "" {
+		fmt.Fprintln(os.Stderr, "DATABASE_URL is not set")
+		os.Exit(1)
+	}
+	dbPool, err := pgxpool.New(context.Background(), cfg.DatabaseURL)
+	if err != nil {
+		slog.Error("Unable to connect to database", "error", err)
+		os.Exit(1)
+	}
+	defer dbPool.Close()
+
+	secret := auth.NewToken()
+	token.TokenHash = auth.HashToken(secret)
+	if err := repository.NewAdminTokenRepository(dbPool).CreateToken(context.Background(), &token); err != nil {
+		slog.Error("Unable to create token", "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(secret)
+}
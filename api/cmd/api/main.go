@@ -2,38 +2,102 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
 	_ "time/tzdata"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/samlof/ehin/internal/api/middleware"
 	"github.com/samlof/ehin/internal/api/resource"
+	"github.com/samlof/ehin/internal/api/router"
 	"github.com/samlof/ehin/internal/config"
 	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/events"
+	"github.com/samlof/ehin/internal/gql"
+	"github.com/samlof/ehin/internal/metrics"
+	"github.com/samlof/ehin/internal/migrations"
+	"github.com/samlof/ehin/internal/mqtt"
 	"github.com/samlof/ehin/internal/nordpool"
 	"github.com/samlof/ehin/internal/service"
+	"github.com/samlof/ehin/internal/tracing"
+	"github.com/samlof/ehin/internal/webhook"
 )
 
+// version can be set at build time with -ldflags "-X main.version=...".
+var version string
+
+// buildVersion returns the version reported by /status.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	// App Engine builds from uploaded sources without VCS information
+	if v := os.Getenv("GAE_VERSION"); v != "" {
+		return v
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	return "dev"
+}
+
+// Bounds reading request headers, so slow clients can't hold connections open.
+const readHeaderTimeout = 5 * time.Second
+
 func main() {
+	if err := run(); err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run serves requests until SIGTERM or interrupt and then shuts down gracefully.
+// Deferred cleanup runs in reverse order, so the database pool is closed last.
+func run() error {
 	cfg := config.LoadConfig()
 
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+
+	// Before anything creates instrumented clients
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingExporter)
+	if err != nil {
+		return fmt.Errorf("unable to set up tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Error flushing traces", "error", err)
+		}
+	}()
+
 	var dbPool *pgxpool.Pool
 	if cfg.DatabaseURL != "" {
-		var err error
 		dbPool, err = pgxpool.New(context.Background(), cfg.DatabaseURL)
 		if err != nil {
-			slog.Error("Unable to connect to database", "error", err)
-			os.Exit(1)
+			return fmt.Errorf("unable to connect to database: %w", err)
 		}
-		defer dbPool.Close()
+		defer func() {
+			dbPool.Close()
+			slog.Info("Closed database pool")
+		}()
 
 		// Test connection
 		if err := dbPool.Ping(context.Background()); err != nil {
-			slog.Error("Unable to ping database", "error", err)
-			os.Exit(1)
+			return fmt.Errorf("unable to ping database: %w", err)
 		}
 		slog.Info("Connected to database")
 	} else {
@@ -42,35 +106,178 @@ func main() {
 
 	// Repository and Service initialization
 	var priceRepo repository.PriceRepository
+	var webhookRepo repository.WebhookRepository
+	var adminTokenRepo repository.AdminTokenRepository
+	var apiKeyRepo repository.APIKeyRepository
+	var migrationRepo repository.MigrationRepository
 	if dbPool != nil {
 		priceRepo = repository.NewPriceRepository(dbPool)
+		webhookRepo = repository.NewWebhookRepository(dbPool)
+		adminTokenRepo = repository.NewAdminTokenRepository(dbPool)
+		apiKeyRepo = repository.NewAPIKeyRepository(dbPool)
+		migrationRepo = repository.NewMigrationRepository(dbPool)
 	}
 	
-	nordPoolClient := nordpool.NewClient(cfg.NordPoolBaseURL)
 	dateService := service.NewDateService()
+	appMetrics := metrics.New(dateService)
+	if dbPool != nil {
+		appMetrics.RegisterDBPool(dbPool)
+	}
+	if priceRepo != nil {
+		appMetrics.RegisterPrices(priceRepo)
+	}
+
+	nordPoolClient := appMetrics.InstrumentNordPool(nordpool.NewClient(cfg.NordPoolBaseURL))
 	pricesService := service.NewPricesService(nordPoolClient, dateService)
 
 	// Resource initialization
 	greetingResource := resource.NewGreetingResource()
-	priceResource := resource.NewPriceResource(priceRepo, pricesService, dateService, cfg.UpdatePricesPassword)
+	healthResource := resource.NewHealthResource(priceRepo, migrationRepo, dateService, migrations.Version(), buildVersion())
+	priceResource := resource.NewPriceResource(priceRepo, pricesService, dateService)
+	calendarResource := resource.NewCalendarResource(priceRepo, dateService)
+	homeAssistantResource := resource.NewHomeAssistantResource(priceRepo, dateService)
+	var consumptionService *service.ConsumptionService
+	var comparisonService *service.ComparisonService
+	if priceRepo != nil {
+		consumptionService = service.NewConsumptionService(priceRepo)
+		comparisonService = service.NewComparisonService(priceRepo)
+	}
+	consumptionResource := resource.NewConsumptionResource(consumptionService)
+	contractResource := resource.NewContractResource(comparisonService, dateService)
+	scheduleResource := resource.NewScheduleResource(priceRepo, dateService)
+	webhookResource := resource.NewWebhookResource(webhookRepo)
+	apiKeyResource := resource.NewAPIKeyResource(apiKeyRepo)
+	authenticator := middleware.NewAuthenticator(cfg, adminTokenRepo, dateService)
+	rateLimiter := middleware.NewRateLimiter(cfg, apiKeyRepo, dateService)
+	if cfg.AdminPasswordAuth {
+		slog.Warn("ADMIN_PASSWORD_AUTH is deprecated, use admin tokens instead")
+	}
+
+	// Background jobs run until the server has drained, so they see the last requests
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	var jobs sync.WaitGroup
+	startJob := func(job func(context.Context)) {
+		jobs.Go(func() { job(jobsCtx) })
+	}
 
-	mux := http.NewServeMux()
+	startJob(rateLimiter.Run)
 
-	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
-		_, _ = fmt.Fprintf(w, "EHIN API (Go)")
+	if webhookRepo != nil {
+		webhookDispatcher := webhook.NewDispatcher(webhookRepo, dateService)
+		priceResource.AddListener(webhookDispatcher)
+		// Cancelling the jobs stops retrying, so dead letters are stored before the pool closes
+		startJob(webhookDispatcher.Run)
+	}
+
+	var eventsResource *resource.EventsResource
+	var webSocketResource *resource.WebSocketResource
+	var graphQLResource *resource.GraphQLResource
+	if priceRepo != nil {
+		broker := events.NewBroker(priceRepo, dateService, cfg.SSEMaxConnections)
+		priceResource.AddListener(broker)
+		startJob(broker.Run)
+		eventsResource = resource.NewEventsResource(broker)
+		webSocketResource = resource.NewWebSocketResource(broker, priceRepo, cfg.CORSAllowedOrigins)
+
+		executor, err := gql.NewExecutor(cfg, priceRepo, dateService)
+		if err != nil {
+			return fmt.Errorf("unable to set up GraphQL: %w", err)
+		}
+		graphQLResource = resource.NewGraphQLResource(executor)
+	}
+
+	if cfg.MQTTBrokerURL != "" && priceRepo != nil {
+		mqttClient, err := mqtt.Connect(cfg.MQTTBrokerURL)
+		if err != nil {
+			slog.Error("Unable to connect to MQTT broker, not publishing prices", "error", err)
+		} else {
+			defer mqttClient.Disconnect()
+			publisher := mqtt.NewPublisher(mqttClient, cfg.MQTTTopicPrefix, cfg.MQTTQoS, priceRepo, dateService)
+			priceResource.AddListener(publisher)
+			startJob(publisher.Run)
+			slog.Info("Publishing prices to MQTT", "prefix", cfg.MQTTTopicPrefix)
+		}
+	}
+
+	handler := router.New(cfg, router.Handlers{
+		Greeting:      greetingResource,
+		Health:        healthResource,
+		Price:         priceResource,
+		Calendar:      calendarResource,
+		HomeAssistant: homeAssistantResource,
+		Consumption:   consumptionResource,
+		Contract:      contractResource,
+		Schedule:      scheduleResource,
+		Webhook:       webhookResource,
+		APIKey:        apiKeyResource,
+		Events:        eventsResource,
+		WebSocket:     webSocketResource,
+		GraphQL:       graphQLResource,
+		Metrics:       appMetrics,
+		Authenticator: authenticator,
+		RateLimiter:   rateLimiter,
 	})
 
-	mux.HandleFunc("GET /hello", greetingResource.Hello)
-	mux.HandleFunc("GET /api/prices/{date}", priceResource.GetPastPrices)
-	mux.HandleFunc("GET /api/update-prices", priceResource.UpdatePrices)
-	mux.HandleFunc("GET /api/update-prices/{date}", priceResource.UpdatePricesForDate)
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
+	if eventsResource != nil {
+		// Shutdown waits for handlers, so the endless event streams must end
+		server.RegisterOnShutdown(eventsResource.Shutdown)
+		// Hijacked WebSocket connections aren't closed by Shutdown
+		server.RegisterOnShutdown(webSocketResource.Shutdown)
+	}
 
-	handler := middleware.CORS(cfg)(mux)
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", "addr", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
 
-	serverAddr := ":" + cfg.Port
-	slog.Info("Starting server", "addr", serverAddr)
-	if err := http.ListenAndServe(serverAddr, handler); err != nil {
-		slog.Error("Server failed to start", "error", err)
-		os.Exit(1)
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("server failed: %w", err)
+	case <-signalCtx.Done():
+	}
+	// A second signal kills the process right away
+	stopSignals()
+
+	slog.Info("Shutting down", "timeout", cfg.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Stops accepting connections and waits for in-flight requests such as ingestion
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("error shutting down server: %w", err)
+	} else if err != nil {
+		slog.Warn("Requests still running after the shutdown timeout")
+	}
+
+	cancelJobs()
+	if !waitFor(ctx, jobs.Wait) {
+		slog.Warn("Background jobs still running after the shutdown timeout")
+	}
+	slog.Info("Server stopped")
+	return nil
+}
+
+// waitFor calls wait and returns false if ctx is done before it returns.
+func waitFor(ctx context.Context, wait func()) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
\ No newline at end of file
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/samlof/ehin/internal/api/middleware"
+	"github.com/samlof/ehin/internal/api/resource"
+	"github.com/samlof/ehin/internal/api/router"
+	"github.com/samlof/ehin/internal/metrics"
+	"github.com/samlof/ehin/internal/openapi"
+	"github.com/samlof/ehin/internal/service"
+)
+
+// registeredRoutes returns the patterns of every route, including the ones
+// that need a database.
+func registeredRoutes() []string {
+	h := router.Handlers{
+		Events:        &resource.EventsResource{},
+		WebSocket:     &resource.WebSocketResource{},
+		GraphQL:       &resource.GraphQLResource{},
+		Metrics:       metrics.New(service.NewDateService()),
+		Authenticator: &middleware.Authenticator{},
+		RateLimiter:   &middleware.RateLimiter{},
+	}
+	var routes []string
+	for _, route := range router.Routes(h) {
+		routes = append(routes, route.Pattern)
+	}
+	return routes
+}
+
+// specRoutes returns the operations of the OpenAPI document as mux patterns.
+func specRoutes(t *testing.T) []string {
+	t.Helper()
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Spec, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var routes []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+	return routes
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	registered := registeredRoutes()
+	documented := specRoutes(t)
+	if len(registered) == 0 {
+		t.Fatal("No routes registered")
+	}
+
+	for _, route := range registered {
+		if !slices.Contains(documented, route) {
+			t.Errorf("Route %q is missing from internal/openapi/openapi.json", route)
+		}
+	}
+	for _, route := range documented {
+		if !slices.Contains(registered, route) {
+			t.Errorf("Operation %q in internal/openapi/openapi.json is not registered in internal/api/router", route)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/auth"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/service"
+)
+
+// AppEngineCronHeader is set by App Engine on cron requests. App Engine removes
+// it from external requests, so it can only be trusted when running there.
+const AppEngineCronHeader = "X-Appengine-Cron"
+
+// cronScopes are granted to App Engine cron requests.
+var cronScopes = []string{model.ScopePricesUpdate}
+
+// legacyPasswordScope is the only scope granted by the deprecated p
+// parameter, which was only ever used for updating prices.
+const legacyPasswordScope = model.ScopePricesUpdate
+
+// Authenticator guards admin endpoints with bearer tokens.
+type Authenticator struct {
+	tokenRepository repository.AdminTokenRepository
+	timeProvider    service.TimeProvider
+	appEngine       bool
+	// Deprecated p query parameter password, empty when disabled
+	legacyPassword string
+}
+
+func NewAuthenticator(cfg *config.Config, tokenRepository repository.AdminTokenRepository, timeProvider service.TimeProvider) *Authenticator {
+	a := &Authenticator{
+		tokenRepository: tokenRepository,
+		timeProvider:    timeProvider,
+		appEngine:       cfg.AppEngine,
+	}
+	if cfg.AdminPasswordAuth {
+		a.legacyPassword = cfg.UpdatePricesPassword
+	}
+	return a
+}
+
+// Require wraps next so that it is only called for requests granted scope.
+func (a *Authenticator) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			a.serveBearer(w, r, token, scope, next)
+			return
+		}
+
+		if a.appEngine && r.Header.Get(AppEngineCronHeader) == "true" {
+			if !slices.Contains(cronScopes, scope) {
+				forbidden(w, r)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		if a.legacyPassword != "" && r.URL.Query().Has("p") {
+			if !equalSecrets(a.legacyPassword, r.URL.Query().Get("p")) {
+				unauthorized(w, r, `Bearer realm="ehin", error="invalid_token"`)
+				return
+			}
+			if scope != legacyPasswordScope {
+				forbidden(w, r)
+				return
+			}
+			slog.Warn("Admin request authenticated with the deprecated p parameter", "path", r.URL.Path)
+			next(w, r)
+			return
+		}
+
+		unauthorized(w, r, `Bearer realm="ehin"`)
+	}
+}
+
+func (a *Authenticator) serveBearer(w http.ResponseWriter, r *http.Request, token, scope string, next http.HandlerFunc) {
+	if a.tokenRepository == nil {
+		slog.Warn("Admin token repository not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return
+	}
+
+	stored, err := a.tokenRepository.GetTokenByHash(r.Context(), auth.HashToken(token))
+	if err != nil {
+		slog.Error("Error looking up admin token", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+	if stored == nil || stored.Expired(a.timeProvider.Now()) {
+		unauthorized(w, r, `Bearer realm="ehin", error="invalid_token"`)
+		return
+	}
+	if !slices.Contains(stored.Scopes, scope) {
+		slog.Warn("Admin token lacks scope", "token", stored.Name, "scope", scope)
+		forbidden(w, r)
+		return
+	}
+
+	slog.Info("Admin request", "token", stored.Name, "path", r.URL.Path)
+	next(w, r)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// equalSecrets compares in constant time. Hashing first hides the length of a.
+func equalSecrets(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, challenge string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	problem.Write(w, r, http.StatusUnauthorized, "Missing or invalid credentials")
+}
+
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="ehin", error="insufficient_scope"`)
+	problem.Write(w, r, http.StatusForbidden, "Insufficient scope")
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/auth"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+)
+
+type fakeTokenRepository struct {
+	tokens map[string]model.AdminToken
+}
+
+func (f *fakeTokenRepository) CreateToken(ctx context.Context, token *model.AdminToken) error {
+	f.tokens[token.TokenHash] = *token
+	return nil
+}
+
+func (f *fakeTokenRepository) GetTokenByHash(ctx context.Context, hash string) (*model.AdminToken, error) {
+	token, ok := f.tokens[hash]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func TestAuthenticator_Require(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+	valid := now.Add(time.Hour)
+
+	repo := &fakeTokenRepository{tokens: map[string]model.AdminToken{}}
+	for _, token := range []struct {
+		secret  string
+		scopes  []string
+		expires *time.Time
+	}{
+		{"ehin_update", []string{model.ScopePricesUpdate}, &valid},
+		{"ehin_webhooks", []string{model.ScopeWebhooksManage}, nil},
+		{"ehin_expired", []string{model.ScopePricesUpdate}, &expired},
+	} {
+		_ = repo.CreateToken(context.Background(), &model.AdminToken{
+			Name: token.secret, TokenHash: auth.HashToken(token.secret), Scopes: token.scopes, Expires: token.expires,
+		})
+	}
+
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		url       string
+		header    http.Header
+		expected  int
+		challenge string
+	}{
+		{"No credentials", config.Config{}, "/", nil, http.StatusUnauthorized, `Bearer realm="ehin"`},
+		{"Valid token", config.Config{}, "/", http.Header{"Authorization": {"Bearer ehin_update"}}, http.StatusOK, ""},
+		{"Lowercase scheme", config.Config{}, "/", http.Header{"Authorization": {"bearer ehin_update"}}, http.StatusOK, ""},
+		{"Unknown token", config.Config{}, "/", http.Header{"Authorization": {"Bearer ehin_nope"}}, http.StatusUnauthorized, `Bearer realm="ehin", error="invalid_token"`},
+		{"Expired token", config.Config{}, "/", http.Header{"Authorization": {"Bearer ehin_expired"}}, http.StatusUnauthorized, `Bearer realm="ehin", error="invalid_token"`},
+		{"Missing scope", config.Config{}, "/", http.Header{"Authorization": {"Bearer ehin_webhooks"}}, http.StatusForbidden, `Bearer realm="ehin", error="insufficient_scope"`},
+		{"Cron on App Engine", config.Config{AppEngine: true}, "/", http.Header{"X-Appengine-Cron": {"true"}}, http.StatusOK, ""},
+		{"Cron header outside App Engine", config.Config{}, "/", http.Header{"X-Appengine-Cron": {"true"}}, http.StatusUnauthorized, `Bearer realm="ehin"`},
+		{"Legacy password", config.Config{AdminPasswordAuth: true, UpdatePricesPassword: "secret"}, "/?p=secret", nil, http.StatusOK, ""},
+		{"Wrong legacy password", config.Config{AdminPasswordAuth: true, UpdatePricesPassword: "secret"}, "/?p=wrong", nil, http.StatusUnauthorized, `Bearer realm="ehin", error="invalid_token"`},
+		{"Legacy password disabled", config.Config{UpdatePricesPassword: "secret"}, "/?p=secret", nil, http.StatusUnauthorized, `Bearer realm="ehin"`},
+		{"Legacy password not configured", config.Config{AdminPasswordAuth: true}, "/?p=", nil, http.StatusUnauthorized, `Bearer realm="ehin"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAuthenticator(&tt.cfg, repo, testutil.FixedTime{Time: now})
+			handler := a.Require(model.ScopePricesUpdate, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("POST", tt.url, nil)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rr.Code)
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("Expected WWW-Authenticate %q, got %q", tt.challenge, got)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_LegacyPasswordScopes(t *testing.T) {
+	cfg := &config.Config{AdminPasswordAuth: true, UpdatePricesPassword: "secret"}
+	a := NewAuthenticator(cfg, nil, testutil.FixedTime{})
+
+	for _, scope := range []string{model.ScopeWebhooksManage, model.ScopeAPIKeysManage, model.ScopeMetricsRead} {
+		handler := a.Require(scope, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest("GET", "/?p=secret", nil))
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected the legacy password to be forbidden from %s, got %d", scope, rr.Code)
+		}
+	}
+}
+
+func TestAuthenticator_CronScopes(t *testing.T) {
+	a := NewAuthenticator(&config.Config{AppEngine: true}, nil, testutil.FixedTime{})
+	handler := a.Require(model.ScopeWebhooksManage, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(AppEngineCronHeader, "true")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected cron to be forbidden from managing webhooks, got %d", rr.Code)
+	}
+}
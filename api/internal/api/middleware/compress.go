@@ -0,0 +1,401 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/samlof/ehin/internal/config"
+)
+
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+
+	// Historical days never change, so a few hundred entries cover
+	// everything the UI realistically asks for.
+	compressedCacheEntries = 256
+	// Responses bigger than this are compressed but not cached.
+	compressedCacheMaxBody = 512 * 1024
+)
+
+// hopByHopHeaders describe a single connection and are never replayed from the cache.
+var hopByHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// Server preference when the client accepts several encodings with the same weight.
+var supportedEncodings = []string{encodingZstd, encodingGzip}
+
+// encoder is implemented by both *gzip.Writer and *zstd.Encoder.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	encodingGzip: {New: func() any { return gzip.NewWriter(nil) }},
+	encodingZstd: {New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+}
+
+// Compress creates a middleware that compresses responses with zstd or gzip based
+// on the request's Accept-Encoding header. Bodies smaller than cfg.CompressionMinSize
+// are sent uncompressed. Compressed bodies of responses marked immutable are cached,
+// so historical days are only compressed once.
+func Compress(cfg *config.Config) func(http.Handler) http.Handler {
+	cache := newCompressedCache(compressedCacheEntries)
+	minSize := cfg.CompressionMinSize
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			// Protocol upgrades such as WebSockets need the connection to be hijackable
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var key string
+			var outerHeader http.Header
+			if r.Method == http.MethodGet {
+				key = compressedCacheKey(r, encoding)
+				if entry, ok := cache.get(key); ok {
+					entry.writeTo(w, r)
+					return
+				}
+				// Headers set by outer middleware, which sets them again on cache hits
+				outerHeader = w.Header().Clone()
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minSize:        minSize,
+				status:         http.StatusOK,
+				cache:          cache,
+				cacheKey:       key,
+				outerHeader:    outerHeader,
+			}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+			// Not reached when the handler panics, e.g. with http.ErrAbortHandler
+			cw.complete = true
+		})
+	}
+}
+
+// negotiateEncoding picks the best supported encoding from an Accept-Encoding header.
+// It returns an empty string when the response should not be compressed.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for part := range strings.SplitSeq(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		for param := range strings.SplitSeq(params, ";") {
+			k, v, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(k) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				q = 0
+			} else {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else {
+			weights[name] = q
+		}
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, enc := range supportedEncodings {
+		q, ok := weights[enc]
+		if !ok {
+			q = max(wildcard, 0)
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// addVary appends value to the Vary header unless it is already listed.
+// The CORS middleware also writes Vary, so the header must never be overwritten.
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for field := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/json",
+		mediaType == "application/javascript",
+		mediaType == "application/xml",
+		mediaType == "image/svg+xml",
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether the body
+// is big enough to be worth compressing, then either compresses or passes it through.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	enc         encoder
+
+	cache       *compressedCache
+	cacheKey    string
+	cacheBody   *bytes.Buffer
+	outerHeader http.Header
+	// Set when the handler returned normally, truncated bodies are never cached
+	complete bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader || cw.decided {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+
+	// Informational responses and responses without a body are never compressed.
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		_ = cw.passThrough()
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.wroteHeader = true
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends everything written so far to the client. Responses that have not
+// reached the minimum size by the first flush are streamed uncompressed.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if len(cw.buf) >= cw.minSize {
+			_ = cw.decide()
+		} else {
+			_ = cw.passThrough()
+		}
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide starts compressing if the response allows it, otherwise passes it through.
+func (cw *compressWriter) decide() error {
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if h.Get("Content-Encoding") != "" ||
+		strings.Contains(h.Get("Cache-Control"), "no-transform") ||
+		!isCompressible(h.Get("Content-Type")) {
+		return cw.passThrough()
+	}
+
+	cw.decided = true
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	var dst io.Writer = cw.ResponseWriter
+	if cw.cacheKey != "" && cw.status == http.StatusOK && strings.Contains(h.Get("Cache-Control"), "immutable") {
+		cw.cacheBody = &bytes.Buffer{}
+		dst = io.MultiWriter(cw.ResponseWriter, cw.cacheBody)
+	}
+
+	cw.enc = encoderPools[cw.encoding].Get().(encoder)
+	cw.enc.Reset(dst)
+
+	buf := cw.buf
+	cw.buf = nil
+	_, err := cw.enc.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) passThrough() error {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.wroteHeader {
+			_ = cw.passThrough()
+		}
+		return
+	}
+	if cw.enc == nil {
+		return
+	}
+
+	err := cw.enc.Close()
+	cw.enc.Reset(nil)
+	encoderPools[cw.encoding].Put(cw.enc)
+	cw.enc = nil
+
+	if err == nil && cw.complete && cw.cacheBody != nil && cw.cacheBody.Len() <= compressedCacheMaxBody {
+		cw.cache.put(cw.cacheKey, &compressedEntry{
+			header: cw.responseHeader(),
+			body:   cw.cacheBody.Bytes(),
+		})
+	}
+}
+
+// responseHeader returns the headers set by the handler and this middleware,
+// leaving out hop-by-hop headers and the ones outer middleware already set.
+func (cw *compressWriter) responseHeader() http.Header {
+	header := http.Header{}
+	for key, values := range cw.Header() {
+		if key == "Content-Length" || slices.Contains(hopByHopHeaders, key) || slices.Equal(cw.outerHeader[key], values) {
+			continue
+		}
+		header[key] = slices.Clone(values)
+	}
+	return header
+}
+
+type compressedEntry struct {
+	// Includes Content-Encoding and, from the ETag middleware, ETag
+	header http.Header
+	body   []byte
+}
+
+func (e *compressedEntry) writeTo(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	for key, values := range e.header {
+		if key != "Vary" {
+			h[key] = slices.Clone(values)
+			continue
+		}
+		for _, v := range values {
+			for field := range strings.SplitSeq(v, ",") {
+				addVary(h, strings.TrimSpace(field))
+			}
+		}
+	}
+	if etag := e.header.Get("ETag"); etag != "" && ETagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(e.body)
+}
+
+// compressedCache is a small FIFO cache of compressed immutable responses.
+type compressedCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*compressedEntry
+	order      []string
+}
+
+func newCompressedCache(maxEntries int) *compressedCache {
+	return &compressedCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*compressedEntry, maxEntries),
+	}
+}
+
+// compressedCacheKey includes Accept so negotiated representations don't collide.
+func compressedCacheKey(r *http.Request, encoding string) string {
+	return encoding + "\x00" + r.Header.Get("Accept") + "\x00" + r.URL.RequestURI()
+}
+
+func (c *compressedCache) get(key string) (*compressedEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	return e, ok
+}
+
+func (c *compressedCache) put(key string, e *compressedEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		c.entries[key] = e
+		return
+	}
+	if len(c.order) >= c.maxEntries {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = e
+	c.order = append(c.order, key)
+}
@@ -0,0 +1,310 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/samlof/ehin/internal/config"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"zstd;q=0.5, gzip", "gzip"},
+		{"gzip;q=0, zstd;q=0", ""},
+		{"*", "zstd"},
+		{"*;q=0.1, zstd;q=0", "gzip"},
+		{"br, deflate", ""},
+		{"identity", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header); got != tt.expected {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.expected)
+			}
+		})
+	}
+}
+
+func newCompressHandler(minSize int, body string, cacheControl string, calls *int) http.Handler {
+	cfg := &config.Config{CompressionMinSize: minSize}
+	return Compress(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		_, _ = io.WriteString(w, body)
+	}))
+}
+
+func TestCompress_Gzip(t *testing.T) {
+	body := strings.Repeat(`{"p":1.23}`, 200)
+	calls := 0
+	handler := newCompressHandler(100, body, "", &calls)
+
+	req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q", rr.Header().Get("Content-Type"))
+	}
+
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != body {
+		t.Errorf("Decoded body does not match original")
+	}
+}
+
+func TestCompress_Zstd(t *testing.T) {
+	body := strings.Repeat(`{"p":1.23}`, 200)
+	calls := 0
+	handler := newCompressHandler(100, body, "", &calls)
+
+	req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "zstd" {
+		t.Fatalf("Expected Content-Encoding zstd, got %q", rr.Header().Get("Content-Encoding"))
+	}
+
+	dec, err := zstd.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	decoded, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != body {
+		t.Errorf("Decoded body does not match original")
+	}
+}
+
+func TestCompress_BelowMinSize(t *testing.T) {
+	calls := 0
+	handler := newCompressHandler(1024, `{"p":1.23}`, "", &calls)
+
+	req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding, got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Body.String() != `{"p":1.23}` {
+		t.Errorf("Expected body to be passed through, got %q", rr.Body.String())
+	}
+	if rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", rr.Header().Get("Vary"))
+	}
+}
+
+func TestCompress_VaryWithCORS(t *testing.T) {
+	cfg := &config.Config{
+		CORSAllowedOrigins: []string{"http://example.com"},
+		CompressionMinSize: 10,
+	}
+	handler := CORS(cfg)(Compress(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, strings.Repeat("a", 100))
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	vary := rr.Header().Values("Vary")
+	if !slices.Contains(vary, "Origin") || !slices.Contains(vary, "Accept-Encoding") {
+		t.Errorf("Expected Vary to contain Origin and Accept-Encoding, got %v", vary)
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "http://example.com" {
+		t.Errorf("Expected CORS headers to be kept, got %q", rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestCompress_CachesImmutable(t *testing.T) {
+	body := strings.Repeat(`{"p":1.23}`, 200)
+	calls := 0
+	handler := newCompressHandler(100, body, "public, max-age=604800, immutable", &calls)
+
+	var first []byte
+	for i := range 2 {
+		req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Request %d: expected Content-Encoding gzip, got %q", i, rr.Header().Get("Content-Encoding"))
+		}
+		if rr.Header().Get("Cache-Control") != "public, max-age=604800, immutable" {
+			t.Errorf("Request %d: unexpected Cache-Control %q", i, rr.Header().Get("Cache-Control"))
+		}
+		if i == 0 {
+			first = rr.Body.Bytes()
+		} else if string(first) != rr.Body.String() {
+			t.Errorf("Cached body differs from the original compressed body")
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected handler to be called once, got %d", calls)
+	}
+
+	// A different encoding is a different cache entry.
+	req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if calls != 2 {
+		t.Errorf("Expected handler to be called for zstd, got %d calls", calls)
+	}
+}
+
+func TestCompress_CachedHeaders(t *testing.T) {
+	calls := 0
+	handler := Compress(&config.Config{CompressionMinSize: 10})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Cache-Control", "public, max-age=604800, immutable")
+		w.Header().Set("Expires", "Wed, 01 Jan 2025 11:57:00 GMT")
+		w.Header().Set("Content-Disposition", `attachment; filename="prices.csv"`)
+		w.Header().Add("Vary", "Accept")
+		_, _ = io.WriteString(w, strings.Repeat("a;1\n", 100))
+	}))
+
+	for i := range 2 {
+		req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		// Set by outer middleware on every request
+		rr.Header().Set(RequestIDHeader, strconv.Itoa(i))
+		rr.Header().Add("Vary", "Origin")
+		handler.ServeHTTP(rr, req)
+
+		h := rr.Header()
+		if got := h.Values("Vary"); !slices.Equal(got, []string{"Origin", "Accept-Encoding", "Accept"}) {
+			t.Errorf("Request %d: unexpected Vary %q", i, got)
+		}
+		if h.Get("Expires") != "Wed, 01 Jan 2025 11:57:00 GMT" || h.Get("Content-Disposition") == "" || h.Get("Content-Type") != "text/csv" {
+			t.Errorf("Request %d: missing headers %v", i, h)
+		}
+		if h.Get(RequestIDHeader) != strconv.Itoa(i) {
+			t.Errorf("Request %d: expected request ID %d, got %q", i, i, h.Get(RequestIDHeader))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the second response to come from the cache, got %d calls", calls)
+	}
+}
+
+func TestCompress_DoesNotCacheMutable(t *testing.T) {
+	body := strings.Repeat(`{"p":1.23}`, 200)
+	calls := 0
+	handler := newCompressHandler(100, body, "public, max-age=60", &calls)
+
+	for range 2 {
+		req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected handler to be called twice, got %d", calls)
+	}
+}
+
+func TestCompress_DoesNotCacheAborted(t *testing.T) {
+	calls := 0
+	handler := Compress(&config.Config{CompressionMinSize: 100})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=604800, immutable")
+		_, _ = io.WriteString(w, strings.Repeat(`{"p":1.23}`, 200))
+		panic(http.ErrAbortHandler)
+	}))
+
+	for range 2 {
+		req := httptest.NewRequest("GET", "/api/prices?from=2025-01-01&to=2025-01-31", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		func() {
+			defer func() { _ = recover() }()
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected truncated responses not to be cached, handler called %d times", calls)
+	}
+}
+
+func TestCompress_SkipsIncompressibleTypes(t *testing.T) {
+	cfg := &config.Config{CompressionMinSize: 10}
+	handler := Compress(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = io.WriteString(w, strings.Repeat("a", 100))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding, got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Body.Len() != 100 {
+		t.Errorf("Expected body of 100 bytes, got %d", rr.Body.Len())
+	}
+}
+
+func TestCompress_SkipsUpgrades(t *testing.T) {
+	cfg := &config.Config{CompressionMinSize: 0}
+	server := httptest.NewServer(Compress(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("Expected the response writer of an upgrade request to be hijackable")
+		}
+	})))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag wraps next so that successful GET responses get an ETag of their body,
+// and requests whose If-None-Match matches it get 304 Not Modified. The body is
+// buffered, so next must not stream. The tag is weak as it is computed before
+// compression.
+func ETag(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next(w, r)
+			return
+		}
+
+		ew := &etagWriter{ResponseWriter: w, status: http.StatusOK}
+		next(ew, r)
+
+		if ew.status != http.StatusOK {
+			w.WriteHeader(ew.status)
+			_, _ = w.Write(ew.buf.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(ew.buf.Bytes())
+		etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		if ETagMatches(r.Header.Get("If-None-Match"), etag) {
+			h := w.Header()
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(ew.buf.Len()))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(ew.buf.Bytes())
+	}
+}
+
+// ETagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison of RFC 9110 section 8.8.3.2. Streaming handlers, which can't
+// be wrapped in ETag, use it with a tag of what they are about to send.
+func ETagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagWriter buffers a response so its ETag can be set before it is sent.
+type etagWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (ew *etagWriter) WriteHeader(status int) {
+	if !ew.wroteHeader {
+		ew.status = status
+		ew.wroteHeader = true
+	}
+}
+
+func (ew *etagWriter) Write(p []byte) (int, error) {
+	ew.wroteHeader = true
+	return ew.buf.Write(p)
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/samlof/ehin/internal/config"
+)
+
+func TestETag(t *testing.T) {
+	handler := ETag(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `[{"p":1.23}]`)
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/api/prices/2025-01-01", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Expected 200 with a weak ETag, got %d %q", rr.Code, etag)
+	}
+	if rr.Body.String() != `[{"p":1.23}]` || rr.Header().Get("Content-Length") != "12" {
+		t.Errorf("Unexpected body %q with length %s", rr.Body.String(), rr.Header().Get("Content-Length"))
+	}
+
+	for _, header := range []string{etag, strings.TrimPrefix(etag, "W/"), `"other", ` + etag, "*"} {
+		req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+		req.Header.Set("If-None-Match", header)
+		rr = httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: expected empty 304, got %d %q", header, rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("ETag") != etag {
+			t.Errorf("Expected ETag on 304, got %q", rr.Header().Get("ETag"))
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+	req.Header.Set("If-None-Match", `"other"`)
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a stale ETag, got %d", rr.Code)
+	}
+}
+
+func TestETag_SkipsErrors(t *testing.T) {
+	handler := ETag(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadRequest)
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("ETag") != "" {
+		t.Errorf("Expected 400 without ETag, got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+	if rr.Body.String() != "nope\n" {
+		t.Errorf("Expected body to be passed through, got %q", rr.Body.String())
+	}
+}
+
+func TestETag_CompressedCache(t *testing.T) {
+	body := strings.Repeat(`{"p":1.23}`, 200)
+	handler := Compress(&config.Config{CompressionMinSize: 100})(ETag(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=604800, immutable")
+		_, _ = io.WriteString(w, body)
+	}))
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected compressed response with ETag, got %v", first.Header())
+	}
+
+	// Served from the compressed cache
+	if rr := get(""); rr.Header().Get("ETag") != etag || rr.Code != http.StatusOK {
+		t.Errorf("Expected cached response with ETag %s, got %d %v", etag, rr.Code, rr.Header())
+	}
+	if rr := get(etag); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("Expected empty 304 from the cache, got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+}
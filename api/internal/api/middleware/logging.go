@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	// Longer or unusual incoming IDs are replaced, so they can't be used to forge log lines
+	maxRequestIDLength = 128
+)
+
+// RequestLogger creates a middleware that gives each request an ID, propagated
+// from the X-Request-ID header when present and returned in the response. The
+// context of the request carries a logger tagged with the ID, see
+// logging.FromContext. A line with the route pattern, status, size and latency
+// is logged when the request is done.
+func RequestLogger(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = rand.Text()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			logger := slog.Default().With("requestId", id)
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				logger = logger.With("traceId", sc.TraceID().String())
+			}
+			ctx := logging.WithRequestID(r.Context(), id)
+			r = r.WithContext(logging.WithLogger(ctx, logger))
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			_, route := mux.Handler(r)
+			if route == "" {
+				route = "unmatched"
+			}
+			logger.Info("Request",
+				"method", r.Method,
+				"route", route,
+				"status", sw.status,
+				"bytes", sw.bytes,
+				"latency", time.Since(start),
+			)
+		})
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == ':'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Recover creates a middleware that turns a panicking handler into a 500
+// problem details response and logs the panic with its stack trace. It should
+// wrap the mux directly, inside RequestLogger and any writers that buffer the
+// response.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// Used by handlers to abort a response on purpose
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			logging.FromContext(r.Context()).Error("Panic in handler",
+				"panic", err,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"stack", string(debug.Stack()),
+			)
+			// Headers already sent can't be changed, the client gets a truncated response
+			if sw.wroteHeader {
+				return
+			}
+			problem.Internal(w, r)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/logging"
+)
+
+// captureLogs sends the default logger's output to a buffer for the duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestRequestLogger(t *testing.T) {
+	logs := captureLogs(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/prices/{date}", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("Handling")
+		_, _ = w.Write([]byte("hello"))
+	})
+	handler := RequestLogger(mux)(mux)
+
+	req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("Expected request ID to be propagated, got %q", rr.Header().Get(RequestIDHeader))
+	}
+	out := logs.String()
+	if !strings.Contains(out, `msg=Handling requestId=abc-123`) {
+		t.Errorf("Expected handler log line with request ID, got:\n%s", out)
+	}
+	for _, want := range []string{`msg=Request requestId=abc-123`, `method=GET`, `route="GET /api/prices/{date}"`, `status=200`, `bytes=5`, `latency=`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected access log to contain %s, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRequestLogger_GeneratesID(t *testing.T) {
+	captureLogs(t)
+	mux := http.NewServeMux()
+	handler := RequestLogger(mux)(mux)
+
+	for _, incoming := range []string{"", "bad id\nwith newline", strings.Repeat("a", 200)} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, incoming)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		id := rr.Header().Get(RequestIDHeader)
+		if id == "" || id == incoming {
+			t.Errorf("Expected a generated request ID for %q, got %q", incoming, id)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	logs := captureLogs(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	handler := RequestLogger(mux)(Recover(mux))
+
+	req := httptest.NewRequest("GET", "/boom", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Expected problem details, got %s", ct)
+	}
+	var body problem.Details
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != http.StatusInternalServerError || body.RequestID != "req-1" {
+		t.Errorf("Unexpected error body %+v", body)
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, "msg=\"Panic in handler\" requestId=req-1 panic=boom") {
+		t.Errorf("Expected panic to be logged, got:\n%s", out)
+	}
+	if !strings.Contains(out, "logging_test.go") {
+		t.Errorf("Expected stack trace in the log, got:\n%s", out)
+	}
+	if !strings.Contains(out, "status=500") {
+		t.Errorf("Expected access log with status 500, got:\n%s", out)
+	}
+}
+
+func TestRecover_AbortHandler(t *testing.T) {
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler to be re-panicked, got %v", err)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
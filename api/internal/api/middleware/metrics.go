@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/samlof/ehin/internal/metrics"
+)
+
+// Metrics creates a middleware that records the count and latency of requests
+// by the mux route pattern they match. The pattern is looked up before calling
+// next so responses served from the compression cache are labeled correctly.
+func Metrics(m *metrics.Metrics, mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, route := mux.Handler(r)
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			m.ObserveRequest(route, sw.status, time.Since(start))
+		})
+	}
+}
+
+// statusWriter remembers the response status code and body size.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	bytes       int64
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status = status
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	sw.wroteHeader = true
+	n, err := sw.ResponseWriter.Write(p)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+// Flush is needed by writers that check for http.Flusher, such as compressWriter.
+func (sw *statusWriter) Flush() {
+	_ = http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// Hijack is needed by the WebSocket upgrader, which checks for http.Hijacker.
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(sw.ResponseWriter).Hijack()
+	if err == nil {
+		sw.status = http.StatusSwitchingProtocols
+		sw.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
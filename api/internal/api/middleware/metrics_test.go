@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/metrics"
+	"github.com/samlof/ehin/internal/testutil"
+)
+
+func TestMetrics_RoutePattern(t *testing.T) {
+	m := metrics.New(testutil.FixedTime{Time: time.Now()})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/prices/{date}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := Metrics(m, mux)(mux)
+
+	for _, path := range []string{"/api/prices/2025-01-01", "/api/prices/2025-01-02", "/nope"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body := rr.Body.String()
+
+	if !strings.Contains(body, `ehin_http_requests_total{code="418",route="GET /api/prices/{date}"} 2`) {
+		t.Errorf("Expected requests to be counted by route pattern, got:\n%s", body)
+	}
+	if !strings.Contains(body, `ehin_http_requests_total{code="404",route="unmatched"} 1`) {
+		t.Errorf("Expected unmatched request to be counted, got:\n%s", body)
+	}
+}
+
+func TestMetrics_KeepsWriterInterfaces(t *testing.T) {
+	m := metrics.New(testutil.FixedTime{Time: time.Now()})
+	mux := http.NewServeMux()
+	handler := Metrics(m, mux)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("Expected writer to implement http.Hijacker")
+		}
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("Expected writer to implement http.Flusher")
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -8,11 +8,14 @@ import (
 )
 
 // CORS creates a middleware that handles Cross-Origin Resource Sharing.
+// POST is allowed for the public endpoints that take a JSON body, such as
+// /api/graphql and /api/schedule.
 func CORS(cfg *config.Config) func(http.Handler) http.Handler {
 	c := cors.New(cors.Options{
 		AllowedOrigins:   cfg.CORSAllowedOrigins,
-		AllowedMethods:   []string{"GET"},
-		ExposedHeaders:   []string{"Cache-Control", "Content-Type"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Accept", "Content-Type", "X-Requested-With", APIKeyHeader, RequestIDHeader},
+		ExposedHeaders:   []string{"Cache-Control", "Content-Type", "Content-Disposition", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", RequestIDHeader},
 		MaxAge:           86400, // 24 hours
 		AllowCredentials: true,
 	})
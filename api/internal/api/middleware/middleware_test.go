@@ -83,3 +83,41 @@ func TestCORS_Preflight(t *testing.T) {
 			rr.Header().Get("Access-Control-Max-Age"))
 	}
 }
+
+func TestCORS_PreflightPost(t *testing.T) {
+	cfg := &config.Config{
+		CORSAllowedOrigins: []string{"http://example.com"},
+	}
+	handler := CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Preflight must not reach the handler")
+	}))
+
+	for _, path := range []string{"/api/graphql", "/api/consumption/cost", "/api/contracts/compare", "/api/schedule"} {
+		req := httptest.NewRequest("OPTIONS", path, nil)
+		req.Header.Set("Origin", "http://example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-api-key")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("%s: expected status 204 for preflight, got %d", path, rr.Code)
+		}
+		if rr.Header().Get("Access-Control-Allow-Methods") != "POST" {
+			t.Errorf("%s: expected Access-Control-Allow-Methods: POST, got %q", path, rr.Header().Get("Access-Control-Allow-Methods"))
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "content-type,x-api-key" {
+			t.Errorf("%s: expected Content-Type and X-API-Key to be allowed, got %q", path, got)
+		}
+	}
+
+	req := httptest.NewRequest("OPTIONS", "/api/schedule", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("Expected DELETE to be refused, got %q", rr.Header().Get("Access-Control-Allow-Methods"))
+	}
+}
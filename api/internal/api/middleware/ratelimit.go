@@ -0,0 +1,281 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/auth"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/service"
+)
+
+const (
+	APIKeyHeader     = "X-API-Key"
+	apiKeyQueryParam = "api_key"
+
+	// How long looked up keys are cached. Deleted keys keep working for at most this long.
+	apiKeyCacheTTL = time.Minute
+	// Limits memory use when clients send lots of random keys
+	maxCachedAPIKeys = 10000
+	// Buckets unused for this long are full again and can be dropped.
+	bucketIdleTimeout = 10 * time.Minute
+	// How often usage counters are written to the database.
+	usageFlushInterval = time.Minute
+)
+
+// tokenBucket holds up to burst tokens and refills at perMinute tokens a minute.
+// Every request takes one token.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token if there is one. It returns the tokens left, or how long
+// until the next token when there are none.
+func (b *tokenBucket) take(now time.Time, perMinute, burst int) (int, time.Duration, bool) {
+	rate := float64(perMinute) / float64(time.Minute)
+	b.tokens = math.Min(float64(burst), b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration(math.Ceil((1 - b.tokens) / rate))
+		return 0, wait, false
+	}
+	b.tokens--
+	return int(b.tokens), 0, true
+}
+
+type cachedAPIKey struct {
+	// Nil for keys that don't exist
+	key     *model.APIKey
+	fetched time.Time
+}
+
+// RateLimiter limits public API requests with token buckets. Requests with an
+// API key get the key's limit, anonymous requests are limited by client IP.
+type RateLimiter struct {
+	apiKeyRepository   repository.APIKeyRepository
+	timeProvider       service.TimeProvider
+	anonymousPerMinute int
+	anonymousBurst     int
+	// On App Engine the client IP is taken from a header set by its frontend
+	trustProxy bool
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	keys      map[string]cachedAPIKey
+	usage     map[int64]int64
+}
+
+func NewRateLimiter(cfg *config.Config, apiKeyRepository repository.APIKeyRepository, timeProvider service.TimeProvider) *RateLimiter {
+	return &RateLimiter{
+		apiKeyRepository:   apiKeyRepository,
+		timeProvider:       timeProvider,
+		anonymousPerMinute: cfg.RateLimitPerMinute,
+		anonymousBurst:     cfg.RateLimitBurst,
+		trustProxy:         cfg.AppEngine,
+		buckets:            map[string]*tokenBucket{},
+		keys:               map[string]cachedAPIKey{},
+		usage:              map[int64]int64{},
+	}
+}
+
+type takeKey struct{}
+
+// TakeFunc takes one request from the bucket of a limited request. It returns
+// how long to wait when the bucket is empty.
+type TakeFunc func() (time.Duration, bool)
+
+// TakeFromContext returns the TakeFunc of a limited request, or nil if the
+// request isn't limited. Handlers that serve several requests over one
+// connection, like WebSockets, use it to limit each of them.
+func TakeFromContext(ctx context.Context) TakeFunc {
+	take, _ := ctx.Value(takeKey{}).(TakeFunc)
+	return take
+}
+
+// Limit wraps next with rate limiting. Rejected requests get 429 with Retry-After.
+func (l *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := "ip:" + clientIP(r, l.trustProxy)
+		perMinute, burst := l.anonymousPerMinute, l.anonymousBurst
+		var keyID int64
+
+		if apiKey := requestAPIKey(r); apiKey != "" && l.apiKeyRepository != nil {
+			key, err := l.lookupKey(r.Context(), apiKey)
+			if err != nil {
+				slog.Error("Error looking up API key", "error", err)
+				problem.Internal(w, r)
+				return
+			}
+			if key == nil {
+				problem.Write(w, r, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+			bucket = "key:" + strconv.FormatInt(key.ID, 10)
+			perMinute, burst = key.RequestsPerMinute, key.Burst
+			keyID = key.ID
+			l.countUsage(keyID)
+		}
+
+		if perMinute <= 0 {
+			next(w, r)
+			return
+		}
+
+		remaining, wait, ok := l.take(bucket, perMinute, burst)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(perMinute))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			problem.Write(w, r, http.StatusTooManyRequests, fmt.Sprintf("Rate limit exceeded. Retry after %d seconds", retryAfter))
+			return
+		}
+
+		take := TakeFunc(func() (time.Duration, bool) {
+			if keyID != 0 {
+				l.countUsage(keyID)
+			}
+			_, wait, ok := l.take(bucket, perMinute, burst)
+			return wait, ok
+		})
+		next(w, r.WithContext(context.WithValue(r.Context(), takeKey{}, take)))
+	}
+}
+
+// LimitRoutes creates a middleware that applies Limit to the requests matching
+// one of patterns in mux. It has to run outside Compress, whose cached
+// responses never reach the handlers registered in mux.
+func (l *RateLimiter) LimitRoutes(mux *http.ServeMux, patterns map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limited := l.Limit(next.ServeHTTP)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, pattern := mux.Handler(r); patterns[pattern] {
+				limited(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (l *RateLimiter) take(bucketKey string, perMinute, burst int) (int, time.Duration, bool) {
+	now := l.timeProvider.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > bucketIdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[bucketKey]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[bucketKey] = b
+	}
+	return b.take(now, perMinute, max(burst, 1))
+}
+
+func (l *RateLimiter) lookupKey(ctx context.Context, apiKey string) (*model.APIKey, error) {
+	hash := auth.HashToken(apiKey)
+	now := l.timeProvider.Now()
+
+	l.mu.Lock()
+	cached, ok := l.keys[hash]
+	l.mu.Unlock()
+	if ok && now.Sub(cached.fetched) < apiKeyCacheTTL {
+		return cached.key, nil
+	}
+
+	key, err := l.apiKeyRepository.GetKeyByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	if len(l.keys) >= maxCachedAPIKeys {
+		clear(l.keys)
+	}
+	l.keys[hash] = cachedAPIKey{key: key, fetched: now}
+	l.mu.Unlock()
+	return key, nil
+}
+
+func (l *RateLimiter) countUsage(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.usage[id]++
+}
+
+// FlushUsage writes the usage counters collected since the last flush to the database.
+func (l *RateLimiter) FlushUsage(ctx context.Context) error {
+	l.mu.Lock()
+	usage := l.usage
+	l.usage = map[int64]int64{}
+	l.mu.Unlock()
+
+	if len(usage) == 0 || l.apiKeyRepository == nil {
+		return nil
+	}
+	return l.apiKeyRepository.AddUsage(ctx, usage, l.timeProvider.Now())
+}
+
+// Run flushes usage counters periodically until ctx is done, then flushes once more.
+func (l *RateLimiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := l.FlushUsage(context.WithoutCancel(ctx)); err != nil {
+				slog.Error("Error flushing API key usage", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := l.FlushUsage(ctx); err != nil {
+				slog.Error("Error flushing API key usage", "error", err)
+			}
+		}
+	}
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	return r.URL.Query().Get(apiKeyQueryParam)
+}
+
+// clientIP returns the IP of the client. When trustProxy is set the
+// X-Appengine-User-Ip header is used. Unlike X-Forwarded-For, clients can't add to it.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if ip := r.Header.Get("X-Appengine-User-Ip"); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/auth"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+)
+
+type fakeAPIKeyRepository struct {
+	keys    map[string]model.APIKey
+	lookups int
+	usage   map[int64]int64
+}
+
+func (f *fakeAPIKeyRepository) CreateKey(ctx context.Context, key *model.APIKey) error {
+	f.keys[key.KeyHash] = *key
+	return nil
+}
+
+func (f *fakeAPIKeyRepository) ListKeys(ctx context.Context) ([]model.APIKey, error) {
+	return nil, nil
+}
+
+func (f *fakeAPIKeyRepository) GetKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	f.lookups++
+	key, ok := f.keys[hash]
+	if !ok {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+func (f *fakeAPIKeyRepository) DeleteKey(ctx context.Context, id int64) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeAPIKeyRepository) AddUsage(ctx context.Context, counts map[int64]int64, lastUsed time.Time) error {
+	for id, count := range counts {
+		f.usage[id] += count
+	}
+	return nil
+}
+
+func newLimitedHandler(l *RateLimiter) http.HandlerFunc {
+	return l.Limit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func doRequest(handler http.HandlerFunc, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &tokenBucket{tokens: 2, last: now}
+
+	if remaining, _, ok := b.take(now, 60, 2); !ok || remaining != 1 {
+		t.Errorf("Expected first take to succeed with 1 left, got %v %d", ok, remaining)
+	}
+	if _, _, ok := b.take(now, 60, 2); !ok {
+		t.Error("Expected second take to succeed")
+	}
+	_, wait, ok := b.take(now, 60, 2)
+	if ok || wait != time.Second {
+		t.Errorf("Expected empty bucket with 1s wait, got %v %s", ok, wait)
+	}
+
+	// One token a second at 60 a minute
+	if _, _, ok := b.take(now.Add(time.Second), 60, 2); !ok {
+		t.Error("Expected a token after refilling")
+	}
+	// Refilling stops at burst
+	if remaining, _, _ := b.take(now.Add(time.Hour), 60, 2); remaining != 1 {
+		t.Errorf("Expected refill to be capped at burst, got %d left", remaining)
+	}
+}
+
+func TestRateLimiter_Anonymous(t *testing.T) {
+	clock := &testutil.FixedTime{Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := NewRateLimiter(&config.Config{RateLimitPerMinute: 60, RateLimitBurst: 2}, nil, clock)
+	handler := newLimitedHandler(l)
+
+	for range 2 {
+		if rr := doRequest(handler, "1.2.3.4:1000", nil); rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rr.Code)
+		}
+	}
+
+	rr := doRequest(handler, "1.2.3.4:1001", nil)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", rr.Header().Get("Retry-After"))
+	}
+	if rr.Header().Get("Content-Type") != problem.ContentType {
+		t.Errorf("Expected problem details, got %q", rr.Header().Get("Content-Type"))
+	}
+	if rr.Header().Get("X-RateLimit-Limit") != "60" || rr.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Unexpected rate limit headers %v", rr.Header())
+	}
+
+	// Other clients have their own buckets
+	if rr := doRequest(handler, "5.6.7.8:1000", nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected another IP to be allowed, got %d", rr.Code)
+	}
+
+	clock.Time = clock.Time.Add(time.Second)
+	if rr := doRequest(handler, "1.2.3.4:1000", nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected a request to be allowed after waiting, got %d", rr.Code)
+	}
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	l := NewRateLimiter(&config.Config{RateLimitPerMinute: 0, RateLimitBurst: 1}, nil, &testutil.FixedTime{})
+	handler := newLimitedHandler(l)
+
+	for range 10 {
+		if rr := doRequest(handler, "1.2.3.4:1000", nil); rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rr.Code)
+		}
+	}
+}
+
+func TestRateLimiter_AppEngineClientIP(t *testing.T) {
+	l := NewRateLimiter(&config.Config{RateLimitPerMinute: 60, RateLimitBurst: 1, AppEngine: true}, nil, &testutil.FixedTime{})
+	handler := newLimitedHandler(l)
+
+	// All requests come from the App Engine frontend
+	if rr := doRequest(handler, "10.0.0.1:1000", http.Header{"X-Appengine-User-Ip": {"1.2.3.4"}}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rr.Code)
+	}
+	if rr := doRequest(handler, "10.0.0.1:1000", http.Header{"X-Appengine-User-Ip": {"5.6.7.8"}}); rr.Code != http.StatusOK {
+		t.Errorf("Expected clients to be told apart by X-Appengine-User-Ip, got %d", rr.Code)
+	}
+}
+
+func TestRateLimiter_APIKey(t *testing.T) {
+	clock := &testutil.FixedTime{Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	repo := &fakeAPIKeyRepository{keys: map[string]model.APIKey{}, usage: map[int64]int64{}}
+	_ = repo.CreateKey(context.Background(), &model.APIKey{ID: 7, KeyHash: auth.HashToken("ehin_pk_valid"), RequestsPerMinute: 600, Burst: 3})
+
+	l := NewRateLimiter(&config.Config{RateLimitPerMinute: 60, RateLimitBurst: 1}, repo, clock)
+	handler := newLimitedHandler(l)
+
+	// The key's limit is used instead of the anonymous one
+	for range 3 {
+		if rr := doRequest(handler, "1.2.3.4:1000", http.Header{"X-Api-Key": {"ehin_pk_valid"}}); rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rr.Code)
+		}
+	}
+	rr := doRequest(handler, "1.2.3.4:1000", http.Header{"X-Api-Key": {"ehin_pk_valid"}})
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("X-RateLimit-Limit") != "600" {
+		t.Errorf("Expected the key's limit in headers, got %q", rr.Header().Get("X-RateLimit-Limit"))
+	}
+	if repo.lookups != 1 {
+		t.Errorf("Expected the key to be cached, got %d lookups", repo.lookups)
+	}
+
+	// Query parameter works too, and the anonymous bucket of the IP is untouched
+	req := httptest.NewRequest("GET", "/api/prices/2025-01-01?api_key=ehin_pk_valid", nil)
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected query parameter key to share the key's bucket, got %d", rr.Code)
+	}
+	if rr := doRequest(handler, "1.2.3.4:1000", nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected anonymous request to be allowed, got %d", rr.Code)
+	}
+
+	if rr := doRequest(handler, "1.2.3.4:1000", http.Header{"X-Api-Key": {"ehin_pk_invalid"}}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unknown key to be rejected, got %d", rr.Code)
+	}
+
+	if err := l.FlushUsage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if repo.usage[7] != 5 {
+		t.Errorf("Expected 5 requests counted for the key, got %d", repo.usage[7])
+	}
+}
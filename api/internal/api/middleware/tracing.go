@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing creates a middleware that starts a server span for each request,
+// continuing the trace of an incoming traceparent header. Spans are named by
+// the mux route pattern they match, like the Metrics middleware labels them.
+func Tracing(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withRoute := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, route := mux.Handler(r); route != "" {
+				trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.route", route))
+			}
+			next.ServeHTTP(w, r)
+		})
+		return otelhttp.NewHandler(withRoute, "http.server", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if _, route := mux.Handler(r); route != "" {
+				return route
+			}
+			// Like OpenTelemetry's naming convention for requests without a route
+			return r.Method
+		}))
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	mux := http.NewServeMux()
+	var handlerSpan trace.SpanContext
+	mux.HandleFunc("GET /api/prices/{date}", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+	})
+	handler := Tracing(mux)(mux)
+
+	req := httptest.NewRequest("GET", "/api/prices/2025-01-01", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nope", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name != "GET /api/prices/{date}" {
+		t.Errorf("Expected span named by route pattern, got %s", span.Name)
+	}
+	if span.SpanKind != trace.SpanKindServer {
+		t.Errorf("Expected server span, got %v", span.SpanKind)
+	}
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected incoming trace to be continued, got trace %s", span.SpanContext.TraceID())
+	}
+	if span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected remote parent 00f067aa0ba902b7, got %s", span.Parent.SpanID())
+	}
+	if handlerSpan.SpanID() != span.SpanContext.SpanID() {
+		t.Error("Expected handler context to carry the server span")
+	}
+	found := false
+	for _, a := range span.Attributes {
+		if a == attribute.String("http.route", "GET /api/prices/{date}") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected http.route attribute, got %v", span.Attributes)
+	}
+
+	if spans[1].Name != "GET" {
+		t.Errorf("Expected unmatched request span named by method, got %s", spans[1].Name)
+	}
+}
@@ -0,0 +1,78 @@
+// Package problem writes error responses as RFC 9457 problem details, so
+// clients can always parse an error body as JSON.
+package problem
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/samlof/ehin/internal/logging"
+)
+
+const ContentType = "application/problem+json"
+
+// Used when the status code alone describes the problem, see RFC 9457 section 4.2.1.
+const TypeBlank = "about:blank"
+
+// Details is the body of an error response.
+type Details struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Human readable explanation of this occurrence, safe to show to users
+	Detail string `json:"detail,omitempty"`
+	// Path of the request that failed
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// New returns the problem details for an error with status and detail in
+// response to r.
+func New(r *http.Request, status int, detail string) Details {
+	return Details{
+		Type:      TypeBlank,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: logging.RequestID(r.Context()),
+	}
+}
+
+// Write sends an error response with status and detail in response to r.
+func Write(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	WriteDetails(w, New(r, status, detail))
+}
+
+// WriteDetails sends p as the response. Headers set earlier, such as
+// Retry-After, are kept.
+func WriteDetails(w http.ResponseWriter, p Details) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		slog.Error("Error encoding problem details", "error", err)
+	}
+}
+
+// BadRequest sends a 400 response explaining what is wrong with the request.
+func BadRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	Write(w, r, http.StatusBadRequest, detail)
+}
+
+// NotFound sends a 404 response.
+func NotFound(w http.ResponseWriter, r *http.Request, detail string) {
+	Write(w, r, http.StatusNotFound, detail)
+}
+
+// Internal sends a 500 response. The cause should be logged by the caller and
+// not shown to the client.
+func Internal(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusInternalServerError, "")
+}
+
+// Unavailable sends a 503 response.
+func Unavailable(w http.ResponseWriter, r *http.Request, detail string) {
+	Write(w, r, http.StatusServiceUnavailable, detail)
+}
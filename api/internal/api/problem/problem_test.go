@@ -0,0 +1,63 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samlof/ehin/internal/logging"
+)
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/prices/bad?x=1", nil)
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-1"))
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Retry-After", "5")
+
+	BadRequest(rr, req, "Invalid date format. Use YYYY-MM-DD")
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Expected content type %s, got %s", ContentType, ct)
+	}
+	if rr.Header().Get("Retry-After") != "5" {
+		t.Error("Expected earlier headers to be kept")
+	}
+
+	var got Details
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := Details{
+		Type:      TypeBlank,
+		Title:     "Bad Request",
+		Status:    http.StatusBadRequest,
+		Detail:    "Invalid date format. Use YYYY-MM-DD",
+		Instance:  "/api/prices/bad",
+		RequestID: "req-1",
+	}
+	if got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestInternal(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Internal(rr, httptest.NewRequest("GET", "/", nil))
+
+	var got map[string]any
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["title"] != "Internal Server Error" || got["status"] != float64(500) {
+		t.Errorf("Unexpected body %v", got)
+	}
+	for _, key := range []string{"detail", "requestId"} {
+		if _, ok := got[key]; ok {
+			t.Errorf("Expected %s to be omitted, got %v", key, got)
+		}
+	}
+}
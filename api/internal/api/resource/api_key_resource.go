@@ -0,0 +1,148 @@
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/auth"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/logging"
+)
+
+const (
+	defaultAPIKeyRequestsPerMinute = 600
+	defaultAPIKeyBurst             = 100
+)
+
+// APIKeyResource is the admin API for managing public API keys.
+// Callers are authenticated by middleware.
+type APIKeyResource struct {
+	apiKeyRepository repository.APIKeyRepository
+}
+
+func NewAPIKeyResource(apiKeyRepository repository.APIKeyRepository) *APIKeyResource {
+	return &APIKeyResource{
+		apiKeyRepository: apiKeyRepository,
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	// Defaults to 600
+	RequestsPerMinute int `json:"requestsPerMinute"`
+	// Defaults to 100
+	Burst int `json:"burst"`
+}
+
+type CreateAPIKeyResponse struct {
+	model.APIKey
+	// The key itself is only returned once
+	Key string `json:"key"`
+}
+
+// CreateKey handles POST /api/admin/api-keys.
+func (res *APIKeyResource) CreateKey(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if !res.checkRepository(w, r) {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		problem.BadRequest(w, r, "Invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		problem.BadRequest(w, r, "name is required")
+		return
+	}
+	if req.RequestsPerMinute == 0 {
+		req.RequestsPerMinute = defaultAPIKeyRequestsPerMinute
+	}
+	if req.Burst == 0 {
+		req.Burst = defaultAPIKeyBurst
+	}
+	if req.RequestsPerMinute < 0 || req.Burst < 0 {
+		problem.BadRequest(w, r, "requestsPerMinute and burst must be positive")
+		return
+	}
+
+	secret := auth.NewAPIKey()
+	key := model.APIKey{
+		Name:              req.Name,
+		KeyHash:           auth.HashToken(secret),
+		RequestsPerMinute: req.RequestsPerMinute,
+		Burst:             req.Burst,
+	}
+	if err := res.apiKeyRepository.CreateKey(r.Context(), &key); err != nil {
+		logger.Error("Error creating API key", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	logger.Info("Created API key", "id", key.ID, "name", key.Name)
+	writeJSON(w, http.StatusCreated, CreateAPIKeyResponse{APIKey: key, Key: secret})
+}
+
+// ListKeys handles GET /api/admin/api-keys. Usage counters are updated every minute.
+func (res *APIKeyResource) ListKeys(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if !res.checkRepository(w, r) {
+		return
+	}
+
+	keys, err := res.apiKeyRepository.ListKeys(r.Context())
+	if err != nil {
+		logger.Error("Error listing API keys", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if keys == nil {
+		keys = []model.APIKey{}
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// DeleteKey handles DELETE /api/admin/api-keys/{id}.
+func (res *APIKeyResource) DeleteKey(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if !res.checkRepository(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		problem.BadRequest(w, r, "Invalid id")
+		return
+	}
+
+	deleted, err := res.apiKeyRepository.DeleteKey(r.Context(), id)
+	if err != nil {
+		logger.Error("Error deleting API key", "id", id, "error", err)
+		problem.Internal(w, r)
+		return
+	}
+	if !deleted {
+		problem.NotFound(w, r, "")
+		return
+	}
+
+	logger.Info("Deleted API key", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *APIKeyResource) checkRepository(w http.ResponseWriter, r *http.Request) bool {
+	logger := logging.FromContext(r.Context())
+	if res.apiKeyRepository == nil {
+		logger.Warn("API key repository not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/auth"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) CreateKey(ctx context.Context, key *model.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) ListKeys(ctx context.Context) ([]model.APIKey, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) GetKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	args := m.Called(ctx, hash)
+	return args.Get(0).(*model.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) DeleteKey(ctx context.Context, id int64) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) AddUsage(ctx context.Context, counts map[int64]int64, lastUsed time.Time) error {
+	args := m.Called(ctx, counts, lastUsed)
+	return args.Error(0)
+}
+
+func TestAPIKeyResource_CreateKey(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	res := NewAPIKeyResource(mockRepo)
+
+	var stored *model.APIKey
+	mockRepo.On("CreateKey", mock.Anything, mock.AnythingOfType("*model.APIKey")).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*model.APIKey)
+			stored.ID = 2
+		}).Return(nil).Once()
+
+	req := httptest.NewRequest("POST", "/api/admin/api-keys", strings.NewReader(`{"name":" integration "}`))
+	rr := httptest.NewRecorder()
+	res.CreateKey(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NotContains(t, rr.Body.String(), stored.KeyHash)
+
+	var resp CreateAPIKeyResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, int64(2), resp.ID)
+	assert.Equal(t, "integration", resp.Name)
+	assert.Equal(t, defaultAPIKeyRequestsPerMinute, resp.RequestsPerMinute)
+	assert.Equal(t, defaultAPIKeyBurst, resp.Burst)
+	assert.Equal(t, auth.HashToken(resp.Key), stored.KeyHash)
+}
+
+func TestAPIKeyResource_CreateKey_Invalid(t *testing.T) {
+	res := NewAPIKeyResource(new(MockAPIKeyRepository))
+
+	for _, body := range []string{
+		`not json`,
+		`{"name":""}`,
+		`{"name":"a","requestsPerMinute":-1}`,
+	} {
+		rr := httptest.NewRecorder()
+		res.CreateKey(rr, httptest.NewRequest("POST", "/api/admin/api-keys", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
+
+func TestAPIKeyResource_ListKeys(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	res := NewAPIKeyResource(mockRepo)
+	mockRepo.On("ListKeys", mock.Anything).Return([]model.APIKey{
+		{ID: 1, Name: "a", KeyHash: "secret-hash", RequestCount: 42},
+	}, nil)
+
+	rr := httptest.NewRecorder()
+	res.ListKeys(rr, httptest.NewRequest("GET", "/api/admin/api-keys", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"requestCount":42`)
+	assert.NotContains(t, rr.Body.String(), "secret-hash")
+}
+
+func TestAPIKeyResource_DeleteKey(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	res := NewAPIKeyResource(mockRepo)
+	mockRepo.On("DeleteKey", mock.Anything, int64(1)).Return(true, nil)
+	mockRepo.On("DeleteKey", mock.Anything, int64(2)).Return(false, nil)
+
+	req := httptest.NewRequest("DELETE", "/api/admin/api-keys/1", nil)
+	req.SetPathValue("id", "1")
+	rr := httptest.NewRecorder()
+	res.DeleteKey(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	req = httptest.NewRequest("DELETE", "/api/admin/api-keys/2", nil)
+	req.SetPathValue("id", "2")
+	rr = httptest.NewRecorder()
+	res.DeleteKey(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,171 @@
+package resource
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/ical"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/service"
+	"github.com/samlof/ehin/internal/utils"
+)
+
+const (
+	defaultCalendarWindowHours = 3
+	// Past days kept in the feed so events don't vanish from calendars right away.
+	calendarHistoryDays = 7
+)
+
+type CalendarResource struct {
+	priceRepository repository.PriceRepository
+	dateService     service.TimeProvider
+}
+
+func NewCalendarResource(priceRepository repository.PriceRepository, dateService service.TimeProvider) *CalendarResource {
+	return &CalendarResource{
+		priceRepository: priceRepository,
+		dateService:     dateService,
+	}
+}
+
+// GetCalendar handles GET /api/calendar.ics
+//
+// Query parameters:
+//   - window: length in hours of the daily cheapest window event, 0 disables it (default 3)
+//   - above: adds events for periods where the price is above this many c/kWh (VAT 0%)
+func (res *CalendarResource) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	query := r.URL.Query()
+
+	windowHours := defaultCalendarWindowHours
+	if v := query.Get("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 24 {
+			problem.BadRequest(w, r, "Invalid window. Use hours between 0 and 24")
+			return
+		}
+		windowHours = n
+	}
+
+	var above *float64
+	if v := query.Get("above"); v != "" {
+		threshold, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			problem.BadRequest(w, r, "Invalid above. Use a price in c/kWh, e.g. 15.5")
+			return
+		}
+		above = &threshold
+	}
+
+	if res.priceRepository == nil {
+		logger.Warn("Price repository not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return
+	}
+
+	helsinki := loadHelsinki()
+	now := res.dateService.Now()
+	localNow := now.In(helsinki)
+	today := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, helsinki)
+	from := today.AddDate(0, 0, -calendarHistoryDays)
+	to := today.AddDate(0, 0, 2)
+
+	prices, err := res.priceRepository.GetPrices(r.Context(), from, to)
+	if err != nil {
+		logger.Error("Error fetching prices from repository", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	cal := ical.Calendar{
+		ProdID:          "-//ehin.fi//Electricity prices//EN",
+		Name:            "ehin.fi",
+		RefreshInterval: time.Hour,
+	}
+	if windowHours > 0 {
+		cal.Events = append(cal.Events, cheapestWindowEvents(prices, windowHours, helsinki, now)...)
+	}
+	if above != nil {
+		cal.Events = append(cal.Events, priceAboveEvents(prices, *above, now)...)
+	}
+
+	logger.Info("Returning calendar", "windowHours", windowHours, "eventCount", len(cal.Events))
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set(utils.CACHE_CONTROL_HEADER, utils.CACHE_VAR+", max-age=300")
+	if _, err := cal.WriteTo(w); err != nil {
+		logger.Error("Error writing calendar", "error", err)
+	}
+}
+
+// cheapestWindowEvents returns one event per Helsinki day for its cheapest window.
+func cheapestWindowEvents(prices []model.PriceHistoryEntry, windowHours int, loc *time.Location, now time.Time) []ical.Event {
+	var events []ical.Event
+	for _, day := range splitByDay(prices, loc) {
+		period, ok := service.CheapestWindow(day, time.Duration(windowHours)*time.Hour)
+		if !ok {
+			continue
+		}
+		date := day[0].DeliveryStart.In(loc).Format("20060102")
+		events = append(events, ical.Event{
+			UID:         fmt.Sprintf("cheapest-%dh-%s@ehin.fi", windowHours, date),
+			Stamp:       now,
+			Start:       period.Start,
+			End:         period.End,
+			Summary:     fmt.Sprintf("Cheapest %d h: %s c/kWh", windowHours, formatCentsPerKwh(period.AveragePrice)),
+			Description: fmt.Sprintf("Average spot price %s c/kWh (VAT 0%%)", formatCentsPerKwh(period.AveragePrice)),
+		})
+	}
+	return events
+}
+
+// priceAboveEvents returns one event per period priced above thresholdCents.
+// The UID is derived from the start of the period, so a period that grows when
+// the next day's prices arrive updates the existing event.
+func priceAboveEvents(prices []model.PriceHistoryEntry, thresholdCents float64, now time.Time) []ical.Event {
+	threshold := strconv.FormatFloat(thresholdCents, 'f', -1, 64)
+	periods := service.PeriodsAbove(prices, thresholdCents*10)
+	events := make([]ical.Event, 0, len(periods))
+	for _, period := range periods {
+		events = append(events, ical.Event{
+			UID:         fmt.Sprintf("above-%s-%s@ehin.fi", threshold, period.Start.UTC().Format("20060102T1504Z")),
+			Stamp:       now,
+			Start:       period.Start,
+			End:         period.End,
+			Summary:     fmt.Sprintf("Price above %s c/kWh", threshold),
+			Description: fmt.Sprintf("Average spot price %s c/kWh (VAT 0%%)", formatCentsPerKwh(period.AveragePrice)),
+		})
+	}
+	return events
+}
+
+// splitByDay groups sorted prices by their delivery day in loc.
+func splitByDay(prices []model.PriceHistoryEntry, loc *time.Location) [][]model.PriceHistoryEntry {
+	var days [][]model.PriceHistoryEntry
+	start := 0
+	for i := 1; i <= len(prices); i++ {
+		if i < len(prices) && sameDay(prices[i].DeliveryStart.In(loc), prices[start].DeliveryStart.In(loc)) {
+			continue
+		}
+		if i > start {
+			days = append(days, prices[start:i])
+		}
+		start = i
+	}
+	return days
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// formatCentsPerKwh converts EUR/MWh to c/kWh with two decimals.
+func formatCentsPerKwh(eurPerMwh float64) string {
+	return strconv.FormatFloat(eurPerMwh/10, 'f', 2, 64)
+}
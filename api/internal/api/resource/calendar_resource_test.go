@@ -0,0 +1,80 @@
+package resource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCalendarResource_GetCalendar(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	today := time.Date(2025, 1, 10, 0, 0, 0, 0, helsinki)
+	from := today.AddDate(0, 0, -calendarHistoryDays)
+	to := today.AddDate(0, 0, 2)
+
+	// Today and tomorrow, cheapest 2 hours at 03:00 today and 01:00 tomorrow
+	var entries []model.PriceHistoryEntry
+	for day := range 2 {
+		for hour := range 24 {
+			start := today.AddDate(0, 0, day).Add(time.Duration(hour) * time.Hour)
+			price := 100.0
+			if (day == 0 && (hour == 3 || hour == 4)) || (day == 1 && (hour == 1 || hour == 2)) {
+				price = 10
+			}
+			if day == 1 && hour >= 17 && hour < 19 {
+				price = 250
+			}
+			entries = append(entries, model.PriceHistoryEntry{Price: price, DeliveryStart: start, DeliveryEnd: start.Add(time.Hour)})
+		}
+	}
+
+	mockRepo := new(testutil.MockPriceRepository)
+	mockTime := new(MockTimeProvider)
+	mockRepo.On("GetPrices", mock.Anything, from, to).Return(entries, nil)
+	mockTime.On("Now").Return(now)
+	res := NewCalendarResource(mockRepo, mockTime)
+
+	req := httptest.NewRequest("GET", "/api/calendar.ics?window=2&above=20", nil)
+	rr := httptest.NewRecorder()
+	res.GetCalendar(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", rr.Header().Get("Content-Type"))
+
+	body := rr.Body.String()
+	assert.Equal(t, 3, strings.Count(body, "BEGIN:VEVENT"))
+	assert.Contains(t, body, "UID:cheapest-2h-20250110@ehin.fi\r\n")
+	assert.Contains(t, body, "DTSTART:20250110T010000Z\r\n")
+	assert.Contains(t, body, "UID:cheapest-2h-20250111@ehin.fi\r\n")
+	assert.Contains(t, body, "DTSTART:20250110T230000Z\r\n")
+	assert.Contains(t, body, "SUMMARY:Cheapest 2 h: 1.00 c/kWh\r\n")
+	assert.Contains(t, body, "UID:above-20-20250111T1500Z@ehin.fi\r\n")
+	assert.Contains(t, body, "SUMMARY:Price above 20 c/kWh\r\n")
+
+	// The same data produces the same UIDs on the next fetch
+	rr2 := httptest.NewRecorder()
+	res.GetCalendar(rr2, httptest.NewRequest("GET", "/api/calendar.ics?window=2&above=20", nil))
+	assert.Equal(t, body, rr2.Body.String())
+}
+
+func TestCalendarResource_InvalidParams(t *testing.T) {
+	res := NewCalendarResource(new(testutil.MockPriceRepository), new(MockTimeProvider))
+	for _, url := range []string{
+		"/api/calendar.ics?window=abc",
+		"/api/calendar.ics?window=25",
+		"/api/calendar.ics?window=-1",
+		"/api/calendar.ics?above=high",
+	} {
+		rr := httptest.NewRecorder()
+		res.GetCalendar(rr, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+	}
+}
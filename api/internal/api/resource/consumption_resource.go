@@ -0,0 +1,156 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/datahub"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/service"
+)
+
+// A year of 15 minute readings is about 3 MB.
+const maxConsumptionUploadBytes = 8 << 20
+
+type ConsumptionResource struct {
+	consumptionService *service.ConsumptionService
+}
+
+func NewConsumptionResource(consumptionService *service.ConsumptionService) *ConsumptionResource {
+	return &ConsumptionResource{
+		consumptionService: consumptionService,
+	}
+}
+
+// ConsumptionCostResponse prices are in c/kWh and costs in euros.
+type ConsumptionCostResponse struct {
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	Currency       string    `json:"currency"`
+	Unit           string    `json:"unit"`
+	VATPercent     float64   `json:"vatPercent"`
+	ConsumptionKWh float64   `json:"consumptionKwh"`
+	Cost           float64   `json:"cost"`
+	// What the consumption cost per kWh on average
+	AveragePaid float64 `json:"averagePaid"`
+	// Average spot price over the period, for comparison
+	AverageSpot float64 `json:"averageSpot"`
+	// Consumption without a stored price, not included in cost
+	UnpricedKWh float64              `json:"unpricedKwh"`
+	Days        []ConsumptionCostDay `json:"days"`
+}
+
+type ConsumptionCostDay struct {
+	Date           string  `json:"date"`
+	ConsumptionKWh float64 `json:"consumptionKwh"`
+	Cost           float64 `json:"cost"`
+	AveragePaid    float64 `json:"averagePaid"`
+	AverageSpot    float64 `json:"averageSpot"`
+	UnpricedKWh    float64 `json:"unpricedKwh"`
+}
+
+// CalculateCost handles POST /api/consumption/cost?vat=25.5. The body is a Fingrid
+// Datahub consumption CSV, either as is or in the file field of a multipart
+// form. The spot cost of the consumption is returned with daily breakdowns.
+func (res *ConsumptionResource) CalculateCost(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	vatPercent, err := parseVATPercent(r.URL.Query().Get("vat"))
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	if res.consumptionService == nil {
+		logger.Warn("Consumption service not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxConsumptionUploadBytes)
+	var body io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			if tooLarge(err) {
+				fileTooLarge(w, r)
+				return
+			}
+			problem.BadRequest(w, r, "Missing file field")
+			return
+		}
+		defer func() { _ = file.Close() }()
+		body = file
+	}
+
+	readings, err := datahub.Parse(body, loadHelsinki())
+	if err != nil {
+		if tooLarge(err) {
+			fileTooLarge(w, r)
+			return
+		}
+		problem.BadRequest(w, r, "Invalid Datahub CSV: "+err.Error())
+		return
+	}
+
+	cost, err := res.consumptionService.Cost(r.Context(), readings, vatPercent)
+	switch {
+	case errors.Is(err, service.ErrNoConsumption):
+		problem.BadRequest(w, r, "No consumption rows in the file")
+		return
+	case errors.Is(err, service.ErrConsumptionPeriod):
+		problem.BadRequest(w, r, "Consumption period too long. Upload at most a year at a time")
+		return
+	case err != nil:
+		logger.Error("Error calculating consumption cost", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	resp := ConsumptionCostResponse{
+		From:           cost.From,
+		To:             cost.To,
+		Currency:       "EUR",
+		Unit:           "c/kWh",
+		VATPercent:     vatPercent,
+		ConsumptionKWh: round(cost.ConsumptionKWh, 3),
+		Cost:           round(cost.Cost, 2),
+		AveragePaid:    round(cost.AveragePaid, 3),
+		AverageSpot:    round(cost.AverageSpot, 3),
+		UnpricedKWh:    round(cost.UnpricedKWh, 3),
+		Days:           make([]ConsumptionCostDay, len(cost.Days)),
+	}
+	for i, d := range cost.Days {
+		resp.Days[i] = ConsumptionCostDay{
+			Date:           d.Date.Format("2006-01-02"),
+			ConsumptionKWh: round(d.ConsumptionKWh, 3),
+			Cost:           round(d.Cost, 2),
+			AveragePaid:    round(d.AveragePaid, 3),
+			AverageSpot:    round(d.AverageSpot, 3),
+			UnpricedKWh:    round(d.UnpricedKWh, 3),
+		}
+	}
+
+	// The upload is private to the user
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func fileTooLarge(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("File too large. At most %d MB can be uploaded", maxConsumptionUploadBytes>>20))
+}
+
+func tooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,116 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/service"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Two hours of 15 minute consumption, 1 kWh each, starting 2025-03-10 00:00 Helsinki time
+const consumptionCSV = "MeteringPointGSRN;Resolution;Unit Type;Start Time;Quantity;Quality\n" +
+	"643007574000000000;PT15M;kWh;2025-03-09T22:00:00Z;1,0;OK\n" +
+	"643007574000000000;PT15M;kWh;2025-03-09T22:15:00Z;1,0;OK\n" +
+	"643007574000000000;PT15M;kWh;2025-03-09T22:30:00Z;1,0;OK\n" +
+	"643007574000000000;PT15M;kWh;2025-03-09T22:45:00Z;1,0;OK\n" +
+	"643007574000000000;PT15M;kWh;2025-03-09T23:00:00Z;2,0;OK\n" +
+	"643007574000000000;PT15M;kWh;2025-03-09T23:15:00Z;2,0;OK\n" +
+	"643007574000000000;PT15M;kWh;2025-03-09T23:30:00Z;2,0;OK\n" +
+	"643007574000000000;PT15M;kWh;2025-03-09T23:45:00Z;2,0;OK\n"
+
+func newTestConsumptionResource() *ConsumptionResource {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, helsinki)
+	mockRepo := new(testutil.MockPriceRepository)
+	// 100 EUR/MWh for the first hour, 50 for the second
+	prices := quarterHourEntries(day, 8, func(i int) float64 { return float64(100 - 50*(i/4)) })
+	mockRepo.On("GetPrices", mock.Anything, mock.Anything, mock.Anything).Return(prices, nil)
+	return NewConsumptionResource(service.NewConsumptionService(mockRepo))
+}
+
+func TestConsumptionResource_CalculateCost(t *testing.T) {
+	res := newTestConsumptionResource()
+
+	check := func(t *testing.T, rr *httptest.ResponseRecorder) {
+		t.Helper()
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+		var body ConsumptionCostResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+		assert.Equal(t, "c/kWh", body.Unit)
+		assert.Equal(t, 25.5, body.VATPercent)
+		assert.Equal(t, 12.0, body.ConsumptionKWh)
+		// 4 kWh at 10 c/kWh and 8 kWh at 5 c/kWh, plus VAT
+		assert.Equal(t, 1.00, body.Cost)
+		assert.Equal(t, 8.367, body.AveragePaid)
+		assert.Equal(t, 9.413, body.AverageSpot)
+		require.Len(t, body.Days, 1)
+		assert.Equal(t, "2025-03-10", body.Days[0].Date)
+		assert.Equal(t, 1.00, body.Days[0].Cost)
+	}
+
+	t.Run("Raw body", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/consumption/cost?vat=25.5", strings.NewReader(consumptionCSV))
+		req.Header.Set("Content-Type", "text/csv")
+		res.CalculateCost(rr, req)
+		check(t, rr)
+	})
+
+	t.Run("Multipart form", func(t *testing.T) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		fw, _ := mw.CreateFormFile("file", "consumption.csv")
+		_, _ = fw.Write([]byte(consumptionCSV))
+		_ = mw.Close()
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/consumption/cost?vat=25.5", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		res.CalculateCost(rr, req)
+		check(t, rr)
+	})
+}
+
+func TestConsumptionResource_CalculateCost_Errors(t *testing.T) {
+	res := newTestConsumptionResource()
+
+	for _, tc := range []struct {
+		name   string
+		url    string
+		body   string
+		status int
+		detail string
+	}{
+		{"Invalid VAT", "/api/consumption/cost?vat=lots", consumptionCSV, http.StatusBadRequest, `invalid vat "lots". Use a percentage, e.g. 25.5`},
+		{"Not a Datahub file", "/api/consumption/cost", "date,price\n", http.StatusBadRequest, "Invalid Datahub CSV: no start time column"},
+		{"No rows", "/api/consumption/cost", "Start Time;Quantity\n", http.StatusBadRequest, "No consumption rows in the file"},
+		{"Too large", "/api/consumption/cost", "Start Time;Quantity\n" + strings.Repeat("2025-03-09T22:00:00Z;1,0\n", 400_000), http.StatusRequestEntityTooLarge, "File too large. At most 8 MB can be uploaded"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			res.CalculateCost(rr, httptest.NewRequest("POST", tc.url, strings.NewReader(tc.body)))
+
+			assert.Equal(t, tc.status, rr.Code)
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+			var details problem.Details
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&details))
+			assert.Equal(t, tc.detail, details.Detail)
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	NewConsumptionResource(nil).CalculateCost(rr, httptest.NewRequest("POST", "/api/consumption/cost", strings.NewReader(consumptionCSV)))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
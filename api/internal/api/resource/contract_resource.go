@@ -0,0 +1,345 @@
+package resource
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/datahub"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/profiles"
+	"github.com/samlof/ehin/internal/service"
+)
+
+const maxContracts = 10
+
+type ContractResource struct {
+	comparisonService *service.ComparisonService
+	dateService       service.TimeProvider
+}
+
+func NewContractResource(comparisonService *service.ComparisonService, dateService service.TimeProvider) *ContractResource {
+	return &ContractResource{
+		comparisonService: comparisonService,
+		dateService:       dateService,
+	}
+}
+
+// ContractComparisonRequest is the JSON body of a comparison on a standard
+// consumption profile. From and to are inclusive YYYY-MM-DD dates and default
+// to the last 12 full months.
+type ContractComparisonRequest struct {
+	Profile   string            `json:"profile"`
+	AnnualKWh float64           `json:"annualKwh"`
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Contracts []ContractRequest `json:"contracts"`
+}
+
+// ContractRequest prices are in c/kWh and fees in euros per month.
+type ContractRequest struct {
+	Name string `json:"name"`
+	// fixed or spot
+	Type string `json:"type"`
+	// Energy price of a fixed contract, or margin on top of the spot price
+	Price      float64 `json:"price"`
+	MonthlyFee float64 `json:"monthlyFee"`
+}
+
+// ContractComparisonResponse prices are in c/kWh and costs in euros.
+type ContractComparisonResponse struct {
+	From           time.Time         `json:"from"`
+	To             time.Time         `json:"to"`
+	Currency       string            `json:"currency"`
+	Unit           string            `json:"unit"`
+	VATPercent     float64           `json:"vatPercent"`
+	Profile        string            `json:"profile,omitempty"`
+	ConsumptionKWh float64           `json:"consumptionKwh"`
+	UnpricedKWh    float64           `json:"unpricedKwh"`
+	Contracts      []ContractRequest `json:"contracts"`
+	// Totals over the period in the order of contracts
+	Totals []ContractCostResponse    `json:"totals"`
+	Months []ContractComparisonMonth `json:"months"`
+}
+
+type ContractComparisonMonth struct {
+	// YYYY-MM
+	Month          string                 `json:"month"`
+	ConsumptionKWh float64                `json:"consumptionKwh"`
+	UnpricedKWh    float64                `json:"unpricedKwh"`
+	Costs          []ContractCostResponse `json:"costs"`
+}
+
+type ContractCostResponse struct {
+	Energy       float64 `json:"energy"`
+	Fees         float64 `json:"fees"`
+	Total        float64 `json:"total"`
+	AveragePrice float64 `json:"averagePrice"`
+}
+
+// Compare handles POST /api/contracts/compare?vat=25.5. The consumption is
+// either a standard profile named in a JSON ContractComparisonRequest, or a
+// Fingrid Datahub CSV in the file field of a multipart form with the
+// contracts as a JSON array in its contracts field. The monthly breakdown is
+// returned as JSON, or as CSV with format=csv or Accept: text/csv.
+func (res *ContractResource) Compare(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	query := r.URL.Query()
+	helsinki := loadHelsinki()
+	vatPercent, err := parseVATPercent(query.Get("vat"))
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	format, ok := negotiateFormat(r, mediaTypeJSON, mediaTypeCSV)
+	if !ok {
+		problem.BadRequest(w, r, "Invalid format. Use json or csv")
+		return
+	}
+	var csvOpts csvOptions
+	if format == mediaTypeCSV {
+		csvOpts, err = parseCSVOptions(query, helsinki)
+		if err != nil {
+			problem.BadRequest(w, r, err.Error())
+			return
+		}
+	}
+
+	if res.comparisonService == nil {
+		logger.Warn("Comparison service not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxConsumptionUploadBytes)
+	var req ContractComparisonRequest
+	var readings []datahub.Reading
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		readings, req.Contracts, err = readConsumptionUpload(r, helsinki)
+	} else {
+		req, readings, err = res.readProfileRequest(r, helsinki)
+	}
+	if err != nil {
+		var reqErr requestError
+		switch {
+		case tooLarge(err):
+			fileTooLarge(w, r)
+		case errors.As(err, &reqErr):
+			problem.BadRequest(w, r, reqErr.Error())
+		default:
+			logger.Error("Error reading comparison request", "error", err)
+			problem.Internal(w, r)
+		}
+		return
+	}
+
+	contracts, err := parseContracts(req.Contracts)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	comparison, err := res.comparisonService.Compare(r.Context(), readings, contracts, vatPercent)
+	switch {
+	case errors.Is(err, service.ErrNoConsumption):
+		problem.BadRequest(w, r, "No consumption to compare")
+		return
+	case errors.Is(err, service.ErrConsumptionPeriod):
+		problem.BadRequest(w, r, "Consumption period too long. Compare at most a year at a time")
+		return
+	case err != nil:
+		logger.Error("Error comparing contracts", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	// The consumption is private to the user
+	w.Header().Set("Cache-Control", "no-store")
+	if format == mediaTypeCSV {
+		setCSVHeaders(w, "contracts.csv")
+		if err := writeComparisonCSV(w, comparison, csvOpts); err != nil {
+			logger.Error("Error writing comparison CSV", "error", err)
+		}
+		return
+	}
+
+	resp := ContractComparisonResponse{
+		From:           comparison.From,
+		To:             comparison.To,
+		Currency:       "EUR",
+		Unit:           "c/kWh",
+		VATPercent:     vatPercent,
+		Profile:        req.Profile,
+		ConsumptionKWh: round(comparison.ConsumptionKWh, 3),
+		UnpricedKWh:    round(comparison.UnpricedKWh, 3),
+		Contracts:      make([]ContractRequest, len(contracts)),
+		Totals:         contractCostResponses(comparison.Totals),
+		Months:         make([]ContractComparisonMonth, len(comparison.Months)),
+	}
+	for i, c := range contracts {
+		resp.Contracts[i] = ContractRequest{Name: c.Name, Type: string(c.Type), Price: c.Price, MonthlyFee: c.MonthlyFee}
+	}
+	for i, m := range comparison.Months {
+		resp.Months[i] = ContractComparisonMonth{
+			Month:          m.Month.Format("2006-01"),
+			ConsumptionKWh: round(m.ConsumptionKWh, 3),
+			UnpricedKWh:    round(m.UnpricedKWh, 3),
+			Costs:          contractCostResponses(m.Costs),
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// readProfileRequest reads a JSON request and the readings of its standard profile.
+func (res *ContractResource) readProfileRequest(r *http.Request, loc *time.Location) (ContractComparisonRequest, []datahub.Reading, error) {
+	var req ContractComparisonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if tooLarge(err) {
+			return req, nil, err
+		}
+		return req, nil, requestError("Invalid JSON body")
+	}
+	if req.Profile == "" {
+		return req, nil, requestError("Missing profile. Use a standard profile or upload a Datahub CSV")
+	}
+	if req.AnnualKWh < 0 || req.AnnualKWh > 1_000_000 {
+		return req, nil, requestError("Invalid annualKwh. Use at most 1000000 kWh")
+	}
+
+	var from, to time.Time
+	switch {
+	case req.From == "" && req.To == "":
+		now := res.dateService.Now().In(loc)
+		to = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		from = to.AddDate(-1, 0, 0)
+	default:
+		var err error
+		from, to, err = parseDateRange(req.From, req.To, loc)
+		if err != nil {
+			return req, nil, err
+		}
+	}
+
+	profile, ok := profiles.Get(req.Profile)
+	if !ok {
+		names := make([]string, 0, len(profiles.All()))
+		for _, p := range profiles.All() {
+			names = append(names, p.Name)
+		}
+		return req, nil, requestError(fmt.Sprintf("Unknown profile %q. Use one of %s", req.Profile, strings.Join(names, ", ")))
+	}
+	readings, err := service.ProfileReadings(profile, req.AnnualKWh, from, to)
+	return req, readings, err
+}
+
+// readConsumptionUpload reads the Datahub CSV and contracts of a multipart form.
+func readConsumptionUpload(r *http.Request, loc *time.Location) ([]datahub.Reading, []ContractRequest, error) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		if tooLarge(err) {
+			return nil, nil, err
+		}
+		return nil, nil, requestError("Missing file field")
+	}
+	defer func() { _ = file.Close() }()
+
+	var contracts []ContractRequest
+	if err := json.Unmarshal([]byte(r.FormValue("contracts")), &contracts); err != nil {
+		return nil, nil, requestError("Invalid contracts field. Use a JSON array of contracts")
+	}
+	readings, err := datahub.Parse(file, loc)
+	if err != nil {
+		if tooLarge(err) {
+			return nil, nil, err
+		}
+		return nil, nil, requestError("Invalid Datahub CSV: " + err.Error())
+	}
+	return readings, contracts, nil
+}
+
+func parseContracts(reqs []ContractRequest) ([]service.Contract, error) {
+	if len(reqs) == 0 || len(reqs) > maxContracts {
+		return nil, fmt.Errorf("invalid contracts. Compare 1 to %d contracts", maxContracts)
+	}
+	contracts := make([]service.Contract, len(reqs))
+	for i, c := range reqs {
+		name := strings.TrimSpace(c.Name)
+		if name == "" {
+			name = fmt.Sprintf("Contract %d", i+1)
+		}
+		typ := service.ContractType(strings.ToLower(c.Type))
+		if typ != service.ContractFixed && typ != service.ContractSpot {
+			return nil, fmt.Errorf("invalid type %q of contract %q. Use fixed or spot", c.Type, name)
+		}
+		if c.Price < -100 || c.Price > 1000 {
+			return nil, fmt.Errorf("invalid price of contract %q. Use c/kWh", name)
+		}
+		if c.MonthlyFee < 0 || c.MonthlyFee > 1000 {
+			return nil, fmt.Errorf("invalid monthlyFee of contract %q. Use euros per month", name)
+		}
+		contracts[i] = service.Contract{Name: name, Type: typ, Price: c.Price, MonthlyFee: c.MonthlyFee}
+	}
+	return contracts, nil
+}
+
+func contractCostResponses(costs []service.ContractCost) []ContractCostResponse {
+	resp := make([]ContractCostResponse, len(costs))
+	for i, c := range costs {
+		resp[i] = ContractCostResponse{
+			Energy:       round(c.Energy, 2),
+			Fees:         round(c.Fees, 2),
+			Total:        round(c.Total, 2),
+			AveragePrice: round(c.AveragePrice, 3),
+		}
+	}
+	return resp
+}
+
+// writeComparisonCSV writes a row per month and contract, followed by the
+// totals of each contract with total as the month.
+func writeComparisonCSV(w io.Writer, c *service.ContractComparison, opts csvOptions) error {
+	cw := csv.NewWriter(w)
+	if opts.decimalComma {
+		cw.Comma = ';'
+	}
+	format := func(v float64, decimals int) string {
+		s := strconv.FormatFloat(v, 'f', decimals, 64)
+		if opts.decimalComma {
+			s = strings.Replace(s, ".", ",", 1)
+		}
+		return s
+	}
+	row := func(month string, consumption, unpriced float64, contract service.Contract, cost service.ContractCost) []string {
+		return []string{
+			month, contract.Name, string(contract.Type),
+			format(consumption, 3), format(unpriced, 3),
+			format(cost.Energy, 2), format(cost.Fees, 2), format(cost.Total, 2), format(cost.AveragePrice, 3),
+		}
+	}
+
+	if err := cw.Write([]string{"month", "contract", "type", "consumption_kwh", "unpriced_kwh", "energy_eur", "fees_eur", "total_eur", "average_c_kwh"}); err != nil {
+		return err
+	}
+	for _, m := range c.Months {
+		for i, contract := range c.Contracts {
+			if err := cw.Write(row(m.Month.Format("2006-01"), m.ConsumptionKWh, m.UnpricedKWh, contract, m.Costs[i])); err != nil {
+				return err
+			}
+		}
+	}
+	for i, contract := range c.Contracts {
+		if err := cw.Write(row("total", c.ConsumptionKWh, c.UnpricedKWh, contract, c.Totals[i])); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
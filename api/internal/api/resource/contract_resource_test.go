@@ -0,0 +1,154 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/service"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testContracts = `[{"name":"Fixed","type":"fixed","price":8,"monthlyFee":31},{"name":"Spot","type":"spot","price":0.5}]`
+
+func newTestContractResource() *ContractResource {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, helsinki)
+	mockRepo := new(testutil.MockPriceRepository)
+	// 100 EUR/MWh for the first hour, 50 for the second
+	prices := quarterHourEntries(day, 8, func(i int) float64 { return float64(100 - 50*(i/4)) })
+	mockRepo.On("GetPrices", mock.Anything, mock.Anything, mock.Anything).Return(prices, nil)
+	mockTime := new(MockTimeProvider)
+	mockTime.On("Now").Return(time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC))
+	return NewContractResource(service.NewComparisonService(mockRepo), mockTime)
+}
+
+func consumptionUpload(t *testing.T, contracts string) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", "consumption.csv")
+	require.NoError(t, err)
+	_, _ = fw.Write([]byte(consumptionCSV))
+	require.NoError(t, mw.WriteField("contracts", contracts))
+	require.NoError(t, mw.Close())
+	return &buf, mw.FormDataContentType()
+}
+
+func TestContractResource_Compare_Upload(t *testing.T) {
+	res := newTestContractResource()
+	body, contentType := consumptionUpload(t, testContracts)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/contracts/compare", body)
+	req.Header.Set("Content-Type", contentType)
+	res.Compare(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	var resp ContractComparisonResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, 12.0, resp.ConsumptionKWh)
+	require.Len(t, resp.Contracts, 2)
+	assert.Equal(t, "Fixed", resp.Contracts[0].Name)
+	require.Len(t, resp.Totals, 2)
+	// 12 kWh at 8 c/kWh and two hours of a 31 EUR monthly fee
+	assert.Equal(t, ContractCostResponse{Energy: 0.96, Fees: 0.08, Total: 1.04, AveragePrice: 8.695}, resp.Totals[0])
+	// 4 kWh at 10.5 c/kWh and 8 kWh at 5.5 c/kWh
+	assert.Equal(t, ContractCostResponse{Energy: 0.86, Fees: 0, Total: 0.86, AveragePrice: 7.167}, resp.Totals[1])
+	require.Len(t, resp.Months, 1)
+	assert.Equal(t, "2025-03", resp.Months[0].Month)
+}
+
+func TestContractResource_Compare_CSV(t *testing.T) {
+	res := newTestContractResource()
+	body, contentType := consumptionUpload(t, testContracts)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/contracts/compare?format=csv&decimal=comma", body)
+	req.Header.Set("Content-Type", contentType)
+	res.Compare(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="contracts.csv"`, rr.Header().Get("Content-Disposition"))
+	assert.Equal(t, "month;contract;type;consumption_kwh;unpriced_kwh;energy_eur;fees_eur;total_eur;average_c_kwh\n"+
+		"2025-03;Fixed;fixed;12,000;0,000;0,96;0,08;1,04;8,695\n"+
+		"2025-03;Spot;spot;12,000;0,000;0,86;0,00;0,86;7,167\n"+
+		"total;Fixed;fixed;12,000;0,000;0,96;0,08;1,04;8,695\n"+
+		"total;Spot;spot;12,000;0,000;0,86;0,00;0,86;7,167\n", rr.Body.String())
+}
+
+func TestContractResource_Compare_Profile(t *testing.T) {
+	res := newTestContractResource()
+
+	rr := httptest.NewRecorder()
+	body := `{"profile":"detached-house-electric-heating","contracts":` + testContracts + `}`
+	res.Compare(rr, httptest.NewRequest("POST", "/api/contracts/compare", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp ContractComparisonResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, "detached-house-electric-heating", resp.Profile)
+	// The last 12 full months
+	require.Len(t, resp.Months, 12)
+	assert.Equal(t, "2024-06", resp.Months[0].Month)
+	assert.Equal(t, "2025-05", resp.Months[11].Month)
+	assert.InDelta(t, 18000, resp.ConsumptionKWh, 20)
+	// A full year of fees
+	assert.Equal(t, 372.0, resp.Totals[0].Fees)
+}
+
+func TestContractResource_Compare_Errors(t *testing.T) {
+	res := newTestContractResource()
+
+	for _, tc := range []struct {
+		name   string
+		url    string
+		body   string
+		detail string
+	}{
+		{"Invalid VAT", "/api/contracts/compare?vat=lots", `{}`, `invalid vat "lots". Use a percentage, e.g. 25.5`},
+		{"Invalid format", "/api/contracts/compare?format=xml", `{}`, "Invalid format. Use json or csv"},
+		{"Invalid JSON", "/api/contracts/compare", `{`, "Invalid JSON body"},
+		{"No profile", "/api/contracts/compare", `{"contracts":[]}`, "Missing profile. Use a standard profile or upload a Datahub CSV"},
+		{"Unknown profile", "/api/contracts/compare", `{"profile":"castle"}`, `Unknown profile "castle". Use one of apartment, detached-house, detached-house-electric-heating, ev-owner`},
+		{"Invalid range", "/api/contracts/compare", `{"profile":"apartment","from":"2025-02-01"}`, "Invalid to date format. Use YYYY-MM-DD"},
+		{"No contracts", "/api/contracts/compare", `{"profile":"apartment"}`, "invalid contracts. Compare 1 to 10 contracts"},
+		{"Invalid type", "/api/contracts/compare", `{"profile":"apartment","contracts":[{"name":"A","type":"hourly"}]}`, `invalid type "hourly" of contract "A". Use fixed or spot`},
+		{"Negative fee", "/api/contracts/compare", `{"profile":"apartment","contracts":[{"type":"fixed","monthlyFee":-1}]}`, `invalid monthlyFee of contract "Contract 1". Use euros per month`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			res.Compare(rr, httptest.NewRequest("POST", tc.url, strings.NewReader(tc.body)))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+			var details problem.Details
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&details))
+			assert.Equal(t, tc.detail, details.Detail)
+		})
+	}
+
+	t.Run("Invalid contracts field", func(t *testing.T) {
+		body, contentType := consumptionUpload(t, "fixed 8")
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/contracts/compare", body)
+		req.Header.Set("Content-Type", contentType)
+		res.Compare(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	rr := httptest.NewRecorder()
+	NewContractResource(nil, nil).Compare(rr, httptest.NewRequest("POST", "/api/contracts/compare", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
@@ -0,0 +1,119 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/events"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/utils"
+)
+
+const (
+	sseHeartbeatInterval = 30 * time.Second
+	// Reconnection delay suggested to clients, in milliseconds.
+	sseRetryMillis = 5000
+)
+
+// EventsResource streams price events to browsers as Server-Sent Events.
+type EventsResource struct {
+	broker            *events.Broker
+	heartbeatInterval time.Duration
+
+	shutdownOnce sync.Once
+	shutdown     chan struct{}
+}
+
+func NewEventsResource(broker *events.Broker) *EventsResource {
+	return &EventsResource{
+		broker:            broker,
+		heartbeatInterval: sseHeartbeatInterval,
+		shutdown:          make(chan struct{}),
+	}
+}
+
+// Shutdown ends all streams. It is meant to be registered with
+// http.Server.RegisterOnShutdown, which otherwise waits for them forever.
+// Clients reconnect to another instance and resume with Last-Event-ID.
+func (res *EventsResource) Shutdown() {
+	res.shutdownOnce.Do(func() { close(res.shutdown) })
+}
+
+// StreamEvents handles GET /api/events.
+// Clients resuming with a Last-Event-ID header get the events they missed.
+func (res *EventsResource) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	rc := http.NewResponseController(w)
+
+	lastEventID, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	resume := err == nil
+
+	sub, backlog, err := res.broker.Subscribe(lastEventID, resume)
+	if errors.Is(err, events.ErrTooManySubscribers) {
+		w.Header().Set("Retry-After", "60")
+		problem.Unavailable(w, r, "Too many connections")
+		return
+	}
+	defer res.broker.Unsubscribe(sub)
+
+	// Streams outlive the server's write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logger.Warn("Unable to clear write deadline of event stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set(utils.CACHE_CONTROL_HEADER, "no-store")
+	// Disables response buffering in nginx style proxies
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis); err != nil {
+		return
+	}
+	for _, event := range backlog {
+		if err := writeSSE(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		logger.Error("Streaming not supported", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(res.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-res.shutdown:
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped by the broker for being too slow, the client resumes after reconnecting
+				return
+			}
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event events.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
@@ -0,0 +1,113 @@
+package resource
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+// readSSEBlock reads lines until the blank line ending an event or comment.
+func readSSEBlock(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return strings.Join(lines, "\n")
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEventsResource_StreamEvents(t *testing.T) {
+	broker := events.NewBroker(nil, nil, 10)
+	broker.Publish("FI", events.TypeDay, events.DayData{Area: "FI", Date: "2025-01-01", PriceCount: 96})
+	broker.Publish("FI", events.TypeDay, events.DayData{Area: "FI", Date: "2025-01-02", PriceCount: 96})
+
+	res := NewEventsResource(broker)
+	res.heartbeatInterval = 20 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(res.StreamEvents))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	r := bufio.NewReader(resp.Body)
+	assert.Equal(t, "retry: 5000", readSSEBlock(t, r))
+	// Only the event after Last-Event-ID is replayed
+	assert.Equal(t, "id: 2\nevent: day\ndata: {\"area\":\"FI\",\"date\":\"2025-01-02\",\"priceCount\":96}", readSSEBlock(t, r))
+
+	assert.Equal(t, ": heartbeat", readSSEBlock(t, r))
+
+	broker.Publish("FI", events.TypeDay, events.DayData{Area: "FI", Date: "2025-01-03", PriceCount: 96})
+	block := readSSEBlock(t, r)
+	for block == ": heartbeat" {
+		block = readSSEBlock(t, r)
+	}
+	assert.Equal(t, "id: 3\nevent: day\ndata: {\"area\":\"FI\",\"date\":\"2025-01-03\",\"priceCount\":96}", block)
+}
+
+func TestEventsResource_ConnectionLimit(t *testing.T) {
+	broker := events.NewBroker(nil, nil, 1)
+	_, _, err := broker.Subscribe(0, false)
+	assert.NoError(t, err)
+
+	res := NewEventsResource(broker)
+	rr := httptest.NewRecorder()
+	res.StreamEvents(rr, httptest.NewRequest("GET", "/api/events", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+}
+
+func TestEventsResource_Shutdown(t *testing.T) {
+	broker := events.NewBroker(nil, nil, 10)
+	res := NewEventsResource(broker)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(res.StreamEvents))
+	// Streams must not be cut by the write timeout
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Config.RegisterOnShutdown(res.Shutdown)
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	r := bufio.NewReader(resp.Body)
+	assert.Equal(t, "retry: 5000", readSSEBlock(t, r))
+
+	time.Sleep(100 * time.Millisecond)
+	broker.Publish("FI", events.TypeDay, events.DayData{Area: "FI", Date: "2025-01-02", PriceCount: 96})
+	assert.Equal(t, "id: 1\nevent: day\ndata: {\"area\":\"FI\",\"date\":\"2025-01-02\",\"priceCount\":96}", readSSEBlock(t, r))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, server.Config.Shutdown(ctx))
+
+	_, err = r.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 0, broker.Subscribers())
+}
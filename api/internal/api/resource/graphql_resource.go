@@ -0,0 +1,62 @@
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/gql"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/utils"
+)
+
+type GraphQLResource struct {
+	executor *gql.Executor
+}
+
+func NewGraphQLResource(executor *gql.Executor) *GraphQLResource {
+	return &GraphQLResource{
+		executor: executor,
+	}
+}
+
+// Query handles GET and POST /api/graphql. POST takes the request as a JSON
+// body. GET takes query and operationName as parameters, and variables and
+// extensions as JSON encoded parameters, which lets persisted queries be
+// cached by CDNs. Errors in the query are reported in the GraphQL response
+// with status 200, malformed HTTP requests get problem details.
+func (res *GraphQLResource) Query(w http.ResponseWriter, r *http.Request) {
+	var req gql.Request
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				problem.BadRequest(w, r, "Invalid variables. Use a JSON object")
+				return
+			}
+		}
+		if v := query.Get("extensions"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Extensions); err != nil {
+				problem.BadRequest(w, r, "Invalid extensions. Use a JSON object")
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		problem.BadRequest(w, r, "Invalid JSON body")
+		return
+	}
+
+	result := res.executor.Execute(r.Context(), req)
+
+	if r.Method == http.MethodGet && !result.HasErrors() {
+		w.Header().Set(utils.CACHE_CONTROL_HEADER, utils.CACHE_VAR+", max-age=60")
+	} else {
+		w.Header().Set(utils.CACHE_CONTROL_HEADER, "no-store")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding GraphQL result", "error", err)
+	}
+}
@@ -0,0 +1,119 @@
+package resource
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/gql"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/samlof/ehin/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type graphQLResponse struct {
+	Data struct {
+		Area *struct {
+			Name       string
+			DailyStats []struct {
+				Date    string
+				Average float64
+			}
+		}
+	}
+	Errors []struct {
+		Message    string
+		Extensions map[string]string
+	}
+}
+
+func newTestGraphQLResource(t *testing.T) *GraphQLResource {
+	t.Helper()
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, helsinki)
+	mockRepo := new(testutil.MockPriceRepository)
+	mockTime := new(MockTimeProvider)
+	mockRepo.On("GetPrices", mock.Anything, day, day.AddDate(0, 0, 1)).Return(quarterHourEntries(day, 96, func(i int) float64 { return 20 }), nil)
+	mockTime.On("Now").Return(day.Add(12 * time.Hour))
+
+	cfg := &config.Config{GraphQLMaxDepth: 8, GraphQLMaxComplexity: 50000, GraphQLPersistedQueries: true}
+	executor, err := gql.NewExecutor(cfg, mockRepo, mockTime)
+	require.NoError(t, err)
+	return NewGraphQLResource(executor)
+}
+
+const statsQuery = `query Stats($date: String!) { area(name: "FI") { name dailyStats(from: $date, to: $date) { date average } } }`
+
+func TestGraphQLResource_Query(t *testing.T) {
+	res := newTestGraphQLResource(t)
+
+	t.Run("POST", func(t *testing.T) {
+		body, _ := json.Marshal(gql.Request{Query: statsQuery, OperationName: "Stats", Variables: map[string]any{"date": "2025-03-10"}})
+		rr := httptest.NewRecorder()
+		res.Query(rr, httptest.NewRequest("POST", "/api/graphql", bytes.NewReader(body)))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "no-store", rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+		var resp graphQLResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.Empty(t, resp.Errors)
+		require.NotNil(t, resp.Data.Area)
+		assert.Equal(t, "FI", resp.Data.Area.Name)
+		require.Len(t, resp.Data.Area.DailyStats, 1)
+		assert.Equal(t, 20.0, resp.Data.Area.DailyStats[0].Average)
+	})
+
+	t.Run("GET with a persisted query", func(t *testing.T) {
+		sum := sha256.Sum256([]byte(statsQuery))
+		extensions := `{"persistedQuery": {"version": 1, "sha256Hash": "` + hex.EncodeToString(sum[:]) + `"}}`
+		params := url.Values{"variables": {`{"date": "2025-03-10"}`}, "extensions": {extensions}}
+
+		rr := httptest.NewRecorder()
+		res.Query(rr, httptest.NewRequest("GET", "/api/graphql?"+params.Encode(), nil))
+		var resp graphQLResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, gql.CodePersistedQueryNotFound, resp.Errors[0].Extensions["code"])
+		assert.Equal(t, "no-store", rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+
+		// The client retries with the query, registering it
+		params.Set("query", statsQuery)
+		rr = httptest.NewRecorder()
+		res.Query(rr, httptest.NewRequest("GET", "/api/graphql?"+params.Encode(), nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		params.Del("query")
+		rr = httptest.NewRecorder()
+		res.Query(rr, httptest.NewRequest("GET", "/api/graphql?"+params.Encode(), nil))
+		resp = graphQLResponse{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.Empty(t, resp.Errors)
+		require.NotNil(t, resp.Data.Area)
+		assert.Equal(t, utils.CACHE_VAR+", max-age=60", rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		for _, r := range []*http.Request{
+			httptest.NewRequest("POST", "/api/graphql", strings.NewReader("query { areas { name } }")),
+			httptest.NewRequest("GET", "/api/graphql?query=%7B%20areas%20%7B%20name%20%7D%20%7D&variables=%5B%5D", nil),
+			httptest.NewRequest("GET", "/api/graphql?extensions=nope", nil),
+		} {
+			rr := httptest.NewRecorder()
+			res.Query(rr, r)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, r.URL.String())
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/service"
+)
+
+// How long readiness and status checks wait for the database.
+const healthCheckTimeout = 2 * time.Second
+
+type HealthResource struct {
+	priceRepository     repository.PriceRepository
+	migrationRepository repository.MigrationRepository
+	timeProvider        service.TimeProvider
+	// Schema version this build needs
+	migrationVersion int64
+	version          string
+	started          time.Time
+}
+
+func NewHealthResource(
+	priceRepository repository.PriceRepository,
+	migrationRepository repository.MigrationRepository,
+	timeProvider service.TimeProvider,
+	migrationVersion int64,
+	version string,
+) *HealthResource {
+	return &HealthResource{
+		priceRepository:     priceRepository,
+		migrationRepository: migrationRepository,
+		timeProvider:        timeProvider,
+		migrationVersion:    migrationVersion,
+		version:             version,
+		started:             timeProvider.Now(),
+	}
+}
+
+// Healthz handles GET /healthz. It only tells that the process is serving requests.
+func (res *HealthResource) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = fmt.Fprint(w, "ok")
+}
+
+// Readyz handles GET /readyz. The instance is ready when the database answers
+// and its schema is at least at the version this build expects. A newer schema
+// is fine, as migrations run before the new version is deployed.
+func (res *HealthResource) Readyz(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	w.Header().Set("Cache-Control", "no-store")
+	if res.priceRepository == nil || res.migrationRepository == nil {
+		problem.Unavailable(w, r, "Database not configured")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	if err := res.priceRepository.Select1(ctx); err != nil {
+		logger.Error("Readiness check failed to reach database", "error", err)
+		problem.Unavailable(w, r, "Database unavailable")
+		return
+	}
+	version, err := res.migrationRepository.GetVersion(ctx)
+	if err != nil {
+		logger.Error("Readiness check failed to read migration version", "error", err)
+		problem.Unavailable(w, r, "Migration version unavailable")
+		return
+	}
+	if version < res.migrationVersion {
+		problem.Unavailable(w, r, fmt.Sprintf("Database at migration %d, expected %d", version, res.migrationVersion))
+		return
+	}
+
+	_, _ = fmt.Fprint(w, "ok")
+}
+
+type StatusSlot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type StatusResponse struct {
+	Version       string `json:"version"`
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+	// Nil when no prices are stored
+	LatestSlot     *StatusSlot `json:"latestSlot"`
+	TomorrowPrices int         `json:"tomorrowPrices"`
+	// True when tomorrow's prices cover the whole day
+	TomorrowAvailable bool `json:"tomorrowAvailable"`
+	// When the latest prices from Nord Pool were stored, nil when no prices are stored
+	LastNordPoolFetch         *time.Time `json:"lastNordPoolFetch"`
+	SecondsSinceNordPoolFetch *int64     `json:"secondsSinceNordPoolFetch"`
+}
+
+// Status handles GET /status, a summary of the stored data for uptime monitors.
+// tomorrowAvailable should be true from around 14:00 Helsinki time onwards.
+func (res *HealthResource) Status(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	w.Header().Set("Cache-Control", "no-store")
+	if res.priceRepository == nil {
+		problem.Unavailable(w, r, "Database not configured")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	now := res.timeProvider.Now()
+	resp := StatusResponse{
+		Version:       res.version,
+		UptimeSeconds: int64(now.Sub(res.started).Seconds()),
+	}
+
+	latest, err := res.priceRepository.GetLatestPrice(ctx)
+	if err != nil {
+		logger.Error("Error getting latest price", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+	if latest != nil {
+		resp.LatestSlot = &StatusSlot{Start: latest.DeliveryStart, End: latest.DeliveryEnd}
+	}
+
+	helsinki := loadHelsinki()
+	today := now.In(helsinki)
+	tomorrow := time.Date(today.Year(), today.Month(), today.Day()+1, 0, 0, 0, 0, helsinki)
+	prices, err := res.priceRepository.GetPrices(ctx, tomorrow, tomorrow.AddDate(0, 0, 1))
+	if err != nil {
+		logger.Error("Error getting tomorrow's prices", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+	resp.TomorrowPrices = len(prices)
+	resp.TomorrowAvailable = service.Covers(prices, tomorrow, tomorrow.AddDate(0, 0, 1))
+
+	// From the database, so it survives restarts and is the same on every instance
+	fetched, err := res.priceRepository.GetLatestInsertTime(ctx)
+	if err != nil {
+		logger.Error("Error getting latest insert time", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+	if fetched != nil {
+		since := int64(now.Sub(*fetched).Seconds())
+		resp.LastNordPoolFetch = fetched
+		resp.SecondsSinceNordPoolFetch = &since
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
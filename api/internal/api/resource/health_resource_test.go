@@ -0,0 +1,173 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockMigrationRepository struct {
+	mock.Mock
+}
+
+func (m *MockMigrationRepository) GetVersion(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func TestHealthResource_Healthz(t *testing.T) {
+	mockTime := new(MockTimeProvider)
+	mockTime.On("Now").Return(time.Now())
+	res := NewHealthResource(nil, nil, mockTime, 4, "dev")
+
+	rr := httptest.NewRecorder()
+	res.Healthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "ok", rr.Body.String())
+}
+
+func TestHealthResource_Readyz(t *testing.T) {
+	mockTime := new(MockTimeProvider)
+	mockTime.On("Now").Return(time.Now())
+
+	t.Run("Ready", func(t *testing.T) {
+		mockRepo := new(testutil.MockPriceRepository)
+		mockMigrations := new(MockMigrationRepository)
+		mockRepo.On("Select1", mock.Anything).Return(nil)
+		// Migrations of the next release may already be applied
+		mockMigrations.On("GetVersion", mock.Anything).Return(int64(5), nil)
+		res := NewHealthResource(mockRepo, mockMigrations, mockTime, 4, "dev")
+
+		rr := httptest.NewRecorder()
+		res.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Old schema", func(t *testing.T) {
+		mockRepo := new(testutil.MockPriceRepository)
+		mockMigrations := new(MockMigrationRepository)
+		mockRepo.On("Select1", mock.Anything).Return(nil)
+		mockMigrations.On("GetVersion", mock.Anything).Return(int64(3), nil)
+		res := NewHealthResource(mockRepo, mockMigrations, mockTime, 4, "dev")
+
+		rr := httptest.NewRecorder()
+		res.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Database at migration 3, expected 4")
+	})
+
+	t.Run("Database down", func(t *testing.T) {
+		mockRepo := new(testutil.MockPriceRepository)
+		mockRepo.On("Select1", mock.Anything).Return(errors.New("connection refused"))
+		res := NewHealthResource(mockRepo, new(MockMigrationRepository), mockTime, 4, "dev")
+
+		rr := httptest.NewRecorder()
+		res.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+
+	t.Run("No database", func(t *testing.T) {
+		res := NewHealthResource(nil, nil, mockTime, 4, "dev")
+
+		rr := httptest.NewRecorder()
+		res.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
+
+func TestHealthResource_Status(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	started := time.Date(2025, 1, 1, 13, 0, 0, 0, helsinki)
+	now := started.Add(time.Hour)
+	tomorrow := time.Date(2025, 1, 2, 0, 0, 0, 0, helsinki)
+	latest := model.PriceHistoryEntry{Price: 3, DeliveryStart: tomorrow.Add(-15 * time.Minute).UTC(), DeliveryEnd: tomorrow.UTC()}
+
+	mockTime := new(MockTimeProvider)
+	mockTime.On("Now").Return(started).Once()
+	mockTime.On("Now").Return(now)
+
+	mockRepo := new(testutil.MockPriceRepository)
+	mockRepo.On("GetLatestPrice", mock.Anything).Return(&latest, nil)
+	mockRepo.On("GetLatestInsertTime", mock.Anything).Return(nil, nil)
+	mockRepo.On("GetPrices", mock.Anything, tomorrow, tomorrow.AddDate(0, 0, 1)).Return([]model.PriceHistoryEntry{}, nil)
+
+	res := NewHealthResource(mockRepo, nil, mockTime, 4, "1.2.3")
+
+	rr := httptest.NewRecorder()
+	res.Status(rr, httptest.NewRequest("GET", "/status", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+
+	var resp StatusResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, "1.2.3", resp.Version)
+	assert.Equal(t, int64(3600), resp.UptimeSeconds)
+	assert.True(t, resp.LatestSlot.End.Equal(tomorrow))
+	assert.Equal(t, 0, resp.TomorrowPrices)
+	assert.False(t, resp.TomorrowAvailable)
+	assert.Nil(t, resp.LastNordPoolFetch)
+	assert.Nil(t, resp.SecondsSinceNordPoolFetch)
+}
+
+func TestHealthResource_StatusNordPoolFetch(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	now := time.Date(2025, 1, 1, 14, 0, 0, 0, helsinki)
+	tomorrow := time.Date(2025, 1, 2, 0, 0, 0, 0, helsinki)
+	fetched := now.Add(-90 * time.Second)
+	mockTime := new(MockTimeProvider)
+	mockTime.On("Now").Return(now)
+
+	mockRepo := new(testutil.MockPriceRepository)
+	mockRepo.On("GetLatestPrice", mock.Anything).Return(nil, nil)
+	mockRepo.On("GetLatestInsertTime", mock.Anything).Return(&fetched, nil)
+	mockRepo.On("GetPrices", mock.Anything, tomorrow, tomorrow.AddDate(0, 0, 1)).Return(quarterHourEntries(tomorrow, 96, func(int) float64 { return 1 }), nil)
+
+	// A new instance sees the fetch of an earlier one
+	res := NewHealthResource(mockRepo, nil, mockTime, 4, "dev")
+	rr := httptest.NewRecorder()
+	res.Status(rr, httptest.NewRequest("GET", "/status", nil))
+
+	var resp StatusResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Nil(t, resp.LatestSlot)
+	assert.Equal(t, 96, resp.TomorrowPrices)
+	assert.True(t, resp.TomorrowAvailable)
+	assert.True(t, resp.LastNordPoolFetch.Equal(fetched))
+	assert.Equal(t, int64(90), *resp.SecondsSinceNordPoolFetch)
+}
+
+func TestHealthResource_StatusPartialTomorrow(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	tomorrow := time.Date(2025, 1, 2, 0, 0, 0, 0, helsinki)
+	mockTime := new(MockTimeProvider)
+	mockTime.On("Now").Return(time.Date(2025, 1, 1, 14, 0, 0, 0, helsinki))
+
+	mockRepo := new(testutil.MockPriceRepository)
+	mockRepo.On("GetLatestPrice", mock.Anything).Return(nil, nil)
+	mockRepo.On("GetLatestInsertTime", mock.Anything).Return(nil, nil)
+	mockRepo.On("GetPrices", mock.Anything, tomorrow, tomorrow.AddDate(0, 0, 1)).Return(quarterHourEntries(tomorrow, 92, func(int) float64 { return 1 }), nil)
+
+	res := NewHealthResource(mockRepo, nil, mockTime, 4, "dev")
+	rr := httptest.NewRecorder()
+	res.Status(rr, httptest.NewRequest("GET", "/status", nil))
+
+	var resp StatusResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, 92, resp.TomorrowPrices)
+	assert.False(t, resp.TomorrowAvailable)
+}
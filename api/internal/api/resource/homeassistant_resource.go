@@ -0,0 +1,171 @@
+package resource
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/service"
+	"github.com/samlof/ehin/internal/utils"
+)
+
+type HomeAssistantResource struct {
+	priceRepository repository.PriceRepository
+	dateService     service.TimeProvider
+}
+
+func NewHomeAssistantResource(priceRepository repository.PriceRepository, dateService service.TimeProvider) *HomeAssistantResource {
+	return &HomeAssistantResource{
+		priceRepository: priceRepository,
+		dateService:     dateService,
+	}
+}
+
+// HomeAssistantSensor is the document consumed by Home Assistant's REST sensor.
+// The attribute names follow the Nord Pool custom integration, so existing
+// templates and ApexCharts cards work with it as is. Prices are in c/kWh.
+type HomeAssistantSensor struct {
+	Area          string              `json:"area"`
+	Currency      string              `json:"currency"`
+	Unit          string              `json:"unit"`
+	VATPercent    float64             `json:"vat_percent"`
+	CurrentPrice  *float64            `json:"current_price"`
+	NextPrice     *float64            `json:"next_price"`
+	Min           *float64            `json:"min"`
+	Max           *float64            `json:"max"`
+	Average       *float64            `json:"average"`
+	Today         []float64           `json:"today"`
+	Tomorrow      []float64           `json:"tomorrow"`
+	TomorrowValid bool                `json:"tomorrow_valid"`
+	RawToday      []HomeAssistantSlot `json:"raw_today"`
+	RawTomorrow   []HomeAssistantSlot `json:"raw_tomorrow"`
+}
+
+type HomeAssistantSlot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Value float64   `json:"value"`
+}
+
+// GetSensor handles GET /api/homeassistant/{area}
+//
+// Example configuration.yaml:
+//
+//	sensor:
+//	  - platform: rest
+//	    resource: https://api.ehin.fi/api/homeassistant/FI?vat=25.5
+//	    value_template: "{{ value_json.current_price }}"
+//	    unit_of_measurement: "c/kWh"
+//	    json_attributes: [next_price, min, max, average, today, tomorrow, tomorrow_valid, raw_today, raw_tomorrow]
+func (res *HomeAssistantResource) GetSensor(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	area, ok := service.NormalizeArea(r.PathValue("area"))
+	if !ok {
+		problem.NotFound(w, r, "Unknown area")
+		return
+	}
+
+	vatPercent, err := parseVATPercent(r.URL.Query().Get("vat"))
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	if res.priceRepository == nil {
+		logger.Warn("Price repository not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return
+	}
+
+	helsinki := loadHelsinki()
+	now := res.dateService.Now()
+	localNow := now.In(helsinki)
+	today := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, helsinki)
+	tomorrow := today.AddDate(0, 0, 1)
+	dayAfter := today.AddDate(0, 0, 2)
+
+	prices, err := res.priceRepository.GetPrices(r.Context(), today, dayAfter)
+	if err != nil {
+		logger.Error("Error fetching prices from repository", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	sensor := buildHomeAssistantSensor(prices, now, tomorrow, dayAfter, vatPercent)
+	sensor.Area = area
+
+	// The state changes at the end of the current slot
+	maxAge := 60
+	if current := service.SlotAt(prices, now); current >= 0 {
+		maxAge = max(1, int(prices[current].DeliveryEnd.Sub(now).Seconds()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(utils.CACHE_CONTROL_HEADER, utils.CACHE_VAR+", max-age="+strconv.Itoa(maxAge))
+	if err := json.NewEncoder(w).Encode(sensor); err != nil {
+		logger.Error("Error encoding sensor", "error", err)
+	}
+}
+
+// buildHomeAssistantSensor converts sorted prices from today and tomorrow into the sensor
+// document. Prices starting before tomorrow are today's.
+func buildHomeAssistantSensor(prices []model.PriceHistoryEntry, now, tomorrow, dayAfter time.Time, vatPercent float64) HomeAssistantSensor {
+	sensor := HomeAssistantSensor{
+		Currency:    "EUR",
+		Unit:        "c/kWh",
+		VATPercent:  vatPercent,
+		Today:       []float64{},
+		Tomorrow:    []float64{},
+		RawToday:    []HomeAssistantSlot{},
+		RawTomorrow: []HomeAssistantSlot{},
+	}
+
+	toCents := func(eurPerMwh float64) float64 {
+		return math.Round(eurPerMwh*(1+vatPercent/100)*100) / 1000
+	}
+
+	var tomorrowCovered time.Duration
+	var sum float64
+	for _, p := range prices {
+		slot := HomeAssistantSlot{Start: p.DeliveryStart, End: p.DeliveryEnd, Value: toCents(p.Price)}
+		if p.DeliveryStart.Before(tomorrow) {
+			sensor.Today = append(sensor.Today, slot.Value)
+			sensor.RawToday = append(sensor.RawToday, slot)
+			sum += slot.Value
+			if sensor.Min == nil || slot.Value < *sensor.Min {
+				sensor.Min = &slot.Value
+			}
+			if sensor.Max == nil || slot.Value > *sensor.Max {
+				sensor.Max = &slot.Value
+			}
+		} else {
+			sensor.Tomorrow = append(sensor.Tomorrow, slot.Value)
+			sensor.RawTomorrow = append(sensor.RawTomorrow, slot)
+			tomorrowCovered += p.DeliveryEnd.Sub(p.DeliveryStart)
+		}
+	}
+
+	if len(sensor.Today) > 0 {
+		avg := math.Round(sum/float64(len(sensor.Today))*1000) / 1000
+		sensor.Average = &avg
+	}
+	// DST days are 23 or 25 hours long, so compare against the actual day length
+	sensor.TomorrowValid = tomorrowCovered == dayAfter.Sub(tomorrow)
+
+	if current := service.SlotAt(prices, now); current >= 0 {
+		value := toCents(prices[current].Price)
+		sensor.CurrentPrice = &value
+		if next := current + 1; next < len(prices) && prices[next].DeliveryStart.Equal(prices[current].DeliveryEnd) {
+			value := toCents(prices[next].Price)
+			sensor.NextPrice = &value
+		}
+	}
+
+	return sensor
+}
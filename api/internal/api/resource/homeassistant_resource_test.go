@@ -0,0 +1,93 @@
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/samlof/ehin/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func quarterHourEntries(start time.Time, count int, price func(i int) float64) []model.PriceHistoryEntry {
+	entries := make([]model.PriceHistoryEntry, count)
+	for i := range count {
+		s := start.Add(time.Duration(i) * 15 * time.Minute)
+		entries[i] = model.PriceHistoryEntry{Price: price(i), DeliveryStart: s, DeliveryEnd: s.Add(15 * time.Minute)}
+	}
+	return entries
+}
+
+func TestHomeAssistantResource_GetSensor(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	today := time.Date(2025, 10, 25, 0, 0, 0, 0, helsinki)
+	tomorrow := today.AddDate(0, 0, 1)
+	dayAfter := today.AddDate(0, 0, 2)
+	now := today.Add(10*time.Hour + 20*time.Minute)
+
+	// Tomorrow is the 25 hour DST day
+	entries := quarterHourEntries(today, 96, func(i int) float64 { return float64(i) })
+	entries = append(entries, quarterHourEntries(tomorrow, 100, func(i int) float64 { return 100 })...)
+
+	mockRepo := new(testutil.MockPriceRepository)
+	mockTime := new(MockTimeProvider)
+	mockRepo.On("GetPrices", mock.Anything, today, dayAfter).Return(entries, nil)
+	mockTime.On("Now").Return(now)
+	res := NewHomeAssistantResource(mockRepo, mockTime)
+
+	req := httptest.NewRequest("GET", "/api/homeassistant/fi?vat=25.5", nil)
+	req.SetPathValue("area", "fi")
+	rr := httptest.NewRecorder()
+	res.GetSensor(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	// 10:20 is in the 10:15-10:30 slot
+	assert.Equal(t, utils.CACHE_VAR+", max-age=600", rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+
+	var sensor HomeAssistantSensor
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&sensor))
+	assert.Equal(t, "FI", sensor.Area)
+	assert.Equal(t, "c/kWh", sensor.Unit)
+	assert.Equal(t, 25.5, sensor.VATPercent)
+	// Slot 41 costs 41 EUR/MWh, 4.1 c/kWh, 5.1455 with VAT
+	assert.Equal(t, 5.146, *sensor.CurrentPrice)
+	assert.Equal(t, 5.271, *sensor.NextPrice)
+	assert.Equal(t, 0.0, *sensor.Min)
+	assert.Equal(t, 11.923, *sensor.Max)
+	assert.Len(t, sensor.Today, 96)
+	assert.Len(t, sensor.RawToday, 96)
+	assert.Len(t, sensor.Tomorrow, 100)
+	assert.True(t, sensor.TomorrowValid)
+	assert.True(t, sensor.RawTomorrow[0].Start.Equal(tomorrow))
+}
+
+func TestHomeAssistantResource_TomorrowMissing(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	today := time.Date(2025, 1, 10, 0, 0, 0, 0, helsinki)
+	entries := quarterHourEntries(today, 96, func(i int) float64 { return 50 })
+
+	sensor := buildHomeAssistantSensor(entries, today.Add(23*time.Hour+50*time.Minute), today.AddDate(0, 0, 1), today.AddDate(0, 0, 2), 0)
+
+	assert.False(t, sensor.TomorrowValid)
+	assert.Equal(t, []float64{}, sensor.Tomorrow)
+	assert.Equal(t, 5.0, *sensor.CurrentPrice)
+	assert.Nil(t, sensor.NextPrice)
+	assert.Equal(t, 5.0, *sensor.Average)
+}
+
+func TestHomeAssistantResource_UnknownArea(t *testing.T) {
+	res := NewHomeAssistantResource(new(testutil.MockPriceRepository), new(MockTimeProvider))
+
+	req := httptest.NewRequest("GET", "/api/homeassistant/SE3", nil)
+	req.SetPathValue("area", "SE3")
+	rr := httptest.NewRecorder()
+	res.GetSensor(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
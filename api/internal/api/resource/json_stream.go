@@ -0,0 +1,44 @@
+package resource
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonArrayWriter writes values one at a time as a single JSON array.
+type jsonArrayWriter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONArrayWriter(w io.Writer) *jsonArrayWriter {
+	return &jsonArrayWriter{w: w}
+}
+
+func (jw *jsonArrayWriter) Write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	sep := []byte{','}
+	if jw.count == 0 {
+		sep[0] = '['
+	}
+	jw.count++
+	if _, err := jw.w.Write(sep); err != nil {
+		return err
+	}
+	_, err = jw.w.Write(b)
+	return err
+}
+
+// Close terminates the array. It doesn't close the underlying writer.
+func (jw *jsonArrayWriter) Close() error {
+	end := "]\n"
+	if jw.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
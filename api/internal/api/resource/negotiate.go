@@ -0,0 +1,101 @@
+package resource
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/samlof/ehin/internal/pricebin"
+)
+
+const (
+	mediaTypeJSON = "application/json"
+	mediaTypeCSV  = "text/csv"
+)
+
+// formatMediaTypes maps values of the format query parameter to media types.
+var formatMediaTypes = map[string]string{
+	"json": mediaTypeJSON,
+	"csv":  mediaTypeCSV,
+	"bin":  pricebin.MediaType,
+}
+
+// negotiateFormat picks the response media type from the offers. The format query
+// parameter takes precedence over the Accept header. The first offer is the default
+// when the client doesn't express a usable preference. It returns false when the
+// format parameter asks for something that isn't offered.
+func negotiateFormat(r *http.Request, offers ...string) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		mediaType, ok := formatMediaTypes[strings.ToLower(format)]
+		if !ok {
+			return "", false
+		}
+		for _, offer := range offers {
+			if offer == mediaType {
+				return offer, true
+			}
+		}
+		return "", false
+	}
+	return negotiateContentType(r.Header.Get("Accept"), offers...), true
+}
+
+// negotiateContentType returns the offer with the highest weight in the Accept header.
+// Ties are resolved in the order of offers.
+func negotiateContentType(accept string, offers ...string) string {
+	if accept == "" {
+		return offers[0]
+	}
+
+	best := offers[0]
+	bestQ := -1.0
+	for _, offer := range offers {
+		q := acceptWeight(accept, offer)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	if bestQ <= 0 {
+		return offers[0]
+	}
+	return best
+}
+
+// acceptWeight returns the q value the Accept header gives to mediaType,
+// using the most specific matching range.
+func acceptWeight(accept, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q := 0.0
+	specificity := -1
+	for part := range strings.SplitSeq(accept, ",") {
+		rangeType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch {
+		case rangeType == mediaType:
+			s = 2
+		case rangeType == typ+"/*":
+			s = 1
+		case rangeType == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity = s
+		q = 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return q
+}
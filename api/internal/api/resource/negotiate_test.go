@@ -0,0 +1,40 @@
+package resource
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		accept     string
+		expected   string
+		expectedOK bool
+	}{
+		{"No preference", "/api/prices", "", mediaTypeJSON, true},
+		{"Browser accept", "/api/prices", "text/html,application/xhtml+xml,*/*;q=0.8", mediaTypeJSON, true},
+		{"Accept CSV", "/api/prices", "text/csv", mediaTypeCSV, true},
+		{"Accept CSV preferred", "/api/prices", "application/json;q=0.5, text/csv", mediaTypeCSV, true},
+		{"Accept text wildcard", "/api/prices", "text/*", mediaTypeCSV, true},
+		{"Unsupported accept", "/api/prices", "application/xml", mediaTypeJSON, true},
+		{"Format overrides accept", "/api/prices?format=csv", "application/json", mediaTypeCSV, true},
+		{"Format json", "/api/prices?format=JSON", "text/csv", mediaTypeJSON, true},
+		{"Unknown format", "/api/prices?format=xml", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			got, ok := negotiateFormat(req, mediaTypeJSON, mediaTypeCSV)
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
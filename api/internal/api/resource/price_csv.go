@@ -0,0 +1,123 @@
+package resource
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+// Local timestamps are written without an offset so Excel recognises them as dates.
+const csvLocalTimeFormat = "2006-01-02 15:04"
+
+// csvOptions controls how price rows are formatted for spreadsheets.
+type csvOptions struct {
+	// decimalComma writes 12,34 instead of 12.34 and switches the field separator to ';'.
+	decimalComma bool
+	// location for timestamps. UTC timestamps are written in RFC 3339.
+	location *time.Location
+	// vatPercent adds a VAT-inclusive price column when greater than zero.
+	vatPercent float64
+}
+
+// parseCSVOptions reads the decimal, tz and vat query parameters.
+func parseCSVOptions(query url.Values, local *time.Location) (csvOptions, error) {
+	opts := csvOptions{location: local}
+
+	switch strings.ToLower(query.Get("decimal")) {
+	case "", "dot", ".":
+	case "comma", ",":
+		opts.decimalComma = true
+	default:
+		return opts, fmt.Errorf("invalid decimal %q. Use dot or comma", query.Get("decimal"))
+	}
+
+	switch strings.ToLower(query.Get("tz")) {
+	case "", "local":
+	case "utc":
+		opts.location = time.UTC
+	default:
+		return opts, fmt.Errorf("invalid tz %q. Use local or utc", query.Get("tz"))
+	}
+
+	vatPercent, err := parseVATPercent(query.Get("vat"))
+	if err != nil {
+		return opts, err
+	}
+	opts.vatPercent = vatPercent
+
+	return opts, nil
+}
+
+// parseVATPercent parses an optional VAT percentage. An empty value means no VAT.
+func parseVATPercent(vat string) (float64, error) {
+	if vat == "" {
+		return 0, nil
+	}
+	percent, err := strconv.ParseFloat(vat, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid vat %q. Use a percentage, e.g. 25.5", vat)
+	}
+	return percent, nil
+}
+
+// priceCSVWriter writes price entries as CSV rows one at a time.
+type priceCSVWriter struct {
+	w    *csv.Writer
+	opts csvOptions
+	row  []string
+}
+
+func newPriceCSVWriter(w io.Writer, opts csvOptions) *priceCSVWriter {
+	cw := csv.NewWriter(w)
+	if opts.decimalComma {
+		cw.Comma = ';'
+	}
+	return &priceCSVWriter{w: cw, opts: opts}
+}
+
+func (pw *priceCSVWriter) WriteHeader() error {
+	header := []string{"start", "end", "price_eur_mwh"}
+	if pw.opts.vatPercent > 0 {
+		header = append(header, "price_eur_mwh_vat")
+	}
+	return pw.w.Write(header)
+}
+
+func (pw *priceCSVWriter) Write(entry model.PriceHistoryEntry) error {
+	pw.row = append(pw.row[:0],
+		pw.formatTime(entry.DeliveryStart),
+		pw.formatTime(entry.DeliveryEnd),
+		pw.formatPrice(entry.Price),
+	)
+	if pw.opts.vatPercent > 0 {
+		pw.row = append(pw.row, pw.formatPrice(entry.Price*(1+pw.opts.vatPercent/100)))
+	}
+	return pw.w.Write(pw.row)
+}
+
+// Flush writes buffered rows to the underlying writer.
+func (pw *priceCSVWriter) Flush() error {
+	pw.w.Flush()
+	return pw.w.Error()
+}
+
+func (pw *priceCSVWriter) formatTime(t time.Time) string {
+	if pw.opts.location == time.UTC {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return t.In(pw.opts.location).Format(csvLocalTimeFormat)
+}
+
+func (pw *priceCSVWriter) formatPrice(price float64) string {
+	s := strconv.FormatFloat(price, 'f', 2, 64)
+	if pw.opts.decimalComma {
+		s = strings.Replace(s, ".", ",", 1)
+	}
+	return s
+}
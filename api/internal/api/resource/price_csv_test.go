@@ -0,0 +1,76 @@
+package resource
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSVOptions(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+
+	opts, err := parseCSVOptions(url.Values{}, helsinki)
+	assert.NoError(t, err)
+	assert.False(t, opts.decimalComma)
+	assert.Equal(t, helsinki, opts.location)
+	assert.Zero(t, opts.vatPercent)
+
+	opts, err = parseCSVOptions(url.Values{"decimal": {"comma"}, "tz": {"utc"}, "vat": {"25.5"}}, helsinki)
+	assert.NoError(t, err)
+	assert.True(t, opts.decimalComma)
+	assert.Equal(t, time.UTC, opts.location)
+	assert.Equal(t, 25.5, opts.vatPercent)
+
+	for _, query := range []url.Values{
+		{"decimal": {"semicolon"}},
+		{"tz": {"Europe/Stockholm"}},
+		{"vat": {"abc"}},
+		{"vat": {"-1"}},
+	} {
+		_, err := parseCSVOptions(query, helsinki)
+		assert.Error(t, err, query.Encode())
+	}
+}
+
+func TestPriceCSVWriter(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, helsinki)
+	entry := model.PriceHistoryEntry{Price: 10.5, DeliveryStart: start, DeliveryEnd: start.Add(15 * time.Minute)}
+
+	tests := []struct {
+		name     string
+		opts     csvOptions
+		expected string
+	}{
+		{
+			name:     "Default",
+			opts:     csvOptions{location: helsinki},
+			expected: "start,end,price_eur_mwh\n2025-01-01 00:00,2025-01-01 00:15,10.50\n",
+		},
+		{
+			name:     "Decimal comma with VAT",
+			opts:     csvOptions{location: helsinki, decimalComma: true, vatPercent: 25.5},
+			expected: "start;end;price_eur_mwh;price_eur_mwh_vat\n2025-01-01 00:00;2025-01-01 00:15;10,50;13,18\n",
+		},
+		{
+			name:     "UTC timestamps",
+			opts:     csvOptions{location: time.UTC},
+			expected: "start,end,price_eur_mwh\n2024-12-31T22:00:00Z,2024-12-31T22:15:00Z,10.50\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			pw := newPriceCSVWriter(&buf, tt.opts)
+			assert.NoError(t, pw.WriteHeader())
+			assert.NoError(t, pw.Write(entry))
+			assert.NoError(t, pw.Flush())
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
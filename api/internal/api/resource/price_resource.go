@@ -1,152 +1,169 @@
 package resource
 
 import (
-	"crypto/subtle"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/samlof/ehin/internal/api/middleware"
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/db/model"
 	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/pricebin"
 	"github.com/samlof/ehin/internal/service"
 	"github.com/samlof/ehin/internal/utils"
 )
 
 type PriceResource struct {
-	priceRepository      repository.PriceRepository
-	pricesService        *service.PricesService
-	dateService          service.TimeProvider
-	updatePricesPassword string
+	priceRepository repository.PriceRepository
+	pricesService   *service.PricesService
+	dateService     service.TimeProvider
+	listeners       []service.PriceListener
 }
 
 func NewPriceResource(
 	priceRepository repository.PriceRepository,
 	pricesService *service.PricesService,
 	dateService service.TimeProvider,
-	updatePricesPassword string,
 ) *PriceResource {
 	return &PriceResource{
-		priceRepository:      priceRepository,
-		pricesService:        pricesService,
-		dateService:          dateService,
-		updatePricesPassword: updatePricesPassword,
+		priceRepository: priceRepository,
+		pricesService:   pricesService,
+		dateService:     dateService,
 	}
 }
 
-type UpdatePricesResponse struct {
-	Done bool `json:"done"`
+// AddListener registers l to be notified when an update stores new prices.
+func (res *PriceResource) AddListener(l service.PriceListener) {
+	res.listeners = append(res.listeners, l)
 }
 
-func secureCompare(a, b string) bool {
-	if len(b) > 5000 {
-		return false
+func (res *PriceResource) notifyListeners(ctx context.Context, inserted int64, entries []model.PriceHistoryEntry) {
+	// The cron job keeps polling after prices are stored. Those runs insert nothing.
+	if inserted == 0 {
+		return
 	}
-	var sameLen = subtle.ConstantTimeEq(int32(len(a)), int32(len(b))) == 1
-	if !sameLen {
-		b = a
+	for _, l := range res.listeners {
+		l.PricesIngested(ctx, service.DefaultArea, entries)
 	}
-	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1 && sameLen
 }
 
-func (res *PriceResource) UpdatePrices(w http.ResponseWriter, r *http.Request) {
-	password := r.URL.Query().Get("p")
-	if res.updatePricesPassword == "" || !secureCompare(res.updatePricesPassword, password) {
-		http.Error(w, "Not Found", http.StatusNotFound)
-		return
-	}
+type UpdatePricesResponse struct {
+	Done bool `json:"done"`
+}
 
-	slog.Info("Updating prices", "date", time.Now().AddDate(0, 0, 1).Format("2006-01-02"))
-	prices, err := res.pricesService.GetTomorrowsPrices()
+// UpdatePrices fetches and stores tomorrow's prices. Callers are authenticated by middleware.
+func (res *PriceResource) UpdatePrices(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	logger.Info("Updating prices", "date", time.Now().AddDate(0, 0, 1).Format("2006-01-02"))
+	prices, err := res.pricesService.GetTomorrowsPrices(r.Context())
 	if err != nil {
-		slog.Error("Error fetching tomorrow's prices", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("Error fetching tomorrow's prices", "error", err)
+		problem.Internal(w, r)
 		return
 	}
 
 	if prices == nil {
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(UpdatePricesResponse{Done: false}); err != nil {
-			slog.Error("Error encoding response", "error", err)
+			logger.Error("Error encoding response", "error", err)
 		}
 		return
 	}
 
 	entries := res.pricesService.ToPriceHistoryEntries(prices)
-	_, err = res.priceRepository.InsertPrices(r.Context(), entries)
+	inserted, err := res.priceRepository.InsertPrices(r.Context(), entries)
 	if err != nil {
-		slog.Error("Error inserting prices", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("Error inserting prices", "error", err)
+		problem.Internal(w, r)
 		return
 	}
+	res.notifyListeners(r.Context(), inserted, entries)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(UpdatePricesResponse{Done: true}); err != nil {
-		slog.Error("Error encoding response", "error", err)
+		logger.Error("Error encoding response", "error", err)
 	}
 }
 
+// UpdatePricesForDate fetches and stores the prices of the date path parameter.
 func (res *PriceResource) UpdatePricesForDate(w http.ResponseWriter, r *http.Request) {
-	password := r.URL.Query().Get("p")
-	if res.updatePricesPassword == "" || !secureCompare(res.updatePricesPassword, password) {
-		http.Error(w, "Not Found", http.StatusNotFound)
-		return
-	}
-
+	logger := logging.FromContext(r.Context())
 	dateStr := r.PathValue("date")
 	date, err := time.Parse("2006-01-02", dateStr)
 	if err != nil {
-		http.Error(w, "Invalid date format. Use YYYY-MM-DD", http.StatusBadRequest)
+		problem.BadRequest(w, r, "Invalid date format. Use YYYY-MM-DD")
 		return
 	}
 
-	slog.Info("Updating prices", "date", dateStr)
-	prices, err := res.pricesService.GetPrices(date)
+	logger.Info("Updating prices", "date", dateStr)
+	prices, err := res.pricesService.GetPrices(r.Context(), date)
 	if err != nil {
-		slog.Error("Error fetching prices", "date", dateStr, "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("Error fetching prices", "date", dateStr, "error", err)
+		problem.Internal(w, r)
 		return
 	}
 
 	if prices == nil {
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(UpdatePricesResponse{Done: false}); err != nil {
-			slog.Error("Error encoding response", "error", err)
+			logger.Error("Error encoding response", "error", err)
 		}
 		return
 	}
 
 	entries := res.pricesService.ToPriceHistoryEntries(prices)
-	_, err = res.priceRepository.InsertPrices(r.Context(), entries)
+	inserted, err := res.priceRepository.InsertPrices(r.Context(), entries)
 	if err != nil {
-		slog.Error("Error inserting prices", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("Error inserting prices", "error", err)
+		problem.Internal(w, r)
 		return
 	}
+	res.notifyListeners(r.Context(), inserted, entries)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(UpdatePricesResponse{Done: true}); err != nil {
-		slog.Error("Error encoding response", "error", err)
+		logger.Error("Error encoding response", "error", err)
 	}
 }
 
 func (res *PriceResource) GetPastPrices(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	dateStr := r.PathValue("date")
 	date, err := time.Parse("2006-01-02", dateStr)
 	if err != nil {
-		http.Error(w, "Invalid date format. Use YYYY-MM-DD", http.StatusBadRequest)
+		problem.BadRequest(w, r, "Invalid date format. Use YYYY-MM-DD")
 		return
 	}
 
-	if res.priceRepository == nil {
-		slog.Warn("Price repository not initialized")
-		http.Error(w, "Database connection not available", http.StatusInternalServerError)
+	format, ok := negotiateFormat(r, mediaTypeJSON, mediaTypeCSV, pricebin.MediaType)
+	if !ok {
+		problem.BadRequest(w, r, "Invalid format. Use json, csv or bin")
 		return
 	}
 
-	helsinki, err := time.LoadLocation("Europe/Helsinki")
-	if err != nil {
-		slog.Error("Error loading Europe/Helsinki", "error", err)
-		helsinki = time.UTC
+	helsinki := loadHelsinki()
+
+	var csvOpts csvOptions
+	if format == mediaTypeCSV {
+		csvOpts, err = parseCSVOptions(r.URL.Query(), helsinki)
+		if err != nil {
+			problem.BadRequest(w, r, err.Error())
+			return
+		}
+	}
+
+	if res.priceRepository == nil {
+		logger.Warn("Price repository not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return
 	}
 
 	// Helsinki 00:00:00 on the requested date
@@ -156,12 +173,12 @@ func (res *PriceResource) GetPastPrices(w http.ResponseWriter, r *http.Request)
 	from := dateWithTime.AddDate(0, 0, -1)
 	to := dateWithTime.AddDate(0, 0, 3)
 
-	slog.Info("Fetching prices from repository", "from", from, "to", to)
+	logger.Info("Fetching prices from repository", "from", from, "to", to)
 
 	prices, err := res.priceRepository.GetPrices(r.Context(), from, to)
 	if err != nil {
-		slog.Error("Error fetching prices from repository", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Error("Error fetching prices from repository", "error", err)
+		problem.Internal(w, r)
 		return
 	}
 
@@ -197,14 +214,230 @@ func (res *PriceResource) GetPastPrices(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	slog.Info("Returning prices", "cacheString", cacheString, "expiresValue", expiresValue, "priceCount", len(prices))
-	w.Header().Set("Content-Type", "application/json")
+	logger.Info("Returning prices", "cacheString", cacheString, "expiresValue", expiresValue, "priceCount", len(prices))
 	w.Header().Set(utils.CACHE_CONTROL_HEADER, cacheString)
 	if expiresValue != "" {
 		w.Header().Set(utils.EXPIRES_HEADER, expiresValue)
 	}
 
+	// Shared caches must not serve one format for another
+	w.Header().Add("Vary", "Accept")
+
+	if format == pricebin.MediaType {
+		writePricesBinary(w, r, prices)
+		return
+	}
+
+	if format == mediaTypeCSV {
+		setCSVHeaders(w, "prices-"+dateStr+".csv")
+		pw := newPriceCSVWriter(w, csvOpts)
+		err := pw.WriteHeader()
+		for _, price := range prices {
+			if err != nil {
+				break
+			}
+			err = pw.Write(price)
+		}
+		if err == nil {
+			err = pw.Flush()
+		}
+		if err != nil {
+			logger.Error("Error writing prices CSV", "error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(prices); err != nil {
-		slog.Error("Error encoding prices", "error", err)
+		logger.Error("Error encoding prices", "error", err)
+	}
+}
+
+// Longest range that can be requested from GetPriceRange.
+const maxPriceRangeDays = 366
+
+// GetPriceRange handles GET /api/prices?from=YYYY-MM-DD&to=YYYY-MM-DD.
+// Both dates are inclusive and interpreted in Helsinki time. Rows are streamed from
+// the repository, so long exports are never held in memory.
+func (res *PriceResource) GetPriceRange(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	query := r.URL.Query()
+	helsinki := loadHelsinki()
+	from, to, err := parseDateRange(query.Get("from"), query.Get("to"), helsinki)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	format, ok := negotiateFormat(r, mediaTypeJSON, mediaTypeCSV)
+	if !ok {
+		problem.BadRequest(w, r, "Invalid format. Use json or csv")
+		return
+	}
+
+	var csvOpts csvOptions
+	if format == mediaTypeCSV {
+		csvOpts, err = parseCSVOptions(query, helsinki)
+		if err != nil {
+			problem.BadRequest(w, r, err.Error())
+			return
+		}
+	}
+
+	if res.priceRepository == nil {
+		logger.Warn("Price repository not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return
 	}
+
+	// Stored prices are never changed, so the covered time of the range
+	// identifies its rows. It gives an ETag without buffering the response.
+	covered, err := res.priceRepository.GetCoverage(r.Context(), from, to)
+	if err != nil {
+		logger.Error("Error fetching price coverage from repository", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+	sum := sha256.Sum256([]byte(format + "\x00" + r.URL.RawQuery + "\x00" + strconv.FormatInt(int64(covered), 10)))
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+
+	// Complete ranges that ended before today can't change anymore
+	now := res.dateService.Now().In(helsinki)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, helsinki)
+	cacheString := utils.CACHE_VAR + ", max-age=60"
+	if !to.After(today) && covered >= to.Sub(from) {
+		cacheString = utils.CACHE_LONG
+	}
+	setHeaders := func() {
+		w.Header().Set(utils.CACHE_CONTROL_HEADER, cacheString)
+		// Shared caches must not serve one format for another
+		w.Header().Add("Vary", "Accept")
+		w.Header().Set("ETag", etag)
+	}
+	if middleware.ETagMatches(r.Header.Get("If-None-Match"), etag) {
+		setHeaders()
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	logger.Info("Streaming prices from repository", "from", from, "to", to, "format", format)
+
+	var start func() error
+	var writeRow func(model.PriceHistoryEntry) error
+	var finish func() error
+	if format == mediaTypeCSV {
+		pw := newPriceCSVWriter(w, csvOpts)
+		start = func() error {
+			setCSVHeaders(w, "prices-"+query.Get("from")+"-"+query.Get("to")+".csv")
+			return pw.WriteHeader()
+		}
+		writeRow = pw.Write
+		finish = pw.Flush
+	} else {
+		jw := newJSONArrayWriter(w)
+		start = func() error {
+			w.Header().Set("Content-Type", "application/json")
+			return nil
+		}
+		writeRow = func(entry model.PriceHistoryEntry) error { return jw.Write(entry) }
+		finish = jw.Close
+	}
+
+	// Headers are sent with the first row, so a query failing before it still
+	// gets an error response
+	started := false
+	startOnce := func() error {
+		if started {
+			return nil
+		}
+		started = true
+		setHeaders()
+		return start()
+	}
+	err = res.priceRepository.StreamPrices(r.Context(), from, to, func(entry model.PriceHistoryEntry) error {
+		if err := startOnce(); err != nil {
+			return err
+		}
+		return writeRow(entry)
+	})
+	if err != nil && !started {
+		logger.Error("Error streaming prices", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+	if err == nil {
+		err = startOnce()
+	}
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		logger.Error("Error streaming prices", "error", err)
+		// Aborting tells the compression cache and proxies that the body is truncated
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// writePricesBinary sends prices in the compact layout of package pricebin.
+func writePricesBinary(w http.ResponseWriter, r *http.Request, prices []model.PriceHistoryEntry) {
+	logger := logging.FromContext(r.Context())
+	encoded, err := pricebin.FromEntries(prices)
+	if err != nil {
+		logger.Error("Error laying out binary prices", "error", err)
+		// The cache headers were set for the prices, not for this error
+		w.Header().Set(utils.CACHE_CONTROL_HEADER, "no-store")
+		w.Header().Del(utils.EXPIRES_HEADER)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", pricebin.MediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(encoded.Size()))
+	if err := pricebin.Encode(w, encoded); err != nil {
+		logger.Error("Error writing binary prices", "error", err)
+	}
+}
+
+func setCSVHeaders(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Type", mediaTypeCSV+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+}
+
+func loadHelsinki() *time.Location {
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		slog.Error("Error loading Europe/Helsinki", "error", err)
+		return time.UTC
+	}
+	return helsinki
+}
+
+// requestError is a validation error whose message is shown to the client as is.
+type requestError string
+
+func (e requestError) Error() string {
+	return string(e)
+}
+
+// parseDateRange parses an inclusive range of YYYY-MM-DD dates into the half-open
+// interval [from, to) of their days in loc.
+func parseDateRange(fromStr, toStr string, loc *time.Location) (time.Time, time.Time, error) {
+	fromDate, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, requestError("Invalid from date format. Use YYYY-MM-DD")
+	}
+	toDate, err := time.Parse("2006-01-02", toStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, requestError("Invalid to date format. Use YYYY-MM-DD")
+	}
+	if toDate.Before(fromDate) {
+		return time.Time{}, time.Time{}, requestError("Invalid range. to must not be before from")
+	}
+	if toDate.Sub(fromDate) >= maxPriceRangeDays*24*time.Hour {
+		return time.Time{}, time.Time{}, requestError(fmt.Sprintf("Invalid range. At most %d days can be requested", maxPriceRangeDays))
+	}
+
+	from := time.Date(fromDate.Year(), fromDate.Month(), fromDate.Day(), 0, 0, 0, 0, loc)
+	to := time.Date(toDate.Year(), toDate.Month(), toDate.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	return from, to, nil
 }
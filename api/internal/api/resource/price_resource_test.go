@@ -3,41 +3,25 @@ package resource
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/samlof/ehin/internal/api/problem"
 	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/logging"
 	"github.com/samlof/ehin/internal/nordpool"
+	"github.com/samlof/ehin/internal/pricebin"
 	"github.com/samlof/ehin/internal/service"
+	"github.com/samlof/ehin/internal/testutil"
 	"github.com/samlof/ehin/internal/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
-type MockPriceRepository struct {
-	mock.Mock
-}
-
-func (m *MockPriceRepository) Select1(ctx context.Context) error {
-	args := m.Called(ctx)
-	return args.Error(0)
-}
-
-func (m *MockPriceRepository) GetPrices(ctx context.Context, from, to time.Time) ([]model.PriceHistoryEntry, error) {
-	args := m.Called(ctx, from, to)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).([]model.PriceHistoryEntry), args.Error(1)
-}
-
-func (m *MockPriceRepository) InsertPrices(ctx context.Context, entries []model.PriceHistoryEntry) (int64, error) {
-	args := m.Called(ctx, entries)
-	return args.Get(0).(int64), args.Error(1)
-}
-
 type MockTimeProvider struct {
 	mock.Mock
 }
@@ -52,7 +36,7 @@ type MockNordPoolClient struct {
 	mock.Mock
 }
 
-func (m *MockNordPoolClient) GetDayAheadPrices(date time.Time, market, deliveryArea, currency string) (*nordpool.PriceDataResponse, error) {
+func (m *MockNordPoolClient) GetDayAheadPrices(ctx context.Context, date time.Time, market, deliveryArea, currency string) (*nordpool.PriceDataResponse, error) {
 	args := m.Called(date, market, deliveryArea, currency)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -152,9 +136,9 @@ func TestPriceResource_GetPastPrices(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockRepo := new(MockPriceRepository)
+			mockRepo := new(testutil.MockPriceRepository)
 			mockTime := new(MockTimeProvider)
-			res := NewPriceResource(mockRepo, nil, mockTime, "secret")
+			res := NewPriceResource(mockRepo, nil, mockTime)
 
 			req := httptest.NewRequest("GET", "/api/prices/"+tt.dateStr, nil)
 			req.SetPathValue("date", tt.dateStr)
@@ -195,23 +179,15 @@ func TestPriceResource_GetPastPrices(t *testing.T) {
 }
 
 func TestPriceResource_UpdatePrices(t *testing.T) {
-	password := "secret"
-	mockRepo := new(MockPriceRepository)
+	mockRepo := new(testutil.MockPriceRepository)
 	mockClient := new(MockNordPoolClient)
 	mockTime := new(MockTimeProvider)
 	pricesService := service.NewPricesService(mockClient, mockTime)
-	res := NewPriceResource(mockRepo, pricesService, mockTime, password)
+	res := NewPriceResource(mockRepo, pricesService, mockTime)
 
 	now := time.Date(2023, 10, 27, 10, 0, 0, 0, time.UTC)
 	tomorrow := now.AddDate(0, 0, 1)
 
-	t.Run("Wrong Password", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/update-prices?p=wrong", nil)
-		rr := httptest.NewRecorder()
-		res.UpdatePrices(rr, req)
-		assert.Equal(t, http.StatusNotFound, rr.Code)
-	})
-
 	t.Run("Success", func(t *testing.T) {
 		mockTime.On("Now").Return(now).Once()
 		nordPoolResp := &nordpool.PriceDataResponse{
@@ -231,7 +207,7 @@ func TestPriceResource_UpdatePrices(t *testing.T) {
 		mockClient.On("GetDayAheadPrices", tomorrow, "DayAhead", "FI", "EUR").Return(nordPoolResp, nil).Once()
 		mockRepo.On("InsertPrices", mock.Anything, mock.Anything).Return(int64(1), nil).Once()
 
-		req := httptest.NewRequest("GET", "/api/update-prices?p="+password, nil)
+		req := httptest.NewRequest("GET", "/api/update-prices", nil)
 		rr := httptest.NewRecorder()
 		res.UpdatePrices(rr, req)
 
@@ -246,7 +222,7 @@ func TestPriceResource_UpdatePrices(t *testing.T) {
 		mockTime.On("Now").Return(now).Once()
 		mockClient.On("GetDayAheadPrices", tomorrow, "DayAhead", "FI", "EUR").Return(nil, nil).Once()
 
-		req := httptest.NewRequest("GET", "/api/update-prices?p="+password, nil)
+		req := httptest.NewRequest("GET", "/api/update-prices", nil)
 		rr := httptest.NewRecorder()
 		res.UpdatePrices(rr, req)
 
@@ -259,12 +235,11 @@ func TestPriceResource_UpdatePrices(t *testing.T) {
 }
 
 func TestPriceResource_UpdatePricesForDate(t *testing.T) {
-	password := "secret"
-	mockRepo := new(MockPriceRepository)
+	mockRepo := new(testutil.MockPriceRepository)
 	mockClient := new(MockNordPoolClient)
 	mockTime := new(MockTimeProvider)
 	pricesService := service.NewPricesService(mockClient, mockTime)
-	res := NewPriceResource(mockRepo, pricesService, mockTime, password)
+	res := NewPriceResource(mockRepo, pricesService, mockTime)
 
 	dateStr := "2023-10-30"
 	date, _ := time.Parse("2006-01-02", dateStr)
@@ -287,7 +262,7 @@ func TestPriceResource_UpdatePricesForDate(t *testing.T) {
 		mockClient.On("GetDayAheadPrices", date, "DayAhead", "FI", "EUR").Return(nordPoolResp, nil).Once()
 		mockRepo.On("InsertPrices", mock.Anything, mock.Anything).Return(int64(1), nil).Once()
 
-		req := httptest.NewRequest("GET", "/api/update-prices/"+dateStr+"?p="+password, nil)
+		req := httptest.NewRequest("GET", "/api/update-prices/"+dateStr+"", nil)
 		req.SetPathValue("date", dateStr)
 		rr := httptest.NewRecorder()
 		res.UpdatePricesForDate(rr, req)
@@ -299,3 +274,311 @@ func TestPriceResource_UpdatePricesForDate(t *testing.T) {
 		assert.True(t, resp.Done)
 	})
 }
+
+func TestPriceResource_GetPastPrices_CSV(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	mockRepo := new(testutil.MockPriceRepository)
+	mockTime := new(MockTimeProvider)
+	res := NewPriceResource(mockRepo, nil, mockTime)
+
+	dateWithTime := time.Date(2023, 10, 27, 0, 0, 0, 0, helsinki)
+	entries := []model.PriceHistoryEntry{
+		{Price: 10.5, DeliveryStart: dateWithTime, DeliveryEnd: dateWithTime.Add(time.Hour)},
+	}
+	mockRepo.On("GetPrices", mock.Anything, dateWithTime.AddDate(0, 0, -1), dateWithTime.AddDate(0, 0, 3)).Return(entries, nil)
+	mockTime.On("Now").Return(time.Date(2023, 10, 27, 12, 0, 0, 0, time.UTC))
+
+	req := httptest.NewRequest("GET", "/api/prices/2023-10-27?decimal=comma", nil)
+	req.Header.Set("Accept", "text/csv")
+	req.SetPathValue("date", "2023-10-27")
+	rr := httptest.NewRecorder()
+	res.GetPastPrices(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="prices-2023-10-27.csv"`, rr.Header().Get("Content-Disposition"))
+	assert.Equal(t, "start;end;price_eur_mwh\n2023-10-27 00:00;2023-10-27 01:00;10,50\n", rr.Body.String())
+	assert.Equal(t, []string{"Accept"}, rr.Header().Values("Vary"))
+}
+
+func TestPriceResource_GetPastPrices_Binary(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	mockRepo := new(testutil.MockPriceRepository)
+	mockTime := new(MockTimeProvider)
+	res := NewPriceResource(mockRepo, nil, mockTime)
+
+	dateWithTime := time.Date(2025, 10, 27, 0, 0, 0, 0, helsinki)
+	entries := quarterHourEntries(dateWithTime.AddDate(0, 0, -1), 196, func(i int) float64 { return float64(i)*1.37 - 20.12 })
+	mockRepo.On("GetPrices", mock.Anything, dateWithTime.AddDate(0, 0, -1), dateWithTime.AddDate(0, 0, 3)).Return(entries, nil)
+	mockTime.On("Now").Return(time.Date(2025, 10, 27, 12, 0, 0, 0, time.UTC))
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/prices/2025-10-27", nil)
+		req.Header.Set("Accept", accept)
+		req.SetPathValue("date", "2025-10-27")
+		rr := httptest.NewRecorder()
+		res.GetPastPrices(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Header().Values("Vary"), "Accept")
+		return rr
+	}
+
+	var fromJSON []model.PriceHistoryEntry
+	assert.NoError(t, json.NewDecoder(get("application/json").Body).Decode(&fromJSON))
+
+	rr := get(pricebin.MediaType)
+	assert.Equal(t, pricebin.MediaType, rr.Header().Get("Content-Type"))
+	assert.Equal(t, strconv.Itoa(18+2*196), rr.Header().Get("Content-Length"))
+	decoded, err := pricebin.Decode(rr.Body)
+	assert.NoError(t, err)
+	fromBinary := decoded.Entries()
+
+	assert.Len(t, fromBinary, len(fromJSON))
+	for i := range fromJSON {
+		assert.True(t, fromJSON[i].DeliveryStart.Equal(fromBinary[i].DeliveryStart), i)
+		assert.True(t, fromJSON[i].DeliveryEnd.Equal(fromBinary[i].DeliveryEnd), i)
+		assert.InDelta(t, fromJSON[i].Price, fromBinary[i].Price, 0.05+1e-9, i)
+	}
+}
+
+func TestPriceResource_GetPastPrices_BinaryError(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	mockRepo := new(testutil.MockPriceRepository)
+	mockTime := new(MockTimeProvider)
+	res := NewPriceResource(mockRepo, nil, mockTime)
+
+	dateWithTime := time.Date(2025, 10, 27, 0, 0, 0, 0, helsinki)
+	entries := quarterHourEntries(dateWithTime.AddDate(0, 0, -1), 4*96, func(i int) float64 { return 1 })
+	// The binary layout has no slots shorter than a minute
+	entries[0].DeliveryEnd = entries[0].DeliveryStart.Add(30 * time.Second)
+	mockRepo.On("GetPrices", mock.Anything, dateWithTime.AddDate(0, 0, -1), dateWithTime.AddDate(0, 0, 3)).Return(entries, nil)
+	mockTime.On("Now").Return(time.Date(2025, 11, 1, 12, 0, 0, 0, time.UTC))
+
+	req := httptest.NewRequest("GET", "/api/prices/2025-10-27", nil)
+	req.Header.Set("Accept", pricebin.MediaType)
+	req.SetPathValue("date", "2025-10-27")
+	rr := httptest.NewRecorder()
+	res.GetPastPrices(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "no-store", rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+	assert.Empty(t, rr.Header().Get(utils.EXPIRES_HEADER))
+}
+
+func TestPriceResource_GetPriceRange(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, helsinki)
+	to := time.Date(2024, 1, 3, 0, 0, 0, 0, helsinki)
+	entries := []model.PriceHistoryEntry{
+		{Price: 10.5, DeliveryStart: from, DeliveryEnd: from.Add(time.Hour)},
+		{Price: -1.25, DeliveryStart: from.Add(time.Hour), DeliveryEnd: from.Add(2 * time.Hour)},
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		mockRepo := new(testutil.MockPriceRepository)
+		mockTime := new(MockTimeProvider)
+		res := NewPriceResource(mockRepo, nil, mockTime)
+		mockRepo.On("GetCoverage", mock.Anything, from, to).Return(48*time.Hour, nil)
+		mockRepo.On("StreamPrices", mock.Anything, from, to).Return(entries, nil)
+		mockTime.On("Now").Return(now)
+
+		req := httptest.NewRequest("GET", "/api/prices?from=2024-01-01&to=2024-01-02", nil)
+		rr := httptest.NewRecorder()
+		res.GetPriceRange(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.Equal(t, utils.CACHE_LONG, rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+		assert.Equal(t, []string{"Accept"}, rr.Header().Values("Vary"))
+
+		var prices []model.PriceHistoryEntry
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&prices))
+		assert.Len(t, prices, 2)
+		assert.Equal(t, -1.25, prices[1].Price)
+	})
+
+	t.Run("JSON Empty", func(t *testing.T) {
+		mockRepo := new(testutil.MockPriceRepository)
+		mockTime := new(MockTimeProvider)
+		res := NewPriceResource(mockRepo, nil, mockTime)
+		mockRepo.On("GetCoverage", mock.Anything, from, to).Return(time.Duration(0), nil)
+		mockRepo.On("StreamPrices", mock.Anything, from, to).Return(nil, nil)
+		mockTime.On("Now").Return(time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC))
+
+		req := httptest.NewRequest("GET", "/api/prices?from=2024-01-01&to=2024-01-02", nil)
+		rr := httptest.NewRecorder()
+		res.GetPriceRange(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, utils.CACHE_VAR+", max-age=60", rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+		assert.Equal(t, "[]\n", rr.Body.String())
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		mockRepo := new(testutil.MockPriceRepository)
+		mockTime := new(MockTimeProvider)
+		res := NewPriceResource(mockRepo, nil, mockTime)
+		// Missing slots of past days may still be backfilled
+		mockRepo.On("GetCoverage", mock.Anything, from, to).Return(2*time.Hour, nil)
+		mockRepo.On("StreamPrices", mock.Anything, from, to).Return(entries, nil)
+		mockTime.On("Now").Return(now)
+
+		req := httptest.NewRequest("GET", "/api/prices?from=2024-01-01&to=2024-01-02&format=csv&tz=utc&vat=25.5", nil)
+		rr := httptest.NewRecorder()
+		res.GetPriceRange(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Equal(t, utils.CACHE_VAR+", max-age=60", rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+		assert.Equal(t, []string{"Accept"}, rr.Header().Values("Vary"))
+		expected := "start,end,price_eur_mwh,price_eur_mwh_vat\n" +
+			"2023-12-31T22:00:00Z,2023-12-31T23:00:00Z,10.50,13.18\n" +
+			"2023-12-31T23:00:00Z,2024-01-01T00:00:00Z,-1.25,-1.57\n"
+		assert.Equal(t, expected, rr.Body.String())
+	})
+
+	t.Run("Not Modified", func(t *testing.T) {
+		mockRepo := new(testutil.MockPriceRepository)
+		mockTime := new(MockTimeProvider)
+		res := NewPriceResource(mockRepo, nil, mockTime)
+		mockRepo.On("GetCoverage", mock.Anything, from, to).Return(48*time.Hour, nil).Twice()
+		mockRepo.On("StreamPrices", mock.Anything, from, to).Return(entries, nil).Once()
+		mockTime.On("Now").Return(now)
+
+		rr := httptest.NewRecorder()
+		res.GetPriceRange(rr, httptest.NewRequest("GET", "/api/prices?from=2024-01-01&to=2024-01-02", nil))
+		etag := rr.Header().Get("ETag")
+		assert.NotEmpty(t, etag)
+
+		req := httptest.NewRequest("GET", "/api/prices?from=2024-01-01&to=2024-01-02", nil)
+		req.Header.Set("If-None-Match", etag)
+		rr = httptest.NewRecorder()
+		res.GetPriceRange(rr, req)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Equal(t, utils.CACHE_LONG, rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+		assert.Empty(t, rr.Body.String())
+		mockRepo.AssertExpectations(t)
+
+		// Prices added to the range change the tag
+		mockRepo.On("GetCoverage", mock.Anything, from, to).Return(47*time.Hour, nil)
+		mockRepo.On("StreamPrices", mock.Anything, from, to).Return(entries, nil)
+		rr = httptest.NewRecorder()
+		res.GetPriceRange(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+	})
+
+	t.Run("Query Error", func(t *testing.T) {
+		mockRepo := new(testutil.MockPriceRepository)
+		mockTime := new(MockTimeProvider)
+		res := NewPriceResource(mockRepo, nil, mockTime)
+		mockRepo.On("GetCoverage", mock.Anything, from, to).Return(48*time.Hour, nil)
+		mockRepo.On("StreamPrices", mock.Anything, from, to).Return(nil, errors.New("connection reset"))
+		mockTime.On("Now").Return(now)
+
+		for _, url := range []string{"/api/prices?from=2024-01-01&to=2024-01-02", "/api/prices?from=2024-01-01&to=2024-01-02&format=csv"} {
+			rr := httptest.NewRecorder()
+			res.GetPriceRange(rr, httptest.NewRequest("GET", url, nil))
+			assert.Equal(t, http.StatusInternalServerError, rr.Code, url)
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"), url)
+			assert.Empty(t, rr.Header().Get(utils.CACHE_CONTROL_HEADER), url)
+		}
+	})
+
+	t.Run("Error After First Row", func(t *testing.T) {
+		mockRepo := new(testutil.MockPriceRepository)
+		mockTime := new(MockTimeProvider)
+		res := NewPriceResource(mockRepo, nil, mockTime)
+		mockRepo.On("GetCoverage", mock.Anything, from, to).Return(48*time.Hour, nil)
+		mockRepo.On("StreamPrices", mock.Anything, from, to).Return(entries, errors.New("connection reset"))
+		mockTime.On("Now").Return(now)
+
+		rr := httptest.NewRecorder()
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			res.GetPriceRange(rr, httptest.NewRequest("GET", "/api/prices?from=2024-01-01&to=2024-01-02", nil))
+		})
+	})
+
+	t.Run("Invalid Requests", func(t *testing.T) {
+		res := NewPriceResource(new(testutil.MockPriceRepository), nil, new(MockTimeProvider))
+		for _, url := range []string{
+			"/api/prices",
+			"/api/prices?from=2024-01-01",
+			"/api/prices?from=2024-01-02&to=2024-01-01",
+			"/api/prices?from=2024-01-01&to=2025-01-01",
+			"/api/prices?from=2024-01-01&to=2024-01-02&format=xml",
+			"/api/prices?from=2024-01-01&to=2024-01-02&format=bin",
+			"/api/prices?from=2024-01-01&to=2024-01-02&format=csv&decimal=x",
+		} {
+			rr := httptest.NewRecorder()
+			res.GetPriceRange(rr, httptest.NewRequest("GET", url, nil))
+			assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"), url)
+		}
+	})
+}
+
+func TestPriceResource_ProblemDetails(t *testing.T) {
+	res := NewPriceResource(new(testutil.MockPriceRepository), nil, new(MockTimeProvider))
+
+	req := httptest.NewRequest("GET", "/api/prices/tomorrow", nil)
+	req.SetPathValue("date", "tomorrow")
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-1"))
+	rr := httptest.NewRecorder()
+	res.GetPastPrices(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	var details problem.Details
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&details))
+	assert.Equal(t, problem.Details{
+		Type:      problem.TypeBlank,
+		Title:     "Bad Request",
+		Status:    http.StatusBadRequest,
+		Detail:    "Invalid date format. Use YYYY-MM-DD",
+		Instance:  "/api/prices/tomorrow",
+		RequestID: "req-1",
+	}, details)
+}
+
+type recordingListener struct {
+	calls [][]model.PriceHistoryEntry
+}
+
+func (l *recordingListener) PricesIngested(_ context.Context, area string, entries []model.PriceHistoryEntry) {
+	l.calls = append(l.calls, entries)
+}
+
+func TestPriceResource_UpdatePrices_NotifiesListeners(t *testing.T) {
+	mockRepo := new(testutil.MockPriceRepository)
+	mockClient := new(MockNordPoolClient)
+	mockTime := new(MockTimeProvider)
+	pricesService := service.NewPricesService(mockClient, mockTime)
+	res := NewPriceResource(mockRepo, pricesService, mockTime)
+	listener := &recordingListener{}
+	res.AddListener(listener)
+
+	now := time.Date(2023, 10, 27, 10, 0, 0, 0, time.UTC)
+	tomorrow := now.AddDate(0, 0, 1)
+	mockTime.On("Now").Return(now)
+	mockClient.On("GetDayAheadPrices", tomorrow, "DayAhead", "FI", "EUR").Return(&nordpool.PriceDataResponse{
+		Market:     "DayAhead",
+		Currency:   "EUR",
+		AreaStates: []nordpool.AreaState{{State: "Final", Areas: []string{"FI"}}},
+		MultiAreaEntries: []nordpool.MultiAreaEntry{
+			{DeliveryStart: tomorrow, DeliveryEnd: tomorrow.Add(time.Hour), EntryPerArea: map[string]float64{"FI": 10.5}},
+		},
+	}, nil)
+
+	// First run stores the prices
+	mockRepo.On("InsertPrices", mock.Anything, mock.Anything).Return(int64(1), nil).Once()
+	res.UpdatePrices(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/update-prices", nil))
+	assert.Len(t, listener.calls, 1)
+	assert.Equal(t, 10.5, listener.calls[0][0].Price)
+
+	// Later cron runs find the prices already stored
+	mockRepo.On("InsertPrices", mock.Anything, mock.Anything).Return(int64(0), nil).Once()
+	res.UpdatePrices(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/update-prices", nil))
+	assert.Len(t, listener.calls, 1)
+}
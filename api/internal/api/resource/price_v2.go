@@ -0,0 +1,156 @@
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/service"
+	"github.com/samlof/ehin/internal/utils"
+)
+
+const (
+	priceCurrency = "EUR"
+	priceUnit     = "EUR/MWh"
+)
+
+// PriceV2 is one delivery slot in the v2 API.
+type PriceV2 struct {
+	Price    float64   `json:"price"`
+	Unit     string    `json:"unit"`
+	Currency string    `json:"currency"`
+	Area     string    `json:"area"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	// ISO 8601 duration of the slot, e.g. PT15M
+	Resolution string `json:"resolution"`
+	// Only final prices are stored, preliminary ones are never returned
+	Final bool `json:"final"`
+}
+
+type PricesV2Meta struct {
+	Area     string `json:"area"`
+	Timezone string `json:"timezone"`
+	// Start of the first and end of the last requested day
+	From         time.Time            `json:"from"`
+	To           time.Time            `json:"to"`
+	Completeness PricesV2Completeness `json:"completeness"`
+}
+
+// PricesV2Completeness tells whether prices cover every requested day.
+// Days without prices yet, such as tomorrow before 14:00, are incomplete.
+type PricesV2Completeness struct {
+	Complete bool `json:"complete"`
+	Slots    int  `json:"slots"`
+	// YYYY-MM-DD dates whose slots don't cover the whole day
+	IncompleteDays []string `json:"incompleteDays"`
+}
+
+type PricesV2Response struct {
+	Meta PricesV2Meta `json:"meta"`
+	Data []PriceV2    `json:"data"`
+}
+
+// GetPricesV2 handles GET /api/v2/prices?from=YYYY-MM-DD&to=YYYY-MM-DD&area=FI.
+// The range is inclusive and defaults to today and tomorrow in Helsinki time.
+// Unlike v1, every slot spells out its unit, currency and area.
+func (res *PriceResource) GetPricesV2(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	query := r.URL.Query()
+	helsinki := loadHelsinki()
+	now := res.dateService.Now().In(helsinki)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, helsinki)
+
+	area := service.DefaultArea
+	if v := query.Get("area"); v != "" {
+		var ok bool
+		if area, ok = service.NormalizeArea(v); !ok {
+			problem.NotFound(w, r, "Unknown area")
+			return
+		}
+	}
+
+	from, to := today, today.AddDate(0, 0, 2)
+	if query.Has("from") || query.Has("to") {
+		var err error
+		from, to, err = parseDateRange(query.Get("from"), query.Get("to"), helsinki)
+		if err != nil {
+			problem.BadRequest(w, r, err.Error())
+			return
+		}
+	}
+
+	if res.priceRepository == nil {
+		logger.Warn("Price repository not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return
+	}
+
+	prices, err := res.priceRepository.GetPrices(r.Context(), from, to)
+	if err != nil {
+		logger.Error("Error fetching prices from repository", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	resp := PricesV2Response{
+		Meta: PricesV2Meta{
+			Area:         area,
+			Timezone:     helsinki.String(),
+			From:         from,
+			To:           to,
+			Completeness: completeness(prices, from, to),
+		},
+		Data: make([]PriceV2, len(prices)),
+	}
+	for i, p := range prices {
+		resp.Data[i] = toPriceV2(p, area)
+	}
+
+	// Complete ranges that ended before today can't change anymore
+	cacheString := utils.CACHE_VAR + ", max-age=60"
+	if !to.After(today) && resp.Meta.Completeness.Complete {
+		cacheString = utils.CACHE_LONG
+	}
+	w.Header().Set(utils.CACHE_CONTROL_HEADER, cacheString)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Error encoding prices", "error", err)
+	}
+}
+
+func toPriceV2(p model.PriceHistoryEntry, area string) PriceV2 {
+	return PriceV2{
+		Price:      p.Price,
+		Unit:       priceUnit,
+		Currency:   priceCurrency,
+		Area:       area,
+		Start:      p.DeliveryStart,
+		End:        p.DeliveryEnd,
+		Resolution: service.ISODuration(p.DeliveryEnd.Sub(p.DeliveryStart)),
+		Final:      true,
+	}
+}
+
+// completeness checks that the slots of each day between from and to add up to
+// the length of the day, so it works with hourly and 15 minute prices and on
+// DST days. prices must be sorted by start time.
+func completeness(prices []model.PriceHistoryEntry, from, to time.Time) PricesV2Completeness {
+	c := PricesV2Completeness{Slots: len(prices), IncompleteDays: []string{}}
+	i := 0
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		var covered time.Duration
+		for ; i < len(prices) && prices[i].DeliveryStart.Before(next); i++ {
+			covered += prices[i].DeliveryEnd.Sub(prices[i].DeliveryStart)
+		}
+		if covered < next.Sub(day) {
+			c.IncompleteDays = append(c.IncompleteDays, day.Format("2006-01-02"))
+		}
+	}
+	c.Complete = len(c.IncompleteDays) == 0
+	return c
+}
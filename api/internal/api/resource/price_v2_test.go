@@ -0,0 +1,107 @@
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/samlof/ehin/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPriceResource_GetPricesV2(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	today := time.Date(2025, 10, 25, 0, 0, 0, 0, helsinki)
+	now := today.Add(10 * time.Hour)
+
+	t.Run("Defaults to today and tomorrow", func(t *testing.T) {
+		// Tomorrow's prices aren't out yet
+		entries := quarterHourEntries(today, 96, func(i int) float64 { return 12.5 })
+		mockRepo := new(testutil.MockPriceRepository)
+		mockTime := new(MockTimeProvider)
+		mockRepo.On("GetPrices", mock.Anything, today, today.AddDate(0, 0, 2)).Return(entries, nil)
+		mockTime.On("Now").Return(now)
+		res := NewPriceResource(mockRepo, nil, mockTime)
+
+		rr := httptest.NewRecorder()
+		res.GetPricesV2(rr, httptest.NewRequest("GET", "/api/v2/prices?area=fi", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, utils.CACHE_VAR+", max-age=60", rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+		var body PricesV2Response
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+
+		assert.Equal(t, "FI", body.Meta.Area)
+		assert.Equal(t, "Europe/Helsinki", body.Meta.Timezone)
+		assert.True(t, body.Meta.From.Equal(today))
+		assert.Equal(t, PricesV2Completeness{Complete: false, Slots: 96, IncompleteDays: []string{"2025-10-26"}}, body.Meta.Completeness)
+
+		assert.Len(t, body.Data, 96)
+		first := body.Data[0]
+		assert.Equal(t, 12.5, first.Price)
+		assert.Equal(t, "EUR/MWh", first.Unit)
+		assert.Equal(t, "EUR", first.Currency)
+		assert.Equal(t, "FI", first.Area)
+		assert.Equal(t, "PT15M", first.Resolution)
+		assert.True(t, first.Final)
+		assert.True(t, first.Start.Equal(today))
+		assert.True(t, first.End.Equal(today.Add(15*time.Minute)))
+	})
+
+	t.Run("Same body on every request", func(t *testing.T) {
+		// The ETag is a hash of the body, so it must not depend on the request time
+		entries := quarterHourEntries(today, 96, func(i int) float64 { return 12.5 })
+		mockRepo := new(testutil.MockPriceRepository)
+		mockRepo.On("GetPrices", mock.Anything, today, today.AddDate(0, 0, 2)).Return(entries, nil)
+
+		var bodies []string
+		for _, at := range []time.Time{now, now.Add(time.Minute)} {
+			mockTime := new(MockTimeProvider)
+			mockTime.On("Now").Return(at)
+			rr := httptest.NewRecorder()
+			NewPriceResource(mockRepo, nil, mockTime).GetPricesV2(rr, httptest.NewRequest("GET", "/api/v2/prices", nil))
+			bodies = append(bodies, rr.Body.String())
+		}
+		assert.Equal(t, bodies[0], bodies[1])
+	})
+
+	t.Run("Complete past range", func(t *testing.T) {
+		// 2025-10-26 is the 25 hour DST day
+		from := time.Date(2025, 10, 26, 0, 0, 0, 0, helsinki)
+		mockRepo := new(testutil.MockPriceRepository)
+		mockTime := new(MockTimeProvider)
+		mockRepo.On("GetPrices", mock.Anything, from, from.AddDate(0, 0, 1)).Return(quarterHourEntries(from, 100, func(i int) float64 { return 1 }), nil)
+		mockTime.On("Now").Return(time.Date(2025, 11, 1, 0, 0, 0, 0, helsinki))
+		res := NewPriceResource(mockRepo, nil, mockTime)
+
+		rr := httptest.NewRecorder()
+		res.GetPricesV2(rr, httptest.NewRequest("GET", "/api/v2/prices?from=2025-10-26&to=2025-10-26", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, utils.CACHE_LONG, rr.Header().Get(utils.CACHE_CONTROL_HEADER))
+		var body PricesV2Response
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+		assert.Equal(t, PricesV2Completeness{Complete: true, Slots: 100, IncompleteDays: []string{}}, body.Meta.Completeness)
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		mockTime := new(MockTimeProvider)
+		mockTime.On("Now").Return(now)
+		res := NewPriceResource(new(testutil.MockPriceRepository), nil, mockTime)
+		for url, status := range map[string]int{
+			"/api/v2/prices?area=SE3":                                http.StatusNotFound,
+			"/api/v2/prices?from=2025-01-01":                         http.StatusBadRequest,
+			"/api/v2/prices?from=2025-01-02&to=2025-01-01":           http.StatusBadRequest,
+			"/api/v2/prices?from=2024-01-01&to=2025-01-01":           http.StatusBadRequest,
+			"/api/v2/prices?from=2025-01-01&to=2025-01-02&area=nope": http.StatusNotFound,
+		} {
+			rr := httptest.NewRecorder()
+			res.GetPricesV2(rr, httptest.NewRequest("GET", url, nil))
+			assert.Equal(t, status, rr.Code, url)
+		}
+	})
+}
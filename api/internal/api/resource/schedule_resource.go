@@ -0,0 +1,182 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/service"
+)
+
+type ScheduleResource struct {
+	priceRepository repository.PriceRepository
+	dateService     service.TimeProvider
+}
+
+func NewScheduleResource(priceRepository repository.PriceRepository, dateService service.TimeProvider) *ScheduleResource {
+	return &ScheduleResource{
+		priceRepository: priceRepository,
+		dateService:     dateService,
+	}
+}
+
+// ScheduleRequest describes a device that has to take energyKwh between
+// earliestStart, by default now, and deadline, by default a day later.
+type ScheduleRequest struct {
+	EnergyKWh     float64    `json:"energyKwh"`
+	MaxPowerKW    float64    `json:"maxPowerKw"`
+	EarliestStart *time.Time `json:"earliestStart"`
+	Deadline      *time.Time `json:"deadline"`
+	// Shortest time the device runs once started, 0 for no limit
+	MinRunMinutes int `json:"minRunMinutes"`
+	// Most times the device may be started, 0 for no limit
+	MaxStarts int `json:"maxStarts"`
+}
+
+// ScheduleResponse prices are in c/kWh and costs in euros.
+type ScheduleResponse struct {
+	From         time.Time      `json:"from"`
+	To           time.Time      `json:"to"`
+	Currency     string         `json:"currency"`
+	Unit         string         `json:"unit"`
+	VATPercent   float64        `json:"vatPercent"`
+	EnergyKWh    float64        `json:"energyKwh"`
+	Cost         float64        `json:"cost"`
+	AveragePrice float64        `json:"averagePrice"`
+	Starts       int            `json:"starts"`
+	Slots        []ScheduleSlot `json:"slots"`
+}
+
+type ScheduleSlot struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Price     float64   `json:"price"`
+	On        bool      `json:"on"`
+	PowerKW   float64   `json:"powerKw"`
+	EnergyKWh float64   `json:"energyKwh"`
+	Cost      float64   `json:"cost"`
+}
+
+// Optimize handles POST /api/schedule?vat=25.5. It returns the cheapest
+// schedule in 15 minute slots for running a device under the constraints of
+// a ScheduleRequest with the stored prices.
+func (res *ScheduleResource) Optimize(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	vatPercent, err := parseVATPercent(r.URL.Query().Get("vat"))
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	var req ScheduleRequest
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.BadRequest(w, r, "Invalid JSON body")
+		return
+	}
+	constraints, err := res.parseConstraints(req)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	if res.priceRepository == nil {
+		logger.Warn("Price repository not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return
+	}
+
+	// From an hour earlier for an hourly slot that the window starts within
+	prices, err := res.priceRepository.GetPrices(r.Context(), constraints.Earliest.Add(-time.Hour), constraints.Deadline)
+	if err != nil {
+		logger.Error("Error fetching prices", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	schedule, err := service.OptimizeSchedule(prices, constraints)
+	if errors.Is(err, service.ErrScheduleInfeasible) {
+		problem.Write(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		logger.Error("Error optimizing schedule", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	vat := 1 + vatPercent/100
+	resp := ScheduleResponse{
+		From:       schedule.Slots[0].Start,
+		To:         schedule.Slots[len(schedule.Slots)-1].End,
+		Currency:   "EUR",
+		Unit:       "c/kWh",
+		VATPercent: vatPercent,
+		EnergyKWh:  round(schedule.EnergyKWh, 3),
+		Cost:       round(schedule.Cost*vat, 4),
+		Starts:     schedule.Starts,
+		Slots:      make([]ScheduleSlot, len(schedule.Slots)),
+	}
+	if schedule.EnergyKWh > 0 {
+		resp.AveragePrice = round(schedule.Cost*vat*100/schedule.EnergyKWh, 3)
+	}
+	for i, s := range schedule.Slots {
+		resp.Slots[i] = ScheduleSlot{
+			Start: s.Start,
+			End:   s.End,
+			// EUR/MWh to c/kWh
+			Price:     round(s.Price*vat/10, 3),
+			On:        s.PowerKW > 0,
+			PowerKW:   round(s.PowerKW, 3),
+			EnergyKWh: round(s.EnergyKWh(), 3),
+			Cost:      round(s.Price*vat/1000*s.EnergyKWh(), 4),
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (res *ScheduleResource) parseConstraints(req ScheduleRequest) (service.ScheduleConstraints, error) {
+	c := service.ScheduleConstraints{
+		EnergyKWh:  req.EnergyKWh,
+		MaxPowerKW: req.MaxPowerKW,
+		MaxStarts:  req.MaxStarts,
+	}
+	if c.EnergyKWh <= 0 {
+		return c, errors.New("invalid energyKwh. Use a positive number of kWh")
+	}
+	if c.MaxPowerKW <= 0 {
+		return c, errors.New("invalid maxPowerKw. Use a positive number of kW")
+	}
+	// Checked before converting, which would overflow for huge values
+	if req.MinRunMinutes < 0 || req.MinRunMinutes > int(service.MaxScheduleMinRun/time.Minute) {
+		return c, fmt.Errorf("invalid minRunMinutes. Use at most %d minutes", int(service.MaxScheduleMinRun.Minutes()))
+	}
+	c.MinRun = time.Duration(req.MinRunMinutes) * time.Minute
+	if c.MaxStarts < 0 || c.MaxStarts > service.MaxScheduleStarts {
+		return c, fmt.Errorf("invalid maxStarts. Use 0 for no limit or at most %d", service.MaxScheduleStarts)
+	}
+
+	if req.EarliestStart != nil {
+		c.Earliest = *req.EarliestStart
+	} else {
+		c.Earliest = res.dateService.Now()
+	}
+	c.Deadline = c.Earliest.Add(24 * time.Hour)
+	if req.Deadline != nil {
+		c.Deadline = *req.Deadline
+	}
+	if !c.Deadline.After(c.Earliest) {
+		return c, errors.New("invalid deadline. It must be after earliestStart")
+	}
+	if c.Deadline.Sub(c.Earliest) > service.MaxScheduleWindow {
+		return c, fmt.Errorf("invalid deadline. Schedule at most %d hours at a time", int(service.MaxScheduleWindow.Hours()))
+	}
+	return c, nil
+}
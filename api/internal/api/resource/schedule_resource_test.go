@@ -0,0 +1,109 @@
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var scheduleStart = time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestScheduleResource() *ScheduleResource {
+	prices := []float64{50, 10, 40, 20, 30, 15, 60, 35}
+	mockRepo := new(testutil.MockPriceRepository)
+	mockRepo.On("GetPrices", mock.Anything, mock.Anything, mock.Anything).
+		Return(quarterHourEntries(scheduleStart, len(prices), func(i int) float64 { return prices[i] }), nil)
+	mockTime := new(MockTimeProvider)
+	mockTime.On("Now").Return(scheduleStart)
+	return NewScheduleResource(mockRepo, mockTime)
+}
+
+func TestScheduleResource_Optimize(t *testing.T) {
+	res := newTestScheduleResource()
+
+	rr := httptest.NewRecorder()
+	body := `{"energyKwh":1.5,"maxPowerKw":2,"earliestStart":"2025-11-01T00:00:00Z","deadline":"2025-11-01T02:00:00Z"}`
+	res.Optimize(rr, httptest.NewRequest("POST", "/api/schedule?vat=25.5", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	var resp ScheduleResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, 1.5, resp.EnergyKWh)
+	assert.Equal(t, 3, resp.Starts)
+	// 0.5 kWh at 10, 20 and 15 EUR/MWh with VAT
+	assert.Equal(t, 0.0282, resp.Cost)
+	assert.InDelta(t, 1.8825, resp.AveragePrice, 0.001)
+	require.Len(t, resp.Slots, 8)
+	var on []int
+	for i, s := range resp.Slots {
+		if s.On {
+			on = append(on, i)
+			assert.Equal(t, 2.0, s.PowerKW)
+			assert.Equal(t, 0.5, s.EnergyKWh)
+		}
+	}
+	assert.Equal(t, []int{1, 3, 5}, on)
+	assert.Equal(t, 1.255, resp.Slots[1].Price)
+	assert.True(t, resp.From.Equal(scheduleStart))
+	assert.True(t, resp.To.Equal(scheduleStart.Add(2*time.Hour)))
+}
+
+func TestScheduleResource_Optimize_DefaultWindow(t *testing.T) {
+	res := newTestScheduleResource()
+
+	rr := httptest.NewRecorder()
+	body := `{"energyKwh":2,"maxPowerKw":2,"minRunMinutes":30,"maxStarts":2}`
+	res.Optimize(rr, httptest.NewRequest("POST", "/api/schedule", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp ScheduleResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, 2, resp.Starts)
+	assert.Equal(t, 2.0, resp.EnergyKWh)
+}
+
+func TestScheduleResource_Optimize_Errors(t *testing.T) {
+	res := newTestScheduleResource()
+
+	for _, tc := range []struct {
+		name   string
+		body   string
+		status int
+		detail string
+	}{
+		{"Invalid JSON", `{`, http.StatusBadRequest, "Invalid JSON body"},
+		{"No energy", `{"maxPowerKw":2}`, http.StatusBadRequest, "invalid energyKwh. Use a positive number of kWh"},
+		{"No power", `{"energyKwh":2}`, http.StatusBadRequest, "invalid maxPowerKw. Use a positive number of kW"},
+		{"Long run", `{"energyKwh":2,"maxPowerKw":2,"minRunMinutes":400}`, http.StatusBadRequest, "invalid minRunMinutes. Use at most 360 minutes"},
+		{"Overflowing run", `{"energyKwh":2,"maxPowerKw":2,"minRunMinutes":153722867280912931}`, http.StatusBadRequest, "invalid minRunMinutes. Use at most 360 minutes"},
+		{"Many starts", `{"energyKwh":2,"maxPowerKw":2,"maxStarts":9}`, http.StatusBadRequest, "invalid maxStarts. Use 0 for no limit or at most 8"},
+		{"Deadline first", `{"energyKwh":2,"maxPowerKw":2,"deadline":"2025-10-31T00:00:00Z"}`, http.StatusBadRequest, "invalid deadline. It must be after earliestStart"},
+		{"Long window", `{"energyKwh":2,"maxPowerKw":2,"deadline":"2025-11-03T01:00:00Z"}`, http.StatusBadRequest, "invalid deadline. Schedule at most 48 hours at a time"},
+		{"Too much energy", `{"energyKwh":10,"maxPowerKw":2}`, http.StatusUnprocessableEntity, "no schedule meets the constraints: 10.00 kWh takes 20 slots at full power but only 8 have prices"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			res.Optimize(rr, httptest.NewRequest("POST", "/api/schedule", strings.NewReader(tc.body)))
+
+			assert.Equal(t, tc.status, rr.Code)
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+			var details problem.Details
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&details))
+			assert.Equal(t, tc.detail, details.Detail)
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	NewScheduleResource(nil, new(MockTimeProvider)).Optimize(rr, httptest.NewRequest("POST", "/api/schedule", strings.NewReader(`{"energyKwh":1,"maxPowerKw":2,"earliestStart":"2025-11-01T00:00:00Z"}`)))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
@@ -0,0 +1,182 @@
+package resource
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/webhook"
+)
+
+const deadLetterListLimit = 100
+
+// WebhookResource is the admin API for managing webhook subscriptions.
+// Callers are authenticated by middleware.
+type WebhookResource struct {
+	webhookRepository repository.WebhookRepository
+}
+
+func NewWebhookResource(webhookRepository repository.WebhookRepository) *WebhookResource {
+	return &WebhookResource{
+		webhookRepository: webhookRepository,
+	}
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Threshold in EUR/MWh, required for price.threshold events.
+	Threshold *float64 `json:"threshold"`
+	// Secret for signing deliveries. Generated when empty.
+	Secret string `json:"secret"`
+}
+
+// CreateSubscription handles POST /api/admin/webhooks.
+// The response is the only place the signing secret is returned.
+func (res *WebhookResource) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if !res.checkRepository(w, r) {
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		problem.BadRequest(w, r, "Invalid JSON body")
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		problem.BadRequest(w, r, "Invalid url. Use an absolute http or https URL")
+		return
+	}
+	if len(req.Events) == 0 {
+		problem.BadRequest(w, r, "At least one event is required")
+		return
+	}
+	for _, event := range req.Events {
+		if !slices.Contains(model.WebhookEvents, event) {
+			problem.BadRequest(w, r, "Unknown event "+strconv.Quote(event))
+			return
+		}
+	}
+	if slices.Contains(req.Events, model.WebhookEventPriceThreshold) && req.Threshold == nil {
+		problem.BadRequest(w, r, "threshold is required for "+model.WebhookEventPriceThreshold)
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		secret = webhook.NewSecret()
+	}
+	sub := model.WebhookSubscription{
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    slices.Compact(slices.Sorted(slices.Values(req.Events))),
+		Threshold: req.Threshold,
+	}
+	if err := res.webhookRepository.CreateSubscription(r.Context(), &sub); err != nil {
+		logger.Error("Error creating webhook subscription", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	logger.Info("Created webhook subscription", "id", sub.ID, "events", sub.Events)
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// ListSubscriptions handles GET /api/admin/webhooks. Secrets are not included.
+func (res *WebhookResource) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if !res.checkRepository(w, r) {
+		return
+	}
+
+	subs, err := res.webhookRepository.ListSubscriptions(r.Context())
+	if err != nil {
+		logger.Error("Error listing webhook subscriptions", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	if subs == nil {
+		subs = []model.WebhookSubscription{}
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+// DeleteSubscription handles DELETE /api/admin/webhooks/{id}.
+func (res *WebhookResource) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if !res.checkRepository(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		problem.BadRequest(w, r, "Invalid id")
+		return
+	}
+
+	deleted, err := res.webhookRepository.DeleteSubscription(r.Context(), id)
+	if err != nil {
+		logger.Error("Error deleting webhook subscription", "id", id, "error", err)
+		problem.Internal(w, r)
+		return
+	}
+	if !deleted {
+		problem.NotFound(w, r, "")
+		return
+	}
+
+	logger.Info("Deleted webhook subscription", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeadLetters handles GET /api/admin/webhooks/dead-letters.
+func (res *WebhookResource) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	if !res.checkRepository(w, r) {
+		return
+	}
+
+	deadLetters, err := res.webhookRepository.ListDeadLetters(r.Context(), deadLetterListLimit)
+	if err != nil {
+		logger.Error("Error listing webhook dead letters", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if deadLetters == nil {
+		deadLetters = []model.WebhookDeadLetter{}
+	}
+	writeJSON(w, http.StatusOK, deadLetters)
+}
+
+func (res *WebhookResource) checkRepository(w http.ResponseWriter, r *http.Request) bool {
+	logger := logging.FromContext(r.Context())
+	if res.webhookRepository == nil {
+		logger.Warn("Webhook repository not initialized")
+		problem.Write(w, r, http.StatusInternalServerError, "Database connection not available")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding response", "error", err)
+	}
+}
@@ -0,0 +1,137 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) CreateSubscription(ctx context.Context, sub *model.WebhookSubscription) error {
+	args := m.Called(ctx, sub)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ListSubscriptionsForEvent(ctx context.Context, event string) ([]model.WebhookSubscription, error) {
+	args := m.Called(ctx, event)
+	return args.Get(0).([]model.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookRepository) DeleteSubscription(ctx context.Context, id int64) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWebhookRepository) InsertDeadLetter(ctx context.Context, deadLetter model.WebhookDeadLetter) error {
+	args := m.Called(ctx, deadLetter)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ListDeadLetters(ctx context.Context, limit int) ([]model.WebhookDeadLetter, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).([]model.WebhookDeadLetter), args.Error(1)
+}
+
+func TestWebhookResource_CreateSubscription(t *testing.T) {
+	mockRepo := new(MockWebhookRepository)
+	res := NewWebhookResource(mockRepo)
+
+	mockRepo.On("CreateSubscription", mock.Anything, mock.AnythingOfType("*model.WebhookSubscription")).
+		Run(func(args mock.Arguments) {
+			sub := args.Get(1).(*model.WebhookSubscription)
+			sub.ID = 3
+			sub.Created = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		}).Return(nil).Once()
+
+	body := `{"url":"https://example.com/hook","events":["price.threshold","price.negative","price.negative"],"threshold":150}`
+	req := httptest.NewRequest("POST", "/api/admin/webhooks", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	res.CreateSubscription(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var sub model.WebhookSubscription
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&sub))
+	assert.Equal(t, int64(3), sub.ID)
+	assert.Equal(t, []string{"price.negative", "price.threshold"}, sub.Events)
+	assert.Equal(t, 150.0, *sub.Threshold)
+	assert.Len(t, sub.Secret, 64)
+}
+
+func TestWebhookResource_CreateSubscription_Invalid(t *testing.T) {
+	res := NewWebhookResource(new(MockWebhookRepository))
+
+	for _, body := range []string{
+		`not json`,
+		`{"url":"ftp://example.com","events":["price.negative"]}`,
+		`{"url":"/relative","events":["price.negative"]}`,
+		`{"url":"https://example.com","events":[]}`,
+		`{"url":"https://example.com","events":["price.unknown"]}`,
+		`{"url":"https://example.com","events":["price.threshold"]}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/admin/webhooks", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		res.CreateSubscription(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
+
+func TestWebhookResource_ListSubscriptions_HidesSecrets(t *testing.T) {
+	mockRepo := new(MockWebhookRepository)
+	res := NewWebhookResource(mockRepo)
+	mockRepo.On("ListSubscriptions", mock.Anything).Return([]model.WebhookSubscription{
+		{ID: 1, URL: "https://example.com", Secret: "hidden", Events: []string{"price.negative"}},
+	}, nil)
+
+	rr := httptest.NewRecorder()
+	res.ListSubscriptions(rr, httptest.NewRequest("GET", "/api/admin/webhooks", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "hidden")
+}
+
+func TestWebhookResource_DeleteSubscription(t *testing.T) {
+	mockRepo := new(MockWebhookRepository)
+	res := NewWebhookResource(mockRepo)
+	mockRepo.On("DeleteSubscription", mock.Anything, int64(1)).Return(true, nil)
+	mockRepo.On("DeleteSubscription", mock.Anything, int64(2)).Return(false, nil)
+
+	req := httptest.NewRequest("DELETE", "/api/admin/webhooks/1", nil)
+	req.SetPathValue("id", "1")
+	rr := httptest.NewRecorder()
+	res.DeleteSubscription(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	req = httptest.NewRequest("DELETE", "/api/admin/webhooks/2", nil)
+	req.SetPathValue("id", "2")
+	rr = httptest.NewRecorder()
+	res.DeleteSubscription(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestWebhookResource_ListDeadLetters(t *testing.T) {
+	mockRepo := new(MockWebhookRepository)
+	res := NewWebhookResource(mockRepo)
+	mockRepo.On("ListDeadLetters", mock.Anything, deadLetterListLimit).Return([]model.WebhookDeadLetter(nil), nil)
+
+	rr := httptest.NewRecorder()
+	res.ListDeadLetters(rr, httptest.NewRequest("GET", "/api/admin/webhooks/dead-letters", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "[]\n", rr.Body.String())
+}
@@ -0,0 +1,354 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/samlof/ehin/internal/api/middleware"
+	"github.com/samlof/ehin/internal/api/problem"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/events"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/service"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	// Client messages are small commands
+	wsMaxMessageSize = 4096
+	// Replies queued per connection. Connections that fall further behind are closed.
+	wsSendBuffer = 32
+)
+
+// WebSocket message types. Clients send subscribe, unsubscribe and prices.
+// The server replies with subscriptions, prices or error and pushes slot and
+// day events of the subscribed areas.
+const (
+	wsTypeSubscribe     = "subscribe"
+	wsTypeUnsubscribe   = "unsubscribe"
+	wsTypePrices        = "prices"
+	wsTypeSubscriptions = "subscriptions"
+	wsTypeError         = "error"
+)
+
+// WebSocketClientMessage is a command sent by a client.
+type WebSocketClientMessage struct {
+	Type string `json:"type"`
+	// Echoed back in the reply
+	ID    string   `json:"id,omitempty"`
+	Areas []string `json:"areas,omitempty"`
+	// Inclusive YYYY-MM-DD dates of a prices request
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// WebSocketServerMessage is a reply or an event pushed to a client.
+type WebSocketServerMessage struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	EventID uint64          `json:"eventId,omitempty"`
+	Area    string          `json:"area,omitempty"`
+	Areas   []string        `json:"areas,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// WebSocketResource serves a bidirectional price feed for displays that
+// subscribe to areas and request price ranges over the same connection.
+type WebSocketResource struct {
+	broker          *events.Broker
+	priceRepository repository.PriceRepository
+	upgrader        websocket.Upgrader
+	pingPeriod      time.Duration
+
+	mu       sync.Mutex
+	conns    map[*wsConn]struct{}
+	shutdown bool
+}
+
+func NewWebSocketResource(broker *events.Broker, priceRepository repository.PriceRepository, allowedOrigins []string) *WebSocketResource {
+	return &WebSocketResource{
+		broker:          broker,
+		priceRepository: priceRepository,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 4096,
+			CheckOrigin: func(r *http.Request) bool {
+				// Kiosks and other non-browser clients don't send an Origin
+				origin := r.Header.Get("Origin")
+				return origin == "" || slices.Contains(allowedOrigins, origin)
+			},
+		},
+		pingPeriod: wsPingPeriod,
+		conns:      map[*wsConn]struct{}{},
+	}
+}
+
+type wsConn struct {
+	conn *websocket.Conn
+	send chan WebSocketServerMessage
+	// Charges each client message to the rate limit of the upgrade request.
+	// Nil when the request wasn't limited.
+	take middleware.TakeFunc
+
+	slowOnce sync.Once
+	slow     chan struct{}
+
+	mu    sync.Mutex
+	areas []string
+}
+
+// enqueue queues msg for writing. A full queue means the client isn't keeping up.
+func (c *wsConn) enqueue(msg WebSocketServerMessage) {
+	select {
+	case c.send <- msg:
+	default:
+		c.slowOnce.Do(func() { close(c.slow) })
+	}
+}
+
+func (c *wsConn) subscribed(area string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Contains(c.areas, area)
+}
+
+// closeWith sends a close frame and closes the connection. It is safe to call
+// concurrently with the read and write loops.
+func (c *wsConn) closeWith(code int, reason string) {
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+	_ = c.conn.Close()
+}
+
+// Connect handles GET /api/ws.
+func (res *WebSocketResource) Connect(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	sub, _, err := res.broker.Subscribe(0, false)
+	if errors.Is(err, events.ErrTooManySubscribers) {
+		w.Header().Set("Retry-After", "60")
+		problem.Unavailable(w, r, "Too many connections")
+		return
+	}
+	defer res.broker.Unsubscribe(sub)
+
+	conn, err := res.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded
+		logger.Info("WebSocket upgrade failed", "error", err)
+		return
+	}
+	c := &wsConn{
+		conn: conn,
+		send: make(chan WebSocketServerMessage, wsSendBuffer),
+		take: middleware.TakeFromContext(r.Context()),
+		slow: make(chan struct{}),
+	}
+	if !res.track(c) {
+		c.closeWith(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	defer res.untrack(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		res.readLoop(ctx, c)
+	}()
+
+	res.writeLoop(c, sub, done)
+	_ = conn.Close()
+	<-done
+}
+
+// Shutdown closes all connections with a going away status. It is meant to be
+// registered with http.Server.RegisterOnShutdown, as hijacked connections are
+// not closed by the server.
+func (res *WebSocketResource) Shutdown() {
+	res.mu.Lock()
+	res.shutdown = true
+	conns := make([]*wsConn, 0, len(res.conns))
+	for c := range res.conns {
+		conns = append(conns, c)
+	}
+	res.mu.Unlock()
+
+	for _, c := range conns {
+		c.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+func (res *WebSocketResource) track(c *wsConn) bool {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	if res.shutdown {
+		return false
+	}
+	res.conns[c] = struct{}{}
+	return true
+}
+
+func (res *WebSocketResource) untrack(c *wsConn) {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	delete(res.conns, c)
+}
+
+// readLoop handles client messages until the connection is closed.
+func (res *WebSocketResource) readLoop(ctx context.Context, c *wsConn) {
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var msg WebSocketClientMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				c.enqueue(WebSocketServerMessage{Type: wsTypeError, Error: "Invalid JSON message"})
+				continue
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Info("WebSocket closed", "error", err)
+			}
+			return
+		}
+
+		// Messages count like requests, so one connection can't get around the limit
+		if c.take != nil {
+			if wait, ok := c.take(); !ok {
+				retryAfter := int(math.Ceil(wait.Seconds()))
+				c.enqueue(WebSocketServerMessage{Type: wsTypeError, ID: msg.ID, Error: fmt.Sprintf("Rate limit exceeded. Retry after %d seconds", retryAfter)})
+				continue
+			}
+		}
+
+		switch msg.Type {
+		case wsTypeSubscribe, wsTypeUnsubscribe:
+			res.handleSubscription(c, msg)
+		case wsTypePrices:
+			res.handlePrices(ctx, c, msg)
+		default:
+			c.enqueue(WebSocketServerMessage{Type: wsTypeError, ID: msg.ID, Error: "Unknown message type"})
+		}
+	}
+}
+
+func (res *WebSocketResource) handleSubscription(c *wsConn, msg WebSocketClientMessage) {
+	areas := make([]string, 0, len(msg.Areas))
+	for _, name := range msg.Areas {
+		area, ok := service.NormalizeArea(name)
+		if !ok {
+			c.enqueue(WebSocketServerMessage{Type: wsTypeError, ID: msg.ID, Error: "Unknown area " + name})
+			return
+		}
+		areas = append(areas, area)
+	}
+
+	var added []string
+	c.mu.Lock()
+	for _, area := range areas {
+		has := slices.Contains(c.areas, area)
+		switch {
+		case msg.Type == wsTypeSubscribe && !has:
+			c.areas = append(c.areas, area)
+			added = append(added, area)
+		case msg.Type == wsTypeUnsubscribe && has:
+			c.areas = slices.DeleteFunc(c.areas, func(a string) bool { return a == area })
+		}
+	}
+	current := slices.Clone(c.areas)
+	c.mu.Unlock()
+
+	c.enqueue(WebSocketServerMessage{Type: wsTypeSubscriptions, ID: msg.ID, Areas: current})
+	// New subscribers get the current slot right away instead of at the next boundary
+	for _, area := range added {
+		if e, ok := res.broker.LastSlot(area); ok {
+			c.enqueue(eventMessage(e))
+		}
+	}
+}
+
+func (res *WebSocketResource) handlePrices(ctx context.Context, c *wsConn, msg WebSocketClientMessage) {
+	from, to, err := parseDateRange(msg.From, msg.To, loadHelsinki())
+	if err != nil {
+		c.enqueue(WebSocketServerMessage{Type: wsTypeError, ID: msg.ID, Error: err.Error()})
+		return
+	}
+
+	prices, err := res.priceRepository.GetPrices(ctx, from, to)
+	if err != nil {
+		slog.Error("Error getting prices from repository", "error", err)
+		c.enqueue(WebSocketServerMessage{Type: wsTypeError, ID: msg.ID, Error: "Internal server error"})
+		return
+	}
+	if prices == nil {
+		prices = []model.PriceHistoryEntry{}
+	}
+	data, err := json.Marshal(prices)
+	if err != nil {
+		slog.Error("Error encoding prices", "error", err)
+		c.enqueue(WebSocketServerMessage{Type: wsTypeError, ID: msg.ID, Error: "Internal server error"})
+		return
+	}
+	c.enqueue(WebSocketServerMessage{Type: wsTypePrices, ID: msg.ID, Area: service.DefaultArea, Data: data})
+}
+
+// writeLoop is the only writer of c apart from close frames. It returns when the
+// read loop is done or the client falls behind.
+func (res *WebSocketResource) writeLoop(c *wsConn, sub *events.Subscription, done <-chan struct{}) {
+	ping := time.NewTicker(res.pingPeriod)
+	defer ping.Stop()
+
+	for {
+		var msg WebSocketServerMessage
+		select {
+		case <-done:
+			return
+		case <-c.slow:
+			c.closeWith(websocket.CloseTryAgainLater, "client too slow")
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				c.closeWith(websocket.CloseTryAgainLater, "client too slow")
+				return
+			}
+			if !c.subscribed(e.Area) {
+				continue
+			}
+			msg = eventMessage(e)
+		case msg = <-c.send:
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+			continue
+		}
+
+		_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := c.conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+func eventMessage(e events.Event) WebSocketServerMessage {
+	return WebSocketServerMessage{Type: e.Type, EventID: e.ID, Area: e.Area, Data: e.Data}
+}
@@ -0,0 +1,225 @@
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/samlof/ehin/internal/api/middleware"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/events"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func dialWebSocket(t *testing.T, server *httptest.Server, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readWebSocketMessage(t *testing.T, conn *websocket.Conn) WebSocketServerMessage {
+	t.Helper()
+	var msg WebSocketServerMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestWebSocketResource_Subscribe(t *testing.T) {
+	broker := events.NewBroker(nil, nil, 10)
+	broker.Publish("FI", events.TypeSlot, events.SlotData{Area: "FI", Price: 12.5})
+
+	res := NewWebSocketResource(broker, nil, nil)
+	server := httptest.NewServer(http.HandlerFunc(res.Connect))
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, nil)
+	defer func() { _ = conn.Close() }()
+
+	assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "subscribe", ID: "1", Areas: []string{"fi"}}))
+
+	msg := readWebSocketMessage(t, conn)
+	assert.Equal(t, "subscriptions", msg.Type)
+	assert.Equal(t, "1", msg.ID)
+	assert.Equal(t, []string{"FI"}, msg.Areas)
+
+	// The current slot is sent right after subscribing
+	msg = readWebSocketMessage(t, conn)
+	assert.Equal(t, "slot", msg.Type)
+	assert.Equal(t, uint64(1), msg.EventID)
+	assert.JSONEq(t, `{"area":"FI","price":12.5,"start":"0001-01-01T00:00:00Z","end":"0001-01-01T00:00:00Z"}`, string(msg.Data))
+
+	broker.Publish("FI", events.TypeDay, events.DayData{Area: "FI", Date: "2025-01-02", PriceCount: 96})
+	msg = readWebSocketMessage(t, conn)
+	assert.Equal(t, "day", msg.Type)
+	assert.Equal(t, "FI", msg.Area)
+
+	assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "unsubscribe", ID: "2", Areas: []string{"FI"}}))
+	msg = readWebSocketMessage(t, conn)
+	assert.Equal(t, "subscriptions", msg.Type)
+	assert.Empty(t, msg.Areas)
+
+	// Events of unsubscribed areas are not sent
+	broker.Publish("FI", events.TypeDay, events.DayData{Area: "FI", Date: "2025-01-03", PriceCount: 96})
+	assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "subscribe", ID: "3", Areas: []string{"SE3"}}))
+	msg = readWebSocketMessage(t, conn)
+	assert.Equal(t, "error", msg.Type)
+	assert.Equal(t, "3", msg.ID)
+	assert.Equal(t, "Unknown area SE3", msg.Error)
+}
+
+func TestWebSocketResource_Prices(t *testing.T) {
+	mockRepo := new(testutil.MockPriceRepository)
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, helsinki)
+	to := time.Date(2025, 1, 3, 0, 0, 0, 0, helsinki)
+	prices := []model.PriceHistoryEntry{
+		{Price: 10, DeliveryStart: from.UTC(), DeliveryEnd: from.Add(15 * time.Minute).UTC()},
+	}
+	mockRepo.On("GetPrices", mock.Anything, from, to).Return(prices, nil)
+
+	res := NewWebSocketResource(events.NewBroker(nil, nil, 10), mockRepo, nil)
+	server := httptest.NewServer(http.HandlerFunc(res.Connect))
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, nil)
+	defer func() { _ = conn.Close() }()
+
+	assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "prices", ID: "a", From: "2025-01-01", To: "2025-01-02"}))
+	msg := readWebSocketMessage(t, conn)
+	assert.Equal(t, "prices", msg.Type)
+	assert.Equal(t, "a", msg.ID)
+	var got []model.PriceHistoryEntry
+	assert.NoError(t, json.Unmarshal(msg.Data, &got))
+	assert.Len(t, got, 1)
+	assert.Equal(t, 10.0, got[0].Price)
+
+	assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "prices", ID: "b", From: "2025-01-02", To: "2025-01-01"}))
+	msg = readWebSocketMessage(t, conn)
+	assert.Equal(t, "error", msg.Type)
+	assert.Equal(t, "b", msg.ID)
+
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+	msg = readWebSocketMessage(t, conn)
+	assert.Equal(t, "error", msg.Type)
+	assert.Equal(t, "Invalid JSON message", msg.Error)
+
+	assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "dance"}))
+	msg = readWebSocketMessage(t, conn)
+	assert.Equal(t, "Unknown message type", msg.Error)
+}
+
+func TestWebSocketResource_RateLimit(t *testing.T) {
+	mockRepo := new(testutil.MockPriceRepository)
+	mockRepo.On("GetPrices", mock.Anything, mock.Anything, mock.Anything).Return([]model.PriceHistoryEntry{}, nil)
+	mockTime := new(MockTimeProvider)
+	mockTime.On("Now").Return(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := middleware.NewRateLimiter(&config.Config{RateLimitPerMinute: 1, RateLimitBurst: 3}, nil, mockTime)
+
+	res := NewWebSocketResource(events.NewBroker(nil, nil, 10), mockRepo, nil)
+	server := httptest.NewServer(limiter.Limit(res.Connect))
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, nil)
+	defer func() { _ = conn.Close() }()
+
+	// The upgrade request took the first token
+	for _, id := range []string{"a", "b"} {
+		assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "prices", ID: id, From: "2025-01-01", To: "2025-01-01"}))
+		msg := readWebSocketMessage(t, conn)
+		assert.Equal(t, "prices", msg.Type)
+		assert.Equal(t, id, msg.ID)
+	}
+
+	assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "prices", ID: "c", From: "2025-01-01", To: "2025-01-01"}))
+	msg := readWebSocketMessage(t, conn)
+	assert.Equal(t, "error", msg.Type)
+	assert.Equal(t, "c", msg.ID)
+	assert.Equal(t, "Rate limit exceeded. Retry after 60 seconds", msg.Error)
+	mockRepo.AssertNumberOfCalls(t, "GetPrices", 2)
+
+	// New connections share the bucket
+	req := httptest.NewRequest("GET", "/api/ws", nil)
+	req.RemoteAddr = conn.LocalAddr().String()
+	rr := httptest.NewRecorder()
+	limiter.Limit(res.Connect)(rr, req)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+}
+
+func TestWebSocketResource_Shutdown(t *testing.T) {
+	broker := events.NewBroker(nil, nil, 10)
+	res := NewWebSocketResource(broker, nil, nil)
+	server := httptest.NewServer(http.HandlerFunc(res.Connect))
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, nil)
+	defer func() { _ = conn.Close() }()
+
+	// Wait until the connection is registered
+	assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "subscribe", Areas: []string{"FI"}}))
+	readWebSocketMessage(t, conn)
+
+	res.Shutdown()
+
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error %v", err)
+	assert.Eventually(t, func() bool { return broker.Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestWebSocketResource_SlowClient(t *testing.T) {
+	broker := events.NewBroker(nil, nil, 10)
+	res := NewWebSocketResource(broker, nil, nil)
+	server := httptest.NewServer(http.HandlerFunc(res.Connect))
+	defer server.Close()
+
+	conn := dialWebSocket(t, server, nil)
+	defer func() { _ = conn.Close() }()
+	assert.NoError(t, conn.WriteJSON(WebSocketClientMessage{Type: "subscribe", Areas: []string{"FI"}}))
+	readWebSocketMessage(t, conn)
+
+	// Large events fill the socket buffers while the client isn't reading
+	payload := events.DayData{Area: "FI", Date: strings.Repeat("x", 64*1024)}
+	for i := 0; i < 1000 && broker.Subscribers() > 0; i++ {
+		broker.Publish("FI", events.TypeDay, payload)
+	}
+	assert.Eventually(t, func() bool { return broker.Subscribers() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWebSocketResource_Origin(t *testing.T) {
+	res := NewWebSocketResource(events.NewBroker(nil, nil, 10), nil, []string{"https://ehin.fi"})
+	server := httptest.NewServer(http.HandlerFunc(res.Connect))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://ehin.fi"}})
+	assert.NoError(t, err)
+	_ = conn.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestWebSocketResource_ConnectionLimit(t *testing.T) {
+	broker := events.NewBroker(nil, nil, 1)
+	_, _, err := broker.Subscribe(0, false)
+	assert.NoError(t, err)
+
+	res := NewWebSocketResource(broker, nil, nil)
+	rr := httptest.NewRecorder()
+	res.Connect(rr, httptest.NewRequest("GET", "/api/ws", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
@@ -0,0 +1,136 @@
+// Package router wires the resources of the API to their routes and wraps them
+// in the middleware chain. cmd/api serves the result and tests use it to hit
+// the same routes as production.
+package router
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/samlof/ehin/internal/api/middleware"
+	"github.com/samlof/ehin/internal/api/resource"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/metrics"
+	"github.com/samlof/ehin/internal/openapi"
+)
+
+// Handlers are the resources and middleware behind the routes. Events,
+// WebSocket and GraphQL need a database and their routes are only registered
+// when set. The rest are required.
+type Handlers struct {
+	Greeting      *resource.GreetingResource
+	Health        *resource.HealthResource
+	Price         *resource.PriceResource
+	Calendar      *resource.CalendarResource
+	HomeAssistant *resource.HomeAssistantResource
+	Consumption   *resource.ConsumptionResource
+	Contract      *resource.ContractResource
+	Schedule      *resource.ScheduleResource
+	Webhook       *resource.WebhookResource
+	APIKey        *resource.APIKeyResource
+	Events        *resource.EventsResource
+	WebSocket     *resource.WebSocketResource
+	GraphQL       *resource.GraphQLResource
+
+	Metrics       *metrics.Metrics
+	Authenticator *middleware.Authenticator
+	RateLimiter   *middleware.RateLimiter
+}
+
+// Route is a ServeMux pattern and its handler.
+type Route struct {
+	Pattern string
+	Handler http.HandlerFunc
+	// Public routes are rate limited
+	Public bool
+}
+
+func route(pattern string, handler http.HandlerFunc) Route {
+	return Route{Pattern: pattern, Handler: handler}
+}
+
+func public(pattern string, handler http.HandlerFunc) Route {
+	return Route{Pattern: pattern, Handler: handler, Public: true}
+}
+
+// Routes returns the routes of the API. Each of them must be documented in
+// internal/openapi/openapi.json.
+func Routes(h Handlers) []Route {
+	routes := []Route{
+		route("GET /", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "EHIN API (Go)")
+		}),
+		route("GET /hello", h.Greeting.Hello),
+		route("GET /openapi.json", openapi.Handler),
+		route("GET /healthz", h.Health.Healthz),
+		route("GET /readyz", h.Health.Readyz),
+		route("GET /status", h.Health.Status),
+		route("GET /metrics", h.Authenticator.Require(model.ScopeMetricsRead, h.Metrics.Handler().ServeHTTP)),
+	}
+
+	// Public endpoints
+	routes = append(routes,
+		public("GET /api/prices", h.Price.GetPriceRange),
+		public("GET /api/prices/{date}", middleware.ETag(h.Price.GetPastPrices)),
+		public("GET /api/v2/prices", middleware.ETag(h.Price.GetPricesV2)),
+		public("GET /api/calendar.ics", h.Calendar.GetCalendar),
+		public("GET /api/homeassistant/{area}", h.HomeAssistant.GetSensor),
+		public("POST /api/consumption/cost", h.Consumption.CalculateCost),
+		public("POST /api/contracts/compare", h.Contract.Compare),
+		public("POST /api/schedule", h.Schedule.Optimize),
+	)
+	if h.Events != nil {
+		routes = append(routes, public("GET /api/events", h.Events.StreamEvents))
+	}
+	if h.WebSocket != nil {
+		routes = append(routes, public("GET /api/ws", h.WebSocket.Connect))
+	}
+	if h.GraphQL != nil {
+		routes = append(routes,
+			public("GET /api/graphql", h.GraphQL.Query),
+			public("POST /api/graphql", h.GraphQL.Query),
+		)
+	}
+
+	// Admin endpoints
+	require := h.Authenticator.Require
+	updatePrices := require(model.ScopePricesUpdate, h.Price.UpdatePrices)
+	updatePricesForDate := require(model.ScopePricesUpdate, h.Price.UpdatePricesForDate)
+	return append(routes,
+		route("POST /api/admin/update-prices", updatePrices),
+		route("POST /api/admin/update-prices/{date}", updatePricesForDate),
+		// App Engine cron can only make GET requests
+		route("GET /api/update-prices", updatePrices),
+		route("GET /api/update-prices/{date}", updatePricesForDate),
+		route("POST /api/admin/webhooks", require(model.ScopeWebhooksManage, h.Webhook.CreateSubscription)),
+		route("GET /api/admin/webhooks", require(model.ScopeWebhooksManage, h.Webhook.ListSubscriptions)),
+		route("GET /api/admin/webhooks/dead-letters", require(model.ScopeWebhooksManage, h.Webhook.ListDeadLetters)),
+		route("DELETE /api/admin/webhooks/{id}", require(model.ScopeWebhooksManage, h.Webhook.DeleteSubscription)),
+		route("POST /api/admin/api-keys", require(model.ScopeAPIKeysManage, h.APIKey.CreateKey)),
+		route("GET /api/admin/api-keys", require(model.ScopeAPIKeysManage, h.APIKey.ListKeys)),
+		route("DELETE /api/admin/api-keys/{id}", require(model.ScopeAPIKeysManage, h.APIKey.DeleteKey)),
+	)
+}
+
+// New returns the handler that serves the routes of h behind the middleware
+// chain.
+func New(cfg *config.Config, h Handlers) http.Handler {
+	mux := http.NewServeMux()
+	limited := map[string]bool{}
+	for _, route := range Routes(h) {
+		mux.HandleFunc(route.Pattern, route.Handler)
+		limited[route.Pattern] = route.Public
+	}
+
+	var handler http.Handler = mux
+	handler = middleware.Recover(handler)
+	handler = middleware.Compress(cfg)(handler)
+	// Outside Compress, so that cached responses are limited too
+	handler = h.RateLimiter.LimitRoutes(mux, limited)(handler)
+	handler = middleware.CORS(cfg)(handler)
+	handler = middleware.RequestLogger(mux)(handler)
+	handler = middleware.Metrics(h.Metrics, mux)(handler)
+	handler = middleware.Tracing(mux)(handler)
+	return handler
+}
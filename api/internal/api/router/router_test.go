@@ -0,0 +1,131 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/middleware"
+	"github.com/samlof/ehin/internal/api/resource"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/metrics"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noAPIKeys knows no API keys.
+type noAPIKeys struct{}
+
+func (noAPIKeys) CreateKey(ctx context.Context, key *model.APIKey) error { return nil }
+func (noAPIKeys) ListKeys(ctx context.Context) ([]model.APIKey, error)   { return nil, nil }
+func (noAPIKeys) GetKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	return nil, nil
+}
+func (noAPIKeys) DeleteKey(ctx context.Context, id int64) (bool, error) { return false, nil }
+func (noAPIKeys) AddUsage(ctx context.Context, counts map[int64]int64, lastUsed time.Time) error {
+	return nil
+}
+
+func newTestHandler(cfg *config.Config) http.Handler {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, helsinki)
+	repo := &testutil.FakePriceRepository{}
+	for i := range 3 * 96 {
+		start := day.AddDate(0, 0, -1).Add(time.Duration(i) * 15 * time.Minute)
+		repo.Entries = append(repo.Entries, model.PriceHistoryEntry{
+			Price:         float64(i) / 4,
+			DeliveryStart: start,
+			DeliveryEnd:   start.Add(15 * time.Minute),
+		})
+	}
+
+	now := testutil.FixedTime{Time: day.Add(12 * time.Hour)}
+	return New(cfg, Handlers{
+		Greeting:      resource.NewGreetingResource(),
+		Health:        resource.NewHealthResource(repo, nil, now, 0, "test"),
+		Price:         resource.NewPriceResource(repo, nil, now),
+		Calendar:      resource.NewCalendarResource(repo, now),
+		HomeAssistant: resource.NewHomeAssistantResource(repo, now),
+		Consumption:   resource.NewConsumptionResource(nil),
+		Contract:      resource.NewContractResource(nil, now),
+		Schedule:      resource.NewScheduleResource(repo, now),
+		Webhook:       resource.NewWebhookResource(nil),
+		APIKey:        resource.NewAPIKeyResource(nil),
+		Metrics:       metrics.New(now),
+		Authenticator: middleware.NewAuthenticator(cfg, nil, now),
+		RateLimiter:   middleware.NewRateLimiter(cfg, noAPIKeys{}, now),
+	})
+}
+
+func TestNew_RateLimitsCachedResponses(t *testing.T) {
+	handler := newTestHandler(&config.Config{RateLimitPerMinute: 1, RateLimitBurst: 2})
+
+	get := func(apiKey string) *httptest.ResponseRecorder {
+		// Prices up to the day after tomorrow are immutable and cached compressed
+		req := httptest.NewRequest("GET", "/api/prices/2025-03-09", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if apiKey != "" {
+			req.Header.Set(middleware.APIKeyHeader, apiKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := get("")
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Contains(t, first.Header().Get("Cache-Control"), "immutable")
+	assert.Equal(t, "1", first.Header().Get("X-RateLimit-Remaining"))
+
+	cached := get("")
+	require.Equal(t, http.StatusOK, cached.Code)
+	assert.Equal(t, "gzip", cached.Header().Get("Content-Encoding"))
+	assert.Equal(t, "0", cached.Header().Get("X-RateLimit-Remaining"))
+
+	limited := get("")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.NotEmpty(t, limited.Header().Get("Retry-After"))
+
+	invalidKey := get("invalid")
+	assert.Equal(t, http.StatusUnauthorized, invalidKey.Code)
+}
+
+func TestNew_UnlimitedRoutes(t *testing.T) {
+	handler := newTestHandler(&config.Config{RateLimitPerMinute: 1, RateLimitBurst: 1})
+
+	for range 3 {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("X-RateLimit-Limit"))
+	}
+}
+
+func TestNew_PricesV2NotModified(t *testing.T) {
+	handler := newTestHandler(&config.Config{})
+
+	get := func(encoding, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v2/prices?from=2025-03-09&to=2025-03-09", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := get("gzip", "")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// From the compression cache and from the handler
+	assert.Equal(t, http.StatusNotModified, get("gzip", etag).Code)
+	identity := get("identity", "")
+	assert.Equal(t, http.StatusNotModified, get("identity", identity.Header().Get("ETag")).Code)
+}
@@ -0,0 +1,38 @@
+// Package auth creates admin bearer tokens and public API keys.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Prefixes make leaked secrets easy to recognize in secret scanners.
+const (
+	tokenPrefix  = "ehin_"
+	apiKeyPrefix = "ehin_pk_"
+)
+
+// NewToken returns a random admin bearer token.
+func NewToken() string {
+	return newSecret(tokenPrefix)
+}
+
+// NewAPIKey returns a random public API key.
+func NewAPIKey() string {
+	return newSecret(apiKeyPrefix)
+}
+
+func newSecret(prefix string) string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return prefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// HashToken returns the hash a token or API key is stored and looked up by.
+// They are random, so a fast unsalted hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewToken(t *testing.T) {
+	a, b := NewToken(), NewToken()
+	if a == b {
+		t.Error("Expected tokens to be random")
+	}
+	if !strings.HasPrefix(a, "ehin_") || len(a) != len("ehin_")+43 {
+		t.Errorf("Unexpected token format %q", a)
+	}
+}
+
+func TestNewAPIKey(t *testing.T) {
+	if key := NewAPIKey(); !strings.HasPrefix(key, "ehin_pk_") || len(key) != len("ehin_pk_")+43 {
+		t.Errorf("Unexpected API key format %q", key)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// echo -n 'ehin_test' | sha256sum
+	want := "5d3a13fc76aaf8a895dd5571290737ebce445fecbcde619ffdc91f79f4231dbe"
+	if got := HashToken("ehin_test"); got != want {
+		t.Errorf("HashToken() = %s, want %s", got, want)
+	}
+}
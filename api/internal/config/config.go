@@ -2,18 +2,38 @@ package config
 
 import (
 	"log/slog"
+	"math"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port                 string
-	DatabaseURL          string
-	UpdatePricesPassword string
-	CORSAllowedOrigins   []string
-	NordPoolBaseURL      string
+	Port                    string
+	DatabaseURL             string
+	UpdatePricesPassword    string
+	AdminPasswordAuth       bool
+	AppEngine               bool
+	CORSAllowedOrigins      []string
+	NordPoolBaseURL         string
+	CompressionMinSize      int
+	MQTTBrokerURL           string
+	MQTTTopicPrefix         string
+	MQTTQoS                 byte
+	SSEMaxConnections       int
+	RateLimitPerMinute      int
+	RateLimitBurst          int
+	TracingExporter         string
+	HTTPReadTimeout         time.Duration
+	HTTPWriteTimeout        time.Duration
+	HTTPIdleTimeout         time.Duration
+	ShutdownTimeout         time.Duration
+	GraphQLMaxDepth         int
+	GraphQLMaxComplexity    int
+	GraphQLPersistedQueries bool
 }
 
 func LoadConfig() *Config {
@@ -34,11 +54,77 @@ func LoadConfig() *Config {
 		origins = []string{"http://127.0.0.1:5173", "https://ehin.fi", "https://www.ehin.fi"}
 	}
 
+	mqttTopicPrefix := os.Getenv("MQTT_TOPIC_PREFIX")
+	if mqttTopicPrefix == "" {
+		mqttTopicPrefix = "ehin"
+	}
+
 	return &Config{
-		Port:                 port,
-		DatabaseURL:          os.Getenv("DATABASE_URL"),
-		UpdatePricesPassword: os.Getenv("UPDATE_PRICES_PASSWORD"),
-		CORSAllowedOrigins:   origins,
-		NordPoolBaseURL:      "https://dataportal-api.nordpoolgroup.com",
+		Port:                    port,
+		DatabaseURL:             os.Getenv("DATABASE_URL"),
+		UpdatePricesPassword:    os.Getenv("UPDATE_PRICES_PASSWORD"),
+		AdminPasswordAuth:       getEnvBool("ADMIN_PASSWORD_AUTH", false),
+		AppEngine:               os.Getenv("GAE_ENV") != "",
+		CORSAllowedOrigins:      origins,
+		NordPoolBaseURL:         "https://dataportal-api.nordpoolgroup.com",
+		CompressionMinSize:      getEnvInt("COMPRESSION_MIN_SIZE", 1024, 0, math.MaxInt),
+		MQTTBrokerURL:           os.Getenv("MQTT_BROKER_URL"),
+		MQTTTopicPrefix:         strings.TrimSuffix(mqttTopicPrefix, "/"),
+		MQTTQoS:                 byte(getEnvInt("MQTT_QOS", 1, 0, 2)),
+		SSEMaxConnections:       getEnvInt("SSE_MAX_CONNECTIONS", 500, 1, math.MaxInt),
+		RateLimitPerMinute:      getEnvInt("RATE_LIMIT_PER_MINUTE", 300, 0, math.MaxInt),
+		RateLimitBurst:          getEnvInt("RATE_LIMIT_BURST", 100, 1, math.MaxInt),
+		TracingExporter:         strings.ToLower(os.Getenv("TRACING_EXPORTER")),
+		HTTPReadTimeout:         getEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+		HTTPWriteTimeout:        getEnvDuration("HTTP_WRITE_TIMEOUT", 60*time.Second),
+		HTTPIdleTimeout:         getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+		ShutdownTimeout:         getEnvDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		GraphQLMaxDepth:         getEnvInt("GRAPHQL_MAX_DEPTH", 8, 1, math.MaxInt),
+		GraphQLMaxComplexity:    getEnvInt("GRAPHQL_MAX_COMPLEXITY", 50000, 1, math.MaxInt),
+		GraphQLPersistedQueries: getEnvBool("GRAPHQL_PERSISTED_QUERIES", true),
+	}
+}
+
+// getEnvBool reads a boolean environment variable, falling back to def when it is unset or invalid.
+func getEnvBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("Invalid boolean environment variable, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return b
+}
+
+// getEnvInt reads an integer environment variable, falling back to def when it is
+// unset or outside [minValue, maxValue].
+func getEnvInt(key string, def, minValue, maxValue int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < minValue || n > maxValue {
+		slog.Warn("Invalid integer environment variable, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return n
+}
+
+// getEnvDuration reads a positive duration such as 30s, falling back to def when
+// it is unset or invalid.
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration environment variable, using default", "key", key, "value", v, "default", def)
+		return def
 	}
+	return d
 }
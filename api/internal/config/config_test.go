@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -22,3 +23,115 @@ func TestLoadConfig(t *testing.T) {
 		t.Errorf("Expected first CORS origin http://localhost:3000, got %s", cfg.CORSAllowedOrigins[0])
 	}
 }
+
+func TestLoadConfig_Integers(t *testing.T) {
+	t.Setenv("COMPRESSION_MIN_SIZE", "2048")
+	t.Setenv("MQTT_QOS", "3")
+	t.Setenv("SSE_MAX_CONNECTIONS", "0")
+
+	cfg := LoadConfig()
+
+	if cfg.CompressionMinSize != 2048 {
+		t.Errorf("Expected CompressionMinSize 2048, got %d", cfg.CompressionMinSize)
+	}
+	if cfg.MQTTQoS != 1 {
+		t.Errorf("Expected invalid MQTT_QOS to fall back to 1, got %d", cfg.MQTTQoS)
+	}
+	if cfg.SSEMaxConnections != 500 {
+		t.Errorf("Expected invalid SSE_MAX_CONNECTIONS to fall back to 500, got %d", cfg.SSEMaxConnections)
+	}
+	if cfg.MQTTTopicPrefix != "ehin" {
+		t.Errorf("Expected default MQTT topic prefix ehin, got %s", cfg.MQTTTopicPrefix)
+	}
+}
+
+func TestLoadConfig_AdminAuth(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD_AUTH", "true")
+	t.Setenv("GAE_ENV", "standard")
+
+	cfg := LoadConfig()
+
+	if !cfg.AdminPasswordAuth {
+		t.Error("Expected AdminPasswordAuth to be enabled")
+	}
+	if !cfg.AppEngine {
+		t.Error("Expected AppEngine to be detected from GAE_ENV")
+	}
+
+	t.Setenv("ADMIN_PASSWORD_AUTH", "maybe")
+	t.Setenv("GAE_ENV", "")
+
+	cfg = LoadConfig()
+
+	if cfg.AdminPasswordAuth {
+		t.Error("Expected invalid ADMIN_PASSWORD_AUTH to fall back to false")
+	}
+	if cfg.AppEngine {
+		t.Error("Expected AppEngine to be false without GAE_ENV")
+	}
+}
+
+func TestLoadConfig_RateLimit(t *testing.T) {
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "0")
+	t.Setenv("RATE_LIMIT_BURST", "0")
+
+	cfg := LoadConfig()
+
+	if cfg.RateLimitPerMinute != 0 {
+		t.Errorf("Expected RateLimitPerMinute 0, got %d", cfg.RateLimitPerMinute)
+	}
+	if cfg.RateLimitBurst != 100 {
+		t.Errorf("Expected out of range RateLimitBurst to fall back to 100, got %d", cfg.RateLimitBurst)
+	}
+}
+
+func TestLoadConfig_TracingExporter(t *testing.T) {
+	t.Setenv("TRACING_EXPORTER", "OTLP")
+
+	cfg := LoadConfig()
+
+	if cfg.TracingExporter != "otlp" {
+		t.Errorf("Expected TracingExporter otlp, got %s", cfg.TracingExporter)
+	}
+}
+
+func TestLoadConfig_Timeouts(t *testing.T) {
+	t.Setenv("HTTP_WRITE_TIMEOUT", "2m")
+	t.Setenv("SHUTDOWN_TIMEOUT", "-1s")
+
+	cfg := LoadConfig()
+
+	if cfg.HTTPWriteTimeout != 2*time.Minute {
+		t.Errorf("Expected HTTPWriteTimeout 2m, got %s", cfg.HTTPWriteTimeout)
+	}
+	if cfg.ShutdownTimeout != 10*time.Second {
+		t.Errorf("Expected invalid SHUTDOWN_TIMEOUT to fall back to 10s, got %s", cfg.ShutdownTimeout)
+	}
+	if cfg.HTTPReadTimeout != 15*time.Second {
+		t.Errorf("Expected default HTTPReadTimeout 15s, got %s", cfg.HTTPReadTimeout)
+	}
+}
+
+func TestLoadConfig_GraphQL(t *testing.T) {
+	cfg := LoadConfig()
+
+	if cfg.GraphQLMaxDepth != 8 || cfg.GraphQLMaxComplexity != 50000 || !cfg.GraphQLPersistedQueries {
+		t.Errorf("Unexpected GraphQL defaults: depth %d, complexity %d, persisted queries %v", cfg.GraphQLMaxDepth, cfg.GraphQLMaxComplexity, cfg.GraphQLPersistedQueries)
+	}
+
+	t.Setenv("GRAPHQL_MAX_DEPTH", "0")
+	t.Setenv("GRAPHQL_MAX_COMPLEXITY", "1000")
+	t.Setenv("GRAPHQL_PERSISTED_QUERIES", "false")
+
+	cfg = LoadConfig()
+
+	if cfg.GraphQLMaxDepth != 8 {
+		t.Errorf("Expected invalid GRAPHQL_MAX_DEPTH to fall back to 8, got %d", cfg.GraphQLMaxDepth)
+	}
+	if cfg.GraphQLMaxComplexity != 1000 {
+		t.Errorf("Expected GraphQLMaxComplexity 1000, got %d", cfg.GraphQLMaxComplexity)
+	}
+	if cfg.GraphQLPersistedQueries {
+		t.Error("Expected persisted queries to be disabled")
+	}
+}
@@ -0,0 +1,308 @@
+// Package datahub parses electricity consumption exported as CSV from Fingrid
+// Datahub, e.g.
+//
+//	MeteringPointGSRN;Product Type;Resolution;Unit Type;Reading Type;Start Time;Quantity;Quality
+//	643007574000000000;8716867000030;PT1H;kWh;BN01;2024-01-01T00:00:00Z;0,74;OK
+//
+// Columns are found by their English or Finnish header, and the field
+// separator by the header line. Quantities may use a decimal comma. Timestamps
+// with an offset are used as is, those without one are local Finnish time.
+package datahub
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reading is the consumption of one metering interval.
+type Reading struct {
+	Start time.Time
+	End   time.Time
+	KWh   float64
+}
+
+var (
+	startColumns      = []string{"starttime", "start", "alkuaika", "aloitusaika", "alku"}
+	endColumns        = []string{"endtime", "end", "loppuaika", "loppu"}
+	quantityColumns   = []string{"quantity", "consumption", "volume", "määrä", "maara", "kulutus"}
+	resolutionColumns = []string{"resolution", "resoluutio", "aikaresoluutio"}
+	unitColumns       = []string{"unittype", "unit", "yksikkö", "yksikko"}
+)
+
+// Formats of timestamps without an offset, in Helsinki time
+var localFormats = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2.1.2006 15:04:05",
+	"2.1.2006 15:04",
+	"2.1.2006 15.04.05",
+	"2.1.2006 15.04",
+}
+
+type columns struct {
+	start, end, quantity, resolution, unit int
+}
+
+// Parse reads the consumption rows of a Datahub CSV export, sorted by start
+// time. Timestamps without an offset are in loc. Rows without a quantity are
+// skipped. Rows of several metering points are all returned.
+func Parse(r io.Reader, loc *time.Location) ([]Reading, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comma = separator(data)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	cols, err := findColumns(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []Reading
+	// Slot length of each reading, 0 when it has to be inferred
+	var lengths []time.Duration
+	var prevLocal time.Time
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if isBlank(record) {
+			continue
+		}
+
+		quantity := field(record, cols.quantity)
+		if quantity == "" {
+			continue
+		}
+		kwh, err := parseDecimal(quantity)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid quantity %q", line, quantity)
+		}
+		if cols.unit >= 0 {
+			switch strings.ToLower(field(record, cols.unit)) {
+			case "", "kwh":
+			case "wh":
+				kwh /= 1000
+			case "mwh":
+				kwh *= 1000
+			default:
+				return nil, fmt.Errorf("line %d: unsupported unit %q", line, field(record, cols.unit))
+			}
+		}
+
+		start, local, err := parseTime(field(record, cols.start), loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start time %q", line, field(record, cols.start))
+		}
+		if local {
+			start = resolveRepeatedHour(start, prevLocal)
+			prevLocal = start
+		}
+
+		var length time.Duration
+		if cols.end >= 0 && field(record, cols.end) != "" {
+			end, _, err := parseTime(field(record, cols.end), loc)
+			if err != nil || !end.After(start) {
+				return nil, fmt.Errorf("line %d: invalid end time %q", line, field(record, cols.end))
+			}
+			length = end.Sub(start)
+		} else if cols.resolution >= 0 && field(record, cols.resolution) != "" {
+			length, err = parseResolution(field(record, cols.resolution))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		readings = append(readings, Reading{Start: start, KWh: kwh})
+		lengths = append(lengths, length)
+	}
+
+	inferred := inferLength(readings)
+	for i := range readings {
+		if lengths[i] == 0 {
+			lengths[i] = inferred
+		}
+		readings[i].End = readings[i].Start.Add(lengths[i])
+	}
+	slices.SortStableFunc(readings, func(a, b Reading) int {
+		return a.Start.Compare(b.Start)
+	})
+	return readings, nil
+}
+
+// separator guesses the field separator from the header line.
+func separator(data []byte) rune {
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	best, bestCount := ';', 0
+	for _, sep := range []rune{';', ',', '\t'} {
+		if n := bytes.Count(header, []byte(string(sep))); n > bestCount {
+			best, bestCount = sep, n
+		}
+	}
+	return best
+}
+
+func findColumns(header []string) (columns, error) {
+	cols := columns{start: -1, end: -1, quantity: -1, resolution: -1, unit: -1}
+	for i, name := range header {
+		name = strings.ToLower(strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "").Replace(strings.TrimSpace(name)))
+		// Headers such as "Quantity (kWh)"
+		name, _, _ = strings.Cut(name, "(")
+		for _, c := range []struct {
+			names []string
+			index *int
+		}{
+			{startColumns, &cols.start},
+			{endColumns, &cols.end},
+			{quantityColumns, &cols.quantity},
+			{resolutionColumns, &cols.resolution},
+			{unitColumns, &cols.unit},
+		} {
+			if *c.index < 0 && slices.Contains(c.names, name) {
+				*c.index = i
+			}
+		}
+	}
+	if cols.start < 0 {
+		return cols, errors.New("no start time column")
+	}
+	if cols.quantity < 0 {
+		return cols, errors.New("no quantity column")
+	}
+	return cols, nil
+}
+
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func isBlank(record []string) bool {
+	for _, f := range record {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDecimal parses numbers such as 0,74, 1 234,5 and 1.234,5 as well as 0.74.
+func parseDecimal(s string) (float64, error) {
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "").Replace(s)
+	if strings.Contains(s, ",") {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseTime parses a timestamp and reports whether it was in local time.
+func parseTime(s string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range localFormats {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, errors.New("unknown time format")
+}
+
+// resolveRepeatedHour picks between the two instants of a wall clock time that
+// happens twice when DST ends: the earlier one, unless the previous row was
+// already at or past it.
+func resolveRepeatedHour(t, prev time.Time) time.Time {
+	earlier, later := t, t
+	for _, c := range []time.Time{t.Add(-time.Hour), t.Add(time.Hour)} {
+		if c.Hour() == t.Hour() && c.Minute() == t.Minute() {
+			if c.Before(t) {
+				earlier = c
+			} else {
+				later = c
+			}
+		}
+	}
+	if !prev.IsZero() && !earlier.After(prev) {
+		return later
+	}
+	return earlier
+}
+
+// parseResolution parses ISO 8601 durations such as PT15M, PT1H and PT60M.
+func parseResolution(s string) (time.Duration, error) {
+	d, ok := strings.CutPrefix(strings.ToUpper(s), "PT")
+	if ok {
+		var total time.Duration
+		for d != "" {
+			i := strings.IndexAny(d, "HM")
+			if i <= 0 {
+				break
+			}
+			n, err := strconv.Atoi(d[:i])
+			if err != nil {
+				break
+			}
+			unit := time.Minute
+			if d[i] == 'H' {
+				unit = time.Hour
+			}
+			total += time.Duration(n) * unit
+			d = d[i+1:]
+		}
+		if d == "" && total > 0 {
+			return total, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid resolution %q", s)
+}
+
+// inferLength returns the shortest gap between consecutive readings, or an
+// hour when there's nothing to compare.
+func inferLength(readings []Reading) time.Duration {
+	starts := make([]time.Time, len(readings))
+	for i, r := range readings {
+		starts[i] = r.Start
+	}
+	slices.SortFunc(starts, time.Time.Compare)
+
+	var shortest time.Duration
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap > 0 && (shortest == 0 || gap < shortest) {
+			shortest = gap
+		}
+	}
+	if shortest == 0 {
+		return time.Hour
+	}
+	return shortest
+}
@@ -0,0 +1,124 @@
+package datahub
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var helsinki, _ = time.LoadLocation("Europe/Helsinki")
+
+func TestParse_Export(t *testing.T) {
+	csv := "\ufeffMeteringPointGSRN;Product Type;Resolution;Unit Type;Reading Type;Start Time;Quantity;Quality\n" +
+		"643007574000000000;8716867000030;PT1H;kWh;BN01;2024-01-01T00:00:00Z;0,74;OK\n" +
+		"643007574000000000;8716867000030;PT1H;kWh;BN01;2024-01-01T01:00:00Z;1 234,5;OK\n" +
+		"643007574000000000;8716867000030;PT1H;kWh;BN01;2024-01-01T02:00:00Z;;MISSING\n" +
+		"\n"
+
+	readings, err := Parse(strings.NewReader(csv), helsinki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readings) != 2 {
+		t.Fatalf("Expected 2 readings, got %d", len(readings))
+	}
+	first := readings[0]
+	if !first.Start.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || first.End.Sub(first.Start) != time.Hour || first.KWh != 0.74 {
+		t.Errorf("Unexpected first reading %+v", first)
+	}
+	if readings[1].KWh != 1234.5 {
+		t.Errorf("Expected 1234.5 kWh, got %v", readings[1].KWh)
+	}
+}
+
+func TestParse_LocalTimes(t *testing.T) {
+	csv := "Alkuaika,Määrä (kWh)\n" +
+		"1.1.2024 0:15,0.25\n" +
+		"1.1.2024 0:00,0.5\n" +
+		"1.1.2024 0:30,\"1,5\"\n"
+
+	readings, err := Parse(strings.NewReader(csv), helsinki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readings) != 3 {
+		t.Fatalf("Expected 3 readings, got %d", len(readings))
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, helsinki)
+	for i, r := range readings {
+		if want := start.Add(time.Duration(i) * 15 * time.Minute); !r.Start.Equal(want) || r.End.Sub(r.Start) != 15*time.Minute {
+			t.Errorf("Expected reading %d from %s for 15 minutes, got %s-%s", i, want, r.Start, r.End)
+		}
+	}
+	if readings[0].KWh != 0.5 || readings[2].KWh != 1.5 {
+		t.Errorf("Unexpected quantities %+v", readings)
+	}
+}
+
+func TestParse_DSTEnd(t *testing.T) {
+	// 03:00-04:00 happens twice on 2024-10-27
+	csv := "Start Time;Quantity\n" +
+		"2024-10-27 02:00;1\n" +
+		"2024-10-27 03:00;2\n" +
+		"2024-10-27 03:00;3\n" +
+		"2024-10-27 04:00;4\n"
+
+	readings, err := Parse(strings.NewReader(csv), helsinki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range readings {
+		want := time.Date(2024, 10, 26, 23+i, 0, 0, 0, time.UTC)
+		if !r.Start.Equal(want) || r.KWh != float64(i+1) {
+			t.Errorf("Expected reading %d at %s, got %+v", i, want, r)
+		}
+		if r.End.Sub(r.Start) != time.Hour {
+			t.Errorf("Expected an hour long reading, got %s", r.End.Sub(r.Start))
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for csv, want := range map[string]string{
+		"":                                     "empty file",
+		"Time;Quantity\n2024-01-01T00:00Z;1\n": "no start time column",
+		"Start Time;Value\n":                   "no quantity column",
+		"Start Time;Quantity\nyesterday;1\n":   `line 2: invalid start time "yesterday"`,
+		"Start Time;Quantity\n2024-01-01T00:00:00Z;lots\n":                            `line 2: invalid quantity "lots"`,
+		"Start Time;Quantity;Unit\n2024-01-01T00:00:00Z;1;GJ\n":                       `line 2: unsupported unit "GJ"`,
+		"Start Time;Quantity;Resolution\n2024-01-01T00:00:00Z;1;P1D\n":                `line 2: invalid resolution "P1D"`,
+		"Start Time;End Time;Quantity\n2024-01-01T01:00:00Z;2024-01-01T00:00:00Z;1\n": `line 2: invalid end time "2024-01-01T00:00:00Z"`,
+	} {
+		_, err := Parse(strings.NewReader(csv), helsinki)
+		if err == nil || err.Error() != want {
+			t.Errorf("Expected error %q for %q, got %v", want, csv, err)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for s, want := range map[string]float64{
+		"0,74":       0.74,
+		"0.74":       0.74,
+		"1.234,5":    1234.5,
+		"1\u00a0234": 1234,
+		"-2,5":       -2.5,
+	} {
+		if got, err := parseDecimal(s); err != nil || got != want {
+			t.Errorf("parseDecimal(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"PT15M":   15 * time.Minute,
+		"PT1H":    time.Hour,
+		"pt60m":   time.Hour,
+		"PT1H30M": 90 * time.Minute,
+	} {
+		if got, err := parseResolution(s); err != nil || got != want {
+			t.Errorf("parseResolution(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+)
+
+// Admin token scopes.
+const (
+	ScopePricesUpdate   = "prices:update"
+	ScopeWebhooksManage = "webhooks:manage"
+	ScopeAPIKeysManage  = "api-keys:manage"
+	ScopeMetricsRead    = "metrics:read"
+)
+
+// AdminScopes lists all scopes a token can be granted.
+var AdminScopes = []string{ScopePricesUpdate, ScopeWebhooksManage, ScopeAPIKeysManage, ScopeMetricsRead}
+
+// AdminToken is a bearer token for the admin endpoints. Only the SHA-256 hash
+// of the token is stored.
+type AdminToken struct {
+	ID        int64
+	Name      string
+	TokenHash string
+	Scopes    []string
+	// Nil for tokens that never expire
+	Expires *time.Time
+	Created time.Time
+}
+
+// Expired reports whether the token is no longer valid at now.
+func (t AdminToken) Expired(now time.Time) bool {
+	return t.Expires != nil && !now.Before(*t.Expires)
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+// APIKey identifies a third-party consumer of the public API and sets its rate limit.
+// Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID                int64      `json:"id"`
+	Name              string     `json:"name"`
+	KeyHash           string     `json:"-"`
+	RequestsPerMinute int        `json:"requestsPerMinute"`
+	Burst             int        `json:"burst"`
+	RequestCount      int64      `json:"requestCount"`
+	LastUsed          *time.Time `json:"lastUsed"`
+	Created           time.Time  `json:"created"`
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook event types.
+const (
+	WebhookEventPricesIngested = "prices.ingested"
+	WebhookEventPriceThreshold = "price.threshold"
+	WebhookEventPriceNegative  = "price.negative"
+)
+
+// WebhookEvents lists all event types a subscription can listen to.
+var WebhookEvents = []string{WebhookEventPricesIngested, WebhookEventPriceThreshold, WebhookEventPriceNegative}
+
+// WebhookSubscription is an HTTP endpoint notified about price events.
+type WebhookSubscription struct {
+	ID     int64    `json:"id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events"`
+	// Threshold in EUR/MWh for price.threshold events.
+	Threshold *float64  `json:"threshold,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// WebhookDeadLetter is a delivery that failed after all retries.
+type WebhookDeadLetter struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscriptionId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"lastError"`
+	Created        time.Time       `json:"created"`
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+// AdminTokenRepository defines the interface for admin token database operations.
+type AdminTokenRepository interface {
+	CreateToken(ctx context.Context, token *model.AdminToken) error
+	// GetTokenByHash returns nil if no token has the hash.
+	GetTokenByHash(ctx context.Context, hash string) (*model.AdminToken, error)
+}
+
+type pgAdminTokenRepository struct {
+	db DB
+}
+
+// NewAdminTokenRepository creates a new PostgreSQL-backed AdminTokenRepository.
+func NewAdminTokenRepository(db DB) AdminTokenRepository {
+	return &pgAdminTokenRepository{db: db}
+}
+
+const insertAdminTokenQuery = `
+		INSERT INTO admin_token (name, token_hash, scopes, expires)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created
+	`
+
+// CreateToken stores token and fills in its ID and creation time.
+func (r *pgAdminTokenRepository) CreateToken(ctx context.Context, token *model.AdminToken) error {
+	err := r.db.QueryRow(ctx, insertAdminTokenQuery, token.Name, token.TokenHash, token.Scopes, token.Expires).
+		Scan(&token.ID, &token.Created)
+	if err != nil {
+		return fmt.Errorf("failed to insert admin token: %w", err)
+	}
+	return nil
+}
+
+const getAdminTokenByHashQuery = `
+		SELECT id, name, token_hash, scopes, expires, created
+		FROM admin_token
+		WHERE token_hash = $1
+	`
+
+func (r *pgAdminTokenRepository) GetTokenByHash(ctx context.Context, hash string) (*model.AdminToken, error) {
+	var token model.AdminToken
+	err := r.db.QueryRow(ctx, getAdminTokenByHashQuery, hash).
+		Scan(&token.ID, &token.Name, &token.TokenHash, &token.Scopes, &token.Expires, &token.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query admin token: %w", err)
+	}
+	return &token, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminTokenRepository_CreateToken(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewAdminTokenRepository(mock)
+
+	created := time.Now()
+	token := &model.AdminToken{Name: "cron", TokenHash: "abc", Scopes: []string{model.ScopePricesUpdate}}
+	mock.ExpectQuery("INSERT INTO admin_token").
+		WithArgs(token.Name, token.TokenHash, token.Scopes, token.Expires).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created"}).AddRow(int64(1), created))
+
+	assert.NoError(t, r.CreateToken(context.Background(), token))
+	assert.Equal(t, int64(1), token.ID)
+	assert.Equal(t, created, token.Created)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAdminTokenRepository_GetTokenByHash(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewAdminTokenRepository(mock)
+
+	expires := time.Now().Add(time.Hour)
+	mock.ExpectQuery("SELECT id, name, token_hash, scopes, expires, created FROM admin_token").
+		WithArgs("abc").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "token_hash", "scopes", "expires", "created"}).
+			AddRow(int64(1), "cron", "abc", []string{model.ScopePricesUpdate}, &expires, time.Now()))
+	mock.ExpectQuery("SELECT id, name, token_hash, scopes, expires, created FROM admin_token").
+		WithArgs("missing").
+		WillReturnError(pgx.ErrNoRows)
+
+	token, err := r.GetTokenByHash(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "cron", token.Name)
+	assert.Equal(t, expires, *token.Expires)
+
+	token, err = r.GetTokenByHash(context.Background(), "missing")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+// APIKeyRepository defines the interface for API key database operations.
+type APIKeyRepository interface {
+	CreateKey(ctx context.Context, key *model.APIKey) error
+	ListKeys(ctx context.Context) ([]model.APIKey, error)
+	// GetKeyByHash returns nil if no key has the hash.
+	GetKeyByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	DeleteKey(ctx context.Context, id int64) (bool, error)
+	// AddUsage adds request counts by key ID and sets their last use time.
+	AddUsage(ctx context.Context, counts map[int64]int64, lastUsed time.Time) error
+}
+
+type pgAPIKeyRepository struct {
+	db DB
+}
+
+// NewAPIKeyRepository creates a new PostgreSQL-backed APIKeyRepository.
+func NewAPIKeyRepository(db DB) APIKeyRepository {
+	return &pgAPIKeyRepository{db: db}
+}
+
+const insertAPIKeyQuery = `
+		INSERT INTO api_key (name, key_hash, requests_per_minute, burst)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created
+	`
+
+// CreateKey stores key and fills in its ID and creation time.
+func (r *pgAPIKeyRepository) CreateKey(ctx context.Context, key *model.APIKey) error {
+	err := r.db.QueryRow(ctx, insertAPIKeyQuery, key.Name, key.KeyHash, key.RequestsPerMinute, key.Burst).
+		Scan(&key.ID, &key.Created)
+	if err != nil {
+		return fmt.Errorf("failed to insert api key: %w", err)
+	}
+	return nil
+}
+
+const listAPIKeysQuery = `
+		SELECT id, name, key_hash, requests_per_minute, burst, request_count, last_used, created
+		FROM api_key
+		ORDER BY id
+	`
+
+// ListKeys returns all keys with their usage.
+func (r *pgAPIKeyRepository) ListKeys(ctx context.Context) ([]model.APIKey, error) {
+	rows, err := r.db.Query(ctx, listAPIKeysQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []model.APIKey
+	for rows.Next() {
+		var key model.APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.KeyHash, &key.RequestsPerMinute, &key.Burst, &key.RequestCount, &key.LastUsed, &key.Created); err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return keys, nil
+}
+
+const getAPIKeyByHashQuery = `
+		SELECT id, name, key_hash, requests_per_minute, burst, request_count, last_used, created
+		FROM api_key
+		WHERE key_hash = $1
+	`
+
+func (r *pgAPIKeyRepository) GetKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.db.QueryRow(ctx, getAPIKeyByHashQuery, hash).
+		Scan(&key.ID, &key.Name, &key.KeyHash, &key.RequestsPerMinute, &key.Burst, &key.RequestCount, &key.LastUsed, &key.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api key: %w", err)
+	}
+	return &key, nil
+}
+
+// DeleteKey deletes a key. It returns false if the key didn't exist.
+func (r *pgAPIKeyRepository) DeleteKey(ctx context.Context, id int64) (bool, error) {
+	cmdTag, err := r.db.Exec(ctx, "DELETE FROM api_key WHERE id = $1", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete api key: %w", err)
+	}
+	return cmdTag.RowsAffected() > 0, nil
+}
+
+const addAPIKeyUsageQuery = `
+		UPDATE api_key
+		SET request_count = request_count + usage.count, last_used = $3
+		FROM unnest($1::bigint[], $2::bigint[]) AS usage(id, count)
+		WHERE api_key.id = usage.id
+	`
+
+func (r *pgAPIKeyRepository) AddUsage(ctx context.Context, counts map[int64]int64, lastUsed time.Time) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(counts))
+	values := make([]int64, 0, len(counts))
+	for id, count := range counts {
+		ids = append(ids, id)
+		values = append(values, count)
+	}
+
+	if _, err := r.db.Exec(ctx, addAPIKeyUsageQuery, ids, values, lastUsed); err != nil {
+		return fmt.Errorf("failed to update api key usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyRepository_CreateKey(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewAPIKeyRepository(mock)
+
+	created := time.Now()
+	key := &model.APIKey{Name: "integration", KeyHash: "abc", RequestsPerMinute: 600, Burst: 100}
+	mock.ExpectQuery("INSERT INTO api_key").
+		WithArgs(key.Name, key.KeyHash, key.RequestsPerMinute, key.Burst).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created"}).AddRow(int64(4), created))
+
+	assert.NoError(t, r.CreateKey(context.Background(), key))
+	assert.Equal(t, int64(4), key.ID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAPIKeyRepository_ListKeys(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewAPIKeyRepository(mock)
+
+	lastUsed := time.Now()
+	mock.ExpectQuery("SELECT id, name, key_hash, requests_per_minute, burst, request_count, last_used, created FROM api_key").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "key_hash", "requests_per_minute", "burst", "request_count", "last_used", "created"}).
+			AddRow(int64(1), "a", "hash-a", 600, 100, int64(42), &lastUsed, time.Now()).
+			AddRow(int64(2), "b", "hash-b", 60, 10, int64(0), (*time.Time)(nil), time.Now()))
+
+	keys, err := r.ListKeys(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, int64(42), keys[0].RequestCount)
+	assert.Nil(t, keys[1].LastUsed)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAPIKeyRepository_AddUsage(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewAPIKeyRepository(mock)
+
+	now := time.Now()
+	mock.ExpectExec("UPDATE api_key").
+		WithArgs([]int64{1}, []int64{5}, now).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	assert.NoError(t, r.AddUsage(context.Background(), map[int64]int64{1: 5}, now))
+	// Nothing to write
+	assert.NoError(t, r.AddUsage(context.Background(), map[int64]int64{}, now))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
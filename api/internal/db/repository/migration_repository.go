@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// MigrationRepository reads the schema version applied by goose.
+type MigrationRepository interface {
+	GetVersion(ctx context.Context) (int64, error)
+}
+
+type pgMigrationRepository struct {
+	db DB
+}
+
+// NewMigrationRepository creates a new PostgreSQL-backed MigrationRepository.
+func NewMigrationRepository(db DB) MigrationRepository {
+	return &pgMigrationRepository{db: db}
+}
+
+// goose deletes the row of a migration when it is rolled back, so the highest
+// applied version is the current one.
+const getMigrationVersionQuery = `
+		SELECT COALESCE(MAX(version_id), 0)
+		FROM goose_db_version
+		WHERE is_applied
+	`
+
+// GetVersion returns the version of the newest applied migration.
+func (r *pgMigrationRepository) GetVersion(ctx context.Context) (int64, error) {
+	var version int64
+	if err := r.db.QueryRow(ctx, getMigrationVersionQuery).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to query migration version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrationRepository_GetVersion(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewMigrationRepository(mock)
+
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(version_id\\), 0\\) FROM goose_db_version").
+		WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(int64(4)))
+
+	version, err := r.GetVersion(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -15,7 +16,15 @@ import (
 type PriceRepository interface {
 	Select1(ctx context.Context) error
 	GetPrices(ctx context.Context, from, to time.Time) ([]model.PriceHistoryEntry, error)
+	StreamPrices(ctx context.Context, from, to time.Time, fn func(model.PriceHistoryEntry) error) error
+	// GetCoverage returns the total length of the slots starting between from and to.
+	GetCoverage(ctx context.Context, from, to time.Time) (time.Duration, error)
 	InsertPrices(ctx context.Context, entries []model.PriceHistoryEntry) (int64, error)
+	// GetLatestPrice returns the stored price with the latest delivery, or nil if there are none.
+	GetLatestPrice(ctx context.Context) (*model.PriceHistoryEntry, error)
+	// GetLatestInsertTime returns when the price with the latest delivery was
+	// stored, or nil if there are none.
+	GetLatestInsertTime(ctx context.Context) (*time.Time, error)
 }
 
 // DB defines the interface for database operations, compatible with pgxpool.Pool.
@@ -35,9 +44,12 @@ func NewPriceRepository(db DB) PriceRepository {
 }
 
 // Select1 performs a simple health check query.
-func (r *pgPriceRepository) Select1(ctx context.Context) error {
+func (r *pgPriceRepository) Select1(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "PriceRepository.Select1", "SELECT")
+	defer func() { endSpan(span, err) }()
+
 	var n int
-	err := r.db.QueryRow(ctx, "SELECT 1").Scan(&n)
+	err = r.db.QueryRow(ctx, "SELECT 1").Scan(&n)
 	return err
 }
 
@@ -49,7 +61,10 @@ const getPricesQuery = `
 	`
 
 // GetPrices retrieves prices within the specified time range.
-func (r *pgPriceRepository) GetPrices(ctx context.Context, from, to time.Time) ([]model.PriceHistoryEntry, error) {
+func (r *pgPriceRepository) GetPrices(ctx context.Context, from, to time.Time) (_ []model.PriceHistoryEntry, err error) {
+	ctx, span := startSpan(ctx, "PriceRepository.GetPrices", "SELECT")
+	defer func() { endSpan(span, err) }()
+
 	rows, err := r.db.Query(ctx, getPricesQuery, from, to)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query prices: %w", err)
@@ -74,11 +89,108 @@ func (r *pgPriceRepository) GetPrices(ctx context.Context, from, to time.Time) (
 	return entries, nil
 }
 
+// StreamPrices calls fn for each price within the specified time range without
+// loading the whole range into memory. Iteration stops at the first error from fn.
+func (r *pgPriceRepository) StreamPrices(ctx context.Context, from, to time.Time, fn func(model.PriceHistoryEntry) error) (err error) {
+	ctx, span := startSpan(ctx, "PriceRepository.StreamPrices", "SELECT")
+	defer func() { endSpan(span, err) }()
+
+	rows, err := r.db.Query(ctx, getPricesQuery, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to query prices: %w", err)
+	}
+	defer rows.Close()
+
+	var entry model.PriceHistoryEntry
+	for rows.Next() {
+		if err := rows.Scan(&entry.Price, &entry.DeliveryStart, &entry.DeliveryEnd); err != nil {
+			return fmt.Errorf("failed to scan price entry: %w", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+
+	return nil
+}
+
+const getCoverageQuery = `
+		SELECT COALESCE(EXTRACT(EPOCH FROM SUM(delivery_end - delivery_start)), 0)::bigint
+		FROM price_history
+		WHERE delivery_start >= $1 AND delivery_start < $2
+	`
+
+// GetCoverage returns the total length of the slots starting between from and
+// to. Slots don't overlap, so the range is complete when it equals to - from.
+func (r *pgPriceRepository) GetCoverage(ctx context.Context, from, to time.Time) (_ time.Duration, err error) {
+	ctx, span := startSpan(ctx, "PriceRepository.GetCoverage", "SELECT")
+	defer func() { endSpan(span, err) }()
+
+	var seconds int64
+	if err = r.db.QueryRow(ctx, getCoverageQuery, from, to).Scan(&seconds); err != nil {
+		return 0, fmt.Errorf("failed to query price coverage: %w", err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+const getLatestPriceQuery = `
+		SELECT price, delivery_start, delivery_end
+		FROM price_history
+		ORDER BY delivery_start DESC
+		LIMIT 1
+	`
+
+// GetLatestPrice returns the stored price with the latest delivery, or nil if there are none.
+func (r *pgPriceRepository) GetLatestPrice(ctx context.Context) (_ *model.PriceHistoryEntry, err error) {
+	ctx, span := startSpan(ctx, "PriceRepository.GetLatestPrice", "SELECT")
+	defer func() { endSpan(span, err) }()
+
+	var entry model.PriceHistoryEntry
+	err = r.db.QueryRow(ctx, getLatestPriceQuery).Scan(&entry.Price, &entry.DeliveryStart, &entry.DeliveryEnd)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest price: %w", err)
+	}
+	return &entry, nil
+}
+
+const getLatestInsertTimeQuery = `
+		SELECT created
+		FROM price_history
+		ORDER BY delivery_start DESC
+		LIMIT 1
+	`
+
+// GetLatestInsertTime returns when the price with the latest delivery was
+// stored, or nil if there are none. Backfilled old days don't move it.
+func (r *pgPriceRepository) GetLatestInsertTime(ctx context.Context) (_ *time.Time, err error) {
+	ctx, span := startSpan(ctx, "PriceRepository.GetLatestInsertTime", "SELECT")
+	defer func() { endSpan(span, err) }()
+
+	var created time.Time
+	err = r.db.QueryRow(ctx, getLatestInsertTimeQuery).Scan(&created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest insert time: %w", err)
+	}
+	return &created, nil
+}
+
 // InsertPrices batch inserts price entries with ON CONFLICT DO NOTHING.
-func (r *pgPriceRepository) InsertPrices(ctx context.Context, entries []model.PriceHistoryEntry) (int64, error) {
+func (r *pgPriceRepository) InsertPrices(ctx context.Context, entries []model.PriceHistoryEntry) (_ int64, err error) {
 	if len(entries) == 0 {
 		return 0, nil
 	}
+	ctx, span := startSpan(ctx, "PriceRepository.InsertPrices", "INSERT")
+	defer func() { endSpan(span, err) }()
 
 	// Build dynamic INSERT with multiple VALUES
 	// SQL: INSERT INTO price_history (delivery_start, delivery_end, price) VALUES ($1, $2, $3), ($4, $5, $6) ... ON CONFLICT (delivery_start) DO NOTHING
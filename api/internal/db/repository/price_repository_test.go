@@ -2,12 +2,19 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/samlof/ehin/internal/db/model"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestPriceRepository_Select1(t *testing.T) {
@@ -59,6 +66,39 @@ func TestPriceRepository_GetPrices(t *testing.T) {
 	}
 }
 
+func TestPriceRepository_StreamPrices(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewPriceRepository(mock)
+
+	from := time.Now()
+	to := from.Add(24 * time.Hour)
+
+	rows := pgxmock.NewRows([]string{"price", "delivery_start", "delivery_end"}).
+		AddRow(10.5, from, from.Add(time.Hour)).
+		AddRow(12.0, from.Add(time.Hour), from.Add(2*time.Hour))
+
+	mock.ExpectQuery("SELECT price, delivery_start, delivery_end FROM price_history").
+		WithArgs(from, to).
+		WillReturnRows(rows)
+
+	var prices []float64
+	err = r.StreamPrices(context.Background(), from, to, func(entry model.PriceHistoryEntry) error {
+		prices = append(prices, entry.Price)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{10.5, 12.0}, prices)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestPriceRepository_InsertPrices(t *testing.T) {
 	mock, err := pgxmock.NewPool()
 	if err != nil {
@@ -94,3 +134,132 @@ func TestPriceRepository_InsertPrices(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestPriceRepository_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewPriceRepository(mock)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "update")
+	now := time.Now()
+	mock.ExpectQuery("SELECT price, delivery_start, delivery_end FROM price_history").
+		WithArgs(now, now).
+		WillReturnRows(pgxmock.NewRows([]string{"price", "delivery_start", "delivery_end"}))
+	mock.ExpectExec("INSERT INTO price_history").
+		WithArgs(time.Time{}, time.Time{}, 1.0).
+		WillReturnError(errors.New("connection reset"))
+
+	_, err = r.GetPrices(ctx, now, now)
+	assert.NoError(t, err)
+	_, err = r.InsertPrices(ctx, []model.PriceHistoryEntry{{Price: 1}})
+	assert.Error(t, err)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 3)
+
+	get, insert := spans[0], spans[1]
+	assert.Equal(t, "PriceRepository.GetPrices", get.Name)
+	assert.Equal(t, trace.SpanKindClient, get.SpanKind)
+	assert.Contains(t, get.Attributes, attribute.String("db.system", "postgresql"))
+	assert.Contains(t, get.Attributes, attribute.String("db.operation", "SELECT"))
+	assert.Equal(t, codes.Unset, get.Status.Code)
+	assert.Equal(t, parent.SpanContext().SpanID(), get.Parent.SpanID())
+
+	assert.Equal(t, "PriceRepository.InsertPrices", insert.Name)
+	assert.Equal(t, codes.Error, insert.Status.Code)
+	assert.Equal(t, parent.SpanContext().SpanID(), insert.Parent.SpanID())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPriceRepository_GetLatestPrice(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewPriceRepository(mock)
+
+	start := time.Date(2025, 1, 2, 21, 45, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT price, delivery_start, delivery_end FROM price_history ORDER BY delivery_start DESC").
+		WillReturnRows(pgxmock.NewRows([]string{"price", "delivery_start", "delivery_end"}).AddRow(4.2, start, start.Add(15*time.Minute)))
+	mock.ExpectQuery("SELECT price, delivery_start, delivery_end FROM price_history ORDER BY delivery_start DESC").
+		WillReturnRows(pgxmock.NewRows([]string{"price", "delivery_start", "delivery_end"}))
+
+	latest, err := r.GetLatestPrice(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, start, latest.DeliveryStart)
+
+	// Empty table
+	latest, err = r.GetLatestPrice(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, latest)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPriceRepository_GetLatestInsertTime(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewPriceRepository(mock)
+
+	created := time.Date(2025, 1, 1, 12, 0, 3, 0, time.UTC)
+	mock.ExpectQuery("SELECT created FROM price_history ORDER BY delivery_start DESC").
+		WillReturnRows(pgxmock.NewRows([]string{"created"}).AddRow(created))
+	mock.ExpectQuery("SELECT created FROM price_history ORDER BY delivery_start DESC").
+		WillReturnRows(pgxmock.NewRows([]string{"created"}))
+
+	latest, err := r.GetLatestInsertTime(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, created, *latest)
+
+	// Empty table
+	latest, err = r.GetLatestInsertTime(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, latest)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPriceRepository_GetCoverage(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewPriceRepository(mock)
+
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	mock.ExpectQuery("SELECT COALESCE").
+		WithArgs(from, to).
+		WillReturnRows(pgxmock.NewRows([]string{"coalesce"}).AddRow(int64(86400)))
+
+	covered, err := r.GetCoverage(context.Background(), from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, covered)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The tracer is looked up per span so tests can swap the global provider.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/samlof/ehin/internal/db/repository")
+}
+
+// startSpan starts a client span for a database operation such as SELECT.
+func startSpan(ctx context.Context, name, operation string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", operation),
+	))
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
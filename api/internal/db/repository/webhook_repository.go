@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+// WebhookRepository defines the interface for webhook subscription database operations.
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, sub *model.WebhookSubscription) error
+	ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	ListSubscriptionsForEvent(ctx context.Context, event string) ([]model.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id int64) (bool, error)
+	InsertDeadLetter(ctx context.Context, deadLetter model.WebhookDeadLetter) error
+	ListDeadLetters(ctx context.Context, limit int) ([]model.WebhookDeadLetter, error)
+}
+
+type pgWebhookRepository struct {
+	db DB
+}
+
+// NewWebhookRepository creates a new PostgreSQL-backed WebhookRepository.
+func NewWebhookRepository(db DB) WebhookRepository {
+	return &pgWebhookRepository{db: db}
+}
+
+const insertSubscriptionQuery = `
+		INSERT INTO webhook_subscription (url, secret, events, threshold)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created
+	`
+
+// CreateSubscription stores sub and fills in its ID and creation time.
+func (r *pgWebhookRepository) CreateSubscription(ctx context.Context, sub *model.WebhookSubscription) error {
+	err := r.db.QueryRow(ctx, insertSubscriptionQuery, sub.URL, sub.Secret, sub.Events, sub.Threshold).
+		Scan(&sub.ID, &sub.Created)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook subscription: %w", err)
+	}
+	return nil
+}
+
+const listSubscriptionsQuery = `
+		SELECT id, url, secret, events, threshold, created
+		FROM webhook_subscription
+		ORDER BY id
+	`
+
+// ListSubscriptions returns all subscriptions.
+func (r *pgWebhookRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	return r.querySubscriptions(ctx, listSubscriptionsQuery)
+}
+
+const listSubscriptionsForEventQuery = `
+		SELECT id, url, secret, events, threshold, created
+		FROM webhook_subscription
+		WHERE $1 = ANY(events)
+		ORDER BY id
+	`
+
+// ListSubscriptionsForEvent returns the subscriptions listening to event.
+func (r *pgWebhookRepository) ListSubscriptionsForEvent(ctx context.Context, event string) ([]model.WebhookSubscription, error) {
+	return r.querySubscriptions(ctx, listSubscriptionsForEventQuery, event)
+}
+
+func (r *pgWebhookRepository) querySubscriptions(ctx context.Context, query string, args ...any) ([]model.WebhookSubscription, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []model.WebhookSubscription
+	for rows.Next() {
+		var sub model.WebhookSubscription
+		if err := rows.Scan(&sub.ID, &sub.URL, &sub.Secret, &sub.Events, &sub.Threshold, &sub.Created); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return subs, nil
+}
+
+// DeleteSubscription deletes a subscription and its dead letters.
+// It returns false if the subscription didn't exist.
+func (r *pgWebhookRepository) DeleteSubscription(ctx context.Context, id int64) (bool, error) {
+	cmdTag, err := r.db.Exec(ctx, "DELETE FROM webhook_subscription WHERE id = $1", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	return cmdTag.RowsAffected() > 0, nil
+}
+
+const insertDeadLetterQuery = `
+		INSERT INTO webhook_dead_letter (subscription_id, event, payload, attempts, last_error)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+// InsertDeadLetter stores a delivery that failed after all retries.
+func (r *pgWebhookRepository) InsertDeadLetter(ctx context.Context, dl model.WebhookDeadLetter) error {
+	_, err := r.db.Exec(ctx, insertDeadLetterQuery, dl.SubscriptionID, dl.Event, string(dl.Payload), dl.Attempts, dl.LastError)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook dead letter: %w", err)
+	}
+	return nil
+}
+
+const listDeadLettersQuery = `
+		SELECT id, subscription_id, event, payload, attempts, last_error, created
+		FROM webhook_dead_letter
+		ORDER BY id DESC
+		LIMIT $1
+	`
+
+// ListDeadLetters returns the most recent dead letters first.
+func (r *pgWebhookRepository) ListDeadLetters(ctx context.Context, limit int) ([]model.WebhookDeadLetter, error) {
+	rows, err := r.db.Query(ctx, listDeadLettersQuery, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var deadLetters []model.WebhookDeadLetter
+	for rows.Next() {
+		var dl model.WebhookDeadLetter
+		var payload string
+		if err := rows.Scan(&dl.ID, &dl.SubscriptionID, &dl.Event, &payload, &dl.Attempts, &dl.LastError, &dl.Created); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook dead letter: %w", err)
+		}
+		dl.Payload = []byte(payload)
+		deadLetters = append(deadLetters, dl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return deadLetters, nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookRepository_CreateSubscription(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewWebhookRepository(mock)
+
+	threshold := 150.0
+	created := time.Now()
+	sub := &model.WebhookSubscription{
+		URL:       "https://example.com/hook",
+		Secret:    "s3cret",
+		Events:    []string{model.WebhookEventPriceThreshold},
+		Threshold: &threshold,
+	}
+
+	mock.ExpectQuery("INSERT INTO webhook_subscription").
+		WithArgs(sub.URL, sub.Secret, sub.Events, sub.Threshold).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created"}).AddRow(int64(7), created))
+
+	err = r.CreateSubscription(context.Background(), sub)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), sub.ID)
+	assert.Equal(t, created, sub.Created)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWebhookRepository_ListSubscriptionsForEvent(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewWebhookRepository(mock)
+
+	threshold := 150.0
+	rows := pgxmock.NewRows([]string{"id", "url", "secret", "events", "threshold", "created"}).
+		AddRow(int64(1), "https://a.example.com", "a", []string{model.WebhookEventPriceNegative}, (*float64)(nil), time.Now()).
+		AddRow(int64(2), "https://b.example.com", "b", []string{model.WebhookEventPriceNegative, model.WebhookEventPriceThreshold}, &threshold, time.Now())
+
+	mock.ExpectQuery("SELECT id, url, secret, events, threshold, created FROM webhook_subscription WHERE").
+		WithArgs(model.WebhookEventPriceNegative).
+		WillReturnRows(rows)
+
+	subs, err := r.ListSubscriptionsForEvent(context.Background(), model.WebhookEventPriceNegative)
+	assert.NoError(t, err)
+	assert.Len(t, subs, 2)
+	assert.Nil(t, subs[0].Threshold)
+	assert.Equal(t, 150.0, *subs[1].Threshold)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWebhookRepository_DeleteSubscription(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewWebhookRepository(mock)
+
+	mock.ExpectExec("DELETE FROM webhook_subscription").
+		WithArgs(int64(3)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	deleted, err := r.DeleteSubscription(context.Background(), 3)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWebhookRepository_DeadLetters(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	r := NewWebhookRepository(mock)
+
+	dl := model.WebhookDeadLetter{
+		SubscriptionID: 1,
+		Event:          model.WebhookEventPricesIngested,
+		Payload:        []byte(`{"event":"prices.ingested"}`),
+		Attempts:       5,
+		LastError:      "unexpected status 500",
+	}
+	mock.ExpectExec("INSERT INTO webhook_dead_letter").
+		WithArgs(dl.SubscriptionID, dl.Event, string(dl.Payload), dl.Attempts, dl.LastError).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	assert.NoError(t, r.InsertDeadLetter(context.Background(), dl))
+
+	mock.ExpectQuery("SELECT id, subscription_id, event, payload, attempts, last_error, created FROM webhook_dead_letter").
+		WithArgs(10).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "subscription_id", "event", "payload", "attempts", "last_error", "created"}).
+			AddRow(int64(1), dl.SubscriptionID, dl.Event, string(dl.Payload), dl.Attempts, dl.LastError, time.Now()))
+
+	deadLetters, err := r.ListDeadLetters(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, deadLetters, 1)
+	assert.JSONEq(t, string(dl.Payload), string(deadLetters[0].Payload))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
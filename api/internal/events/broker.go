@@ -0,0 +1,256 @@
+// Package events fans out live price events to streaming clients.
+//
+// Event types:
+//
+//	slot  the slot being delivered changed, sent at every slot boundary
+//	day   prices for a new delivery day were ingested
+//
+// Every event gets an increasing ID. The broker keeps a short history so that
+// reconnecting clients can resume from the last ID they saw.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/service"
+)
+
+const (
+	TypeSlot = "slot"
+	TypeDay  = "day"
+
+	// Number of past events kept for resuming.
+	historySize = 64
+	// Events buffered per subscriber. Subscribers that fall further behind are dropped
+	// and can resume after reconnecting.
+	subscriberBuffer = 16
+	// Used when there is no current slot in the database to tell when the next one starts.
+	fallbackSlotLength = 15 * time.Minute
+	// How long to wait before retrying after the database couldn't be read.
+	retryDelay = time.Minute
+)
+
+// ErrTooManySubscribers is returned by Subscribe when the connection limit is reached.
+var ErrTooManySubscribers = errors.New("too many subscribers")
+
+type Event struct {
+	ID   uint64
+	Type string
+	Area string
+	// JSON encoded payload
+	Data []byte
+}
+
+// SlotData is the payload of slot events. Prices are in EUR/MWh.
+type SlotData struct {
+	Area  string    `json:"area"`
+	Price float64   `json:"price"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// DayData is the payload of day events. Date is the Helsinki delivery date.
+type DayData struct {
+	Area       string `json:"area"`
+	Date       string `json:"date"`
+	PriceCount int    `json:"priceCount"`
+}
+
+// Subscription receives events until it is closed by the broker or unsubscribed.
+type Subscription struct {
+	C  <-chan Event
+	ch chan Event
+}
+
+type Broker struct {
+	priceRepository repository.PriceRepository
+	timeProvider    service.TimeProvider
+	maxSubscribers  int
+
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	lastSlot    map[string]Event
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBroker(priceRepository repository.PriceRepository, timeProvider service.TimeProvider, maxSubscribers int) *Broker {
+	return &Broker{
+		priceRepository: priceRepository,
+		timeProvider:    timeProvider,
+		maxSubscribers:  maxSubscribers,
+		lastSlot:        map[string]Event{},
+		subscribers:     map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe registers a new subscriber and returns the events it should be sent first.
+// When resume is set those are the events after lastEventID. If they are no longer
+// in the history, or resume isn't set, the latest slot event of every area is returned instead.
+func (b *Broker) Subscribe(lastEventID uint64, resume bool) (*Subscription, []Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.subscribers) >= b.maxSubscribers {
+		return nil, nil, ErrTooManySubscribers
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch}
+	b.subscribers[sub] = struct{}{}
+
+	if resume && lastEventID <= b.lastID && (len(b.history) == 0 || lastEventID+1 >= b.history[0].ID) {
+		var backlog []Event
+		for _, e := range b.history {
+			if e.ID > lastEventID {
+				backlog = append(backlog, e)
+			}
+		}
+		return sub, backlog, nil
+	}
+
+	var backlog []Event
+	for _, area := range service.StoredAreas {
+		if e, ok := b.lastSlot[area]; ok {
+			backlog = append(backlog, e)
+		}
+	}
+	return sub, backlog, nil
+}
+
+// Unsubscribe removes sub. It is safe to call after the broker dropped sub.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// LastSlot returns the latest slot event of area.
+func (b *Broker) LastSlot(area string) (Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.lastSlot[area]
+	return e, ok
+}
+
+// Subscribers returns the number of connected subscribers.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// Publish sends an event about area to all subscribers.
+func (b *Broker) Publish(area, eventType string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Error encoding event", "type", eventType, "error", err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{ID: b.lastID, Type: eventType, Area: area, Data: payload}
+	if len(b.history) == historySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, event)
+	if eventType == TypeSlot {
+		b.lastSlot[area] = event
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+			slog.Warn("Dropping slow event subscriber")
+			b.remove(sub)
+		}
+	}
+}
+
+// PricesIngested publishes a day event for newly stored prices.
+func (b *Broker) PricesIngested(_ context.Context, area string, entries []model.PriceHistoryEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		slog.Error("Failed to load Europe/Helsinki", "error", err)
+		return
+	}
+	b.Publish(area, TypeDay, DayData{
+		Area:       area,
+		Date:       entries[0].DeliveryStart.In(helsinki).Format("2006-01-02"),
+		PriceCount: len(entries),
+	})
+}
+
+// PublishCurrent publishes the slot being delivered now in area unless it was
+// already published, and returns when the next slot starts.
+func (b *Broker) PublishCurrent(ctx context.Context, area string) (time.Time, error) {
+	now := b.timeProvider.Now()
+	prices, err := b.priceRepository.GetPrices(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return now.Add(retryDelay), err
+	}
+
+	i := service.SlotAt(prices, now)
+	if i < 0 {
+		slog.Warn("No current price to publish", "area", area)
+		return now.Truncate(fallbackSlotLength).Add(fallbackSlotLength), nil
+	}
+	current := prices[i]
+
+	last, ok := b.LastSlot(area)
+	data := SlotData{Area: area, Price: current.Price, Start: current.DeliveryStart, End: current.DeliveryEnd}
+	if ok {
+		var lastData SlotData
+		if err := json.Unmarshal(last.Data, &lastData); err == nil && lastData.Start.Equal(data.Start) {
+			return current.DeliveryEnd, nil
+		}
+	}
+
+	b.Publish(area, TypeSlot, data)
+	return current.DeliveryEnd, nil
+}
+
+// Run publishes the current slot of every stored area at each slot boundary until ctx is done.
+func (b *Broker) Run(ctx context.Context) {
+	for {
+		next := b.timeProvider.Now().Add(fallbackSlotLength)
+		for _, area := range service.StoredAreas {
+			areaNext, err := b.PublishCurrent(ctx, area)
+			if err != nil {
+				slog.Error("Error publishing current price event", "area", area, "error", err)
+			}
+			if areaNext.Before(next) {
+				next = areaNext
+			}
+		}
+
+		timer := time.NewTimer(max(time.Until(next), time.Second))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBroker_PublishAndResume(t *testing.T) {
+	b := NewBroker(nil, nil, 10)
+
+	first, backlog, err := b.Subscribe(0, false)
+	assert.NoError(t, err)
+	assert.Empty(t, backlog)
+
+	b.Publish("FI", TypeDay, DayData{Area: "FI", Date: "2025-01-02", PriceCount: 96})
+	b.Publish("FI", TypeDay, DayData{Area: "FI", Date: "2025-01-03", PriceCount: 96})
+
+	e := <-first.C
+	assert.Equal(t, uint64(1), e.ID)
+	assert.Equal(t, TypeDay, e.Type)
+	assert.JSONEq(t, `{"area":"FI","date":"2025-01-02","priceCount":96}`, string(e.Data))
+	assert.Equal(t, uint64(2), (<-first.C).ID)
+
+	// Resuming after the first event replays only the second
+	second, backlog, err := b.Subscribe(1, true)
+	assert.NoError(t, err)
+	assert.Len(t, backlog, 1)
+	assert.Equal(t, uint64(2), backlog[0].ID)
+
+	assert.Equal(t, 2, b.Subscribers())
+	b.Unsubscribe(first)
+	b.Unsubscribe(second)
+	b.Unsubscribe(second)
+	assert.Equal(t, 0, b.Subscribers())
+
+	_, ok := <-first.C
+	assert.False(t, ok)
+}
+
+func TestBroker_ResumeOutsideHistory(t *testing.T) {
+	b := NewBroker(nil, nil, 10)
+
+	slot := SlotData{Area: "FI", Price: 12.5, Start: time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC), End: time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)}
+	b.Publish("FI", TypeSlot, slot)
+	for range historySize {
+		b.Publish("FI", TypeDay, DayData{Area: "FI"})
+	}
+
+	// The missed events are gone, so the client gets the current state instead
+	_, backlog, err := b.Subscribe(0, true)
+	assert.NoError(t, err)
+	assert.Len(t, backlog, 1)
+	assert.Equal(t, TypeSlot, backlog[0].Type)
+
+	// IDs from before a restart are also unknown
+	_, backlog, err = b.Subscribe(1000, true)
+	assert.NoError(t, err)
+	assert.Len(t, backlog, 1)
+	assert.Equal(t, uint64(1), backlog[0].ID)
+}
+
+func TestBroker_ConnectionLimit(t *testing.T) {
+	b := NewBroker(nil, nil, 1)
+
+	sub, _, err := b.Subscribe(0, false)
+	assert.NoError(t, err)
+
+	_, _, err = b.Subscribe(0, false)
+	assert.True(t, errors.Is(err, ErrTooManySubscribers))
+
+	b.Unsubscribe(sub)
+	_, _, err = b.Subscribe(0, false)
+	assert.NoError(t, err)
+}
+
+func TestBroker_DropsSlowSubscribers(t *testing.T) {
+	b := NewBroker(nil, nil, 10)
+	sub, _, _ := b.Subscribe(0, false)
+
+	for range subscriberBuffer + 1 {
+		b.Publish("FI", TypeDay, DayData{Area: "FI"})
+	}
+
+	assert.Equal(t, 0, b.Subscribers())
+	count := 0
+	for range sub.C {
+		count++
+	}
+	assert.Equal(t, subscriberBuffer, count)
+}
+
+func TestBroker_PublishCurrent(t *testing.T) {
+	now := time.Date(2025, 1, 1, 10, 20, 0, 0, time.UTC)
+	slotStart := time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)
+	entries := []model.PriceHistoryEntry{
+		{Price: 5, DeliveryStart: slotStart.Add(-15 * time.Minute), DeliveryEnd: slotStart},
+		{Price: 7.5, DeliveryStart: slotStart, DeliveryEnd: slotStart.Add(15 * time.Minute)},
+	}
+	repo := new(testutil.MockPriceRepository)
+	repo.On("GetPrices", mock.Anything, now.Add(-time.Hour), now.Add(time.Hour)).Return(entries, nil)
+
+	b := NewBroker(repo, testutil.FixedTime{Time: now}, 10)
+	sub, _, _ := b.Subscribe(0, false)
+
+	next, err := b.PublishCurrent(context.Background(), "FI")
+	assert.NoError(t, err)
+	assert.Equal(t, slotStart.Add(15*time.Minute), next)
+
+	e := <-sub.C
+	assert.Equal(t, TypeSlot, e.Type)
+	var data SlotData
+	assert.NoError(t, json.Unmarshal(e.Data, &data))
+	assert.Equal(t, 7.5, data.Price)
+	assert.True(t, data.Start.Equal(slotStart))
+
+	// The same slot isn't published twice
+	_, err = b.PublishCurrent(context.Background(), "FI")
+	assert.NoError(t, err)
+	assert.Len(t, sub.C, 0)
+}
+
+func TestBroker_PricesIngested(t *testing.T) {
+	b := NewBroker(nil, nil, 10)
+	sub, _, _ := b.Subscribe(0, false)
+
+	// Midnight in Helsinki
+	start := time.Date(2025, 1, 1, 22, 0, 0, 0, time.UTC)
+	b.PricesIngested(context.Background(), "FI", []model.PriceHistoryEntry{
+		{Price: 1, DeliveryStart: start, DeliveryEnd: start.Add(15 * time.Minute)},
+	})
+
+	e := <-sub.C
+	assert.Equal(t, TypeDay, e.Type)
+	assert.JSONEq(t, `{"area":"FI","date":"2025-01-02","priceCount":1}`, string(e.Data))
+}
+
+func TestBroker_LastSlot(t *testing.T) {
+	b := NewBroker(nil, nil, 10)
+
+	_, ok := b.LastSlot("FI")
+	assert.False(t, ok)
+
+	b.Publish("FI", TypeSlot, SlotData{Area: "FI", Price: 1})
+	b.Publish("FI", TypeDay, DayData{Area: "FI"})
+
+	e, ok := b.LastSlot("FI")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), e.ID)
+	assert.Equal(t, "FI", e.Area)
+}
@@ -0,0 +1,154 @@
+// Package gql serves price data over GraphQL, so dashboards can fetch prices,
+// daily stats and cheapest windows for several areas in one request.
+//
+// Queries are limited in depth and estimated cost before they run. Clients can
+// send the SHA-256 of a query instead of the query itself after registering it
+// once, following Apollo's automatic persisted queries protocol.
+package gql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/logging"
+	"github.com/samlof/ehin/internal/service"
+)
+
+// How many persisted queries are kept in memory.
+const maxPersistedQueries = 1000
+
+// Error codes in the extensions of errors returned before execution.
+const (
+	CodePersistedQueryNotFound     = "PERSISTED_QUERY_NOT_FOUND"
+	CodePersistedQueryNotSupported = "PERSISTED_QUERY_NOT_SUPPORTED"
+	CodeQueryTooComplex            = "QUERY_TOO_COMPLEX"
+	CodeBadRequest                 = "BAD_REQUEST"
+)
+
+// Request is a GraphQL request as sent over HTTP.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	Extensions    Extensions     `json:"extensions"`
+}
+
+type Extensions struct {
+	PersistedQuery *PersistedQuery `json:"persistedQuery,omitempty"`
+}
+
+// PersistedQuery identifies a query by the hex SHA-256 of its text.
+type PersistedQuery struct {
+	Version    int    `json:"version"`
+	SHA256Hash string `json:"sha256Hash"`
+}
+
+// Executor runs GraphQL requests against the price schema. It is safe for
+// concurrent use.
+type Executor struct {
+	schema        graphql.Schema
+	maxDepth      int
+	maxComplexity int
+	// Nil when persisted queries are disabled
+	persisted *queryStore
+}
+
+func NewExecutor(
+	cfg *config.Config,
+	priceRepository repository.PriceRepository,
+	timeProvider service.TimeProvider,
+) (*Executor, error) {
+	schema, err := newSchema(&resolver{
+		priceRepository: priceRepository,
+		timeProvider:    timeProvider,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("building schema: %w", err)
+	}
+
+	e := &Executor{
+		schema:        schema,
+		maxDepth:      cfg.GraphQLMaxDepth,
+		maxComplexity: cfg.GraphQLMaxComplexity,
+	}
+	if cfg.GraphQLPersistedQueries {
+		e.persisted = newQueryStore(maxPersistedQueries)
+	}
+	return e, nil
+}
+
+// Execute runs req. Errors, including invalid queries, are reported in the
+// result rather than returned.
+func (e *Executor) Execute(ctx context.Context, req Request) *graphql.Result {
+	query := req.Query
+	// Set when the request registers a persisted query
+	register := ""
+	if pq := req.Extensions.PersistedQuery; pq != nil {
+		if e.persisted == nil {
+			return errorResult("PersistedQueryNotSupported", CodePersistedQueryNotSupported)
+		}
+		if query == "" {
+			var ok bool
+			if query, ok = e.persisted.get(pq.SHA256Hash); !ok {
+				return errorResult("PersistedQueryNotFound", CodePersistedQueryNotFound)
+			}
+		} else {
+			sum := sha256.Sum256([]byte(query))
+			if hex.EncodeToString(sum[:]) != pq.SHA256Hash {
+				return errorResult("provided sha does not match query", CodeBadRequest)
+			}
+			register = pq.SHA256Hash
+		}
+	}
+	if query == "" {
+		return errorResult("must provide a query", CodeBadRequest)
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if v := graphql.ValidateDocument(&e.schema, doc, nil); !v.IsValid {
+		return &graphql.Result{Errors: v.Errors}
+	}
+
+	c := analyze(doc, req.OperationName, req.Variables)
+	if c.depth > e.maxDepth {
+		return errorResult(fmt.Sprintf("query depth %d exceeds the limit of %d", c.depth, e.maxDepth), CodeQueryTooComplex)
+	}
+	if c.complexity > e.maxComplexity {
+		return errorResult(fmt.Sprintf("query complexity %d exceeds the limit of %d", c.complexity, e.maxComplexity), CodeQueryTooComplex)
+	}
+	// Only queries that can run are stored, so invalid ones can't evict them
+	if register != "" {
+		e.persisted.put(register, query)
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        e.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withLoader(ctx),
+	})
+}
+
+func errorResult(message, code string) *graphql.Result {
+	err := gqlerrors.NewFormattedError(message)
+	err.Extensions = map[string]any{"code": code}
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{err}}
+}
+
+// internalError logs err and returns an error that doesn't leak its details.
+func internalError(ctx context.Context, msg string, err error) error {
+	logging.FromContext(ctx).Error(msg, "error", err)
+	return errors.New("internal error")
+}
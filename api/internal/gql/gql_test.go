@@ -0,0 +1,319 @@
+package gql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var day = time.Date(2025, 3, 10, 0, 0, 0, 0, helsinki)
+
+// dayEntries returns the 96 slots of day priced 0, 1, 2 and so on.
+func dayEntries() []model.PriceHistoryEntry {
+	entries := make([]model.PriceHistoryEntry, 96)
+	for i := range entries {
+		start := day.Add(time.Duration(i) * 15 * time.Minute)
+		entries[i] = model.PriceHistoryEntry{Price: float64(i), DeliveryStart: start, DeliveryEnd: start.Add(15 * time.Minute)}
+	}
+	return entries
+}
+
+func newTestExecutor(t *testing.T, repo *testutil.MockPriceRepository, cfg *config.Config) *Executor {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.Config{GraphQLMaxDepth: 8, GraphQLMaxComplexity: 50000, GraphQLPersistedQueries: true}
+	}
+	e, err := NewExecutor(cfg, repo, testutil.FixedTime{Time: day.Add(15 * time.Hour)})
+	require.NoError(t, err)
+	return e
+}
+
+// decode round-trips the result through JSON as it is sent to clients.
+func decode(t *testing.T, result *graphql.Result, v any) {
+	t.Helper()
+	require.Empty(t, result.Errors)
+	b, err := json.Marshal(result.Data)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, v))
+}
+
+func TestExecutor_Areas(t *testing.T) {
+	repo := new(testutil.MockPriceRepository)
+	// Every field of every area shares a single query
+	repo.On("GetPrices", mock.Anything, day, day.AddDate(0, 0, 1)).Return(dayEntries(), nil).Once()
+	e := newTestExecutor(t, repo, nil)
+
+	result := e.Execute(context.Background(), Request{
+		Query: `query Dashboard($from: String!, $to: String!) {
+			areas {
+				name
+				currency
+				unit
+				prices(from: $from, to: $to) { start end price resolution }
+				dailyStats(from: $from, to: $to) { date min max average slots complete }
+				cheapestWindow(from: $from, to: $to, minutes: 60) { start end averagePrice }
+			}
+			fi: area(name: "fi") { name }
+			se: area(name: "SE3") { name }
+		}`,
+		Variables: map[string]any{"from": "2025-03-10", "to": "2025-03-10"},
+	})
+
+	var data struct {
+		Areas []struct {
+			Name     string
+			Currency string
+			Unit     string
+			Prices   []struct {
+				Start      time.Time
+				End        time.Time
+				Price      float64
+				Resolution string
+			}
+			DailyStats []struct {
+				Date     string
+				Min      *float64
+				Max      *float64
+				Average  *float64
+				Slots    int
+				Complete bool
+			}
+			CheapestWindow *struct {
+				Start        time.Time
+				End          time.Time
+				AveragePrice float64
+			}
+		}
+		FI *struct{ Name string }
+		SE *struct{ Name string }
+	}
+	decode(t, result, &data)
+	repo.AssertExpectations(t)
+
+	require.Len(t, data.Areas, 1)
+	a := data.Areas[0]
+	assert.Equal(t, "FI", a.Name)
+	assert.Equal(t, "EUR", a.Currency)
+	assert.Equal(t, "EUR/MWh", a.Unit)
+
+	require.Len(t, a.Prices, 96)
+	assert.True(t, a.Prices[4].Start.Equal(day.Add(time.Hour)))
+	assert.True(t, a.Prices[4].End.Equal(day.Add(75*time.Minute)))
+	assert.Equal(t, 4.0, a.Prices[4].Price)
+	assert.Equal(t, "PT15M", a.Prices[4].Resolution)
+
+	require.Len(t, a.DailyStats, 1)
+	stats := a.DailyStats[0]
+	assert.Equal(t, "2025-03-10", stats.Date)
+	assert.Equal(t, 0.0, *stats.Min)
+	assert.Equal(t, 95.0, *stats.Max)
+	assert.InDelta(t, 47.5, *stats.Average, 1e-9)
+	assert.Equal(t, 96, stats.Slots)
+	assert.True(t, stats.Complete)
+
+	require.NotNil(t, a.CheapestWindow)
+	assert.True(t, a.CheapestWindow.Start.Equal(day))
+	assert.True(t, a.CheapestWindow.End.Equal(day.Add(time.Hour)))
+	assert.InDelta(t, 1.5, a.CheapestWindow.AveragePrice, 1e-9)
+
+	require.NotNil(t, data.FI)
+	assert.Equal(t, "FI", data.FI.Name)
+	assert.Nil(t, data.SE)
+}
+
+func TestExecutor_DailyStatsWithoutPrices(t *testing.T) {
+	repo := new(testutil.MockPriceRepository)
+	next := day.AddDate(0, 0, 1)
+	repo.On("GetPrices", mock.Anything, day, next.AddDate(0, 0, 1)).Return(dayEntries()[:40], nil)
+	e := newTestExecutor(t, repo, nil)
+
+	result := e.Execute(context.Background(), Request{
+		Query: `{ area(name: "FI") { dailyStats(from: "2025-03-10", to: "2025-03-11") { date min slots complete } } }`,
+	})
+
+	var data struct {
+		Area struct {
+			DailyStats []struct {
+				Date     string
+				Min      *float64
+				Slots    int
+				Complete bool
+			}
+		}
+	}
+	decode(t, result, &data)
+	require.Len(t, data.Area.DailyStats, 2)
+	assert.Equal(t, 40, data.Area.DailyStats[0].Slots)
+	assert.False(t, data.Area.DailyStats[0].Complete)
+	assert.Equal(t, "2025-03-11", data.Area.DailyStats[1].Date)
+	assert.Nil(t, data.Area.DailyStats[1].Min)
+	assert.Equal(t, 0, data.Area.DailyStats[1].Slots)
+}
+
+func TestExecutor_InvalidArguments(t *testing.T) {
+	e := newTestExecutor(t, new(testutil.MockPriceRepository), nil)
+
+	for query, message := range map[string]string{
+		`{ areas { prices(from: "10.3.2025", to: "2025-03-10") { price } } }`:                       "invalid from date format, use YYYY-MM-DD",
+		`{ areas { prices(from: "2025-03-10", to: "2025-03-09") { price } } }`:                      "to must not be before from",
+		`{ areas { prices(from: "2024-01-01", to: "2025-03-10") { price } } }`:                      "at most 366 days can be requested",
+		`{ areas { cheapestWindow(from: "2025-03-10", to: "2025-03-10", minutes: 10) { start } } }`: "minutes must be a positive multiple of 15",
+	} {
+		result := e.Execute(context.Background(), Request{Query: query})
+		require.Len(t, result.Errors, 1, query)
+		assert.Equal(t, message, result.Errors[0].Message)
+	}
+}
+
+func TestExecutor_Ingestion(t *testing.T) {
+	repo := new(testutil.MockPriceRepository)
+	entries := dayEntries()
+	tomorrow := day.AddDate(0, 0, 1)
+	repo.On("GetLatestPrice", mock.Anything).Return(&entries[95], nil)
+	// Only the first half of tomorrow is stored
+	var partial []model.PriceHistoryEntry
+	for _, e := range entries[:48] {
+		e.DeliveryStart, e.DeliveryEnd = e.DeliveryStart.AddDate(0, 0, 1), e.DeliveryEnd.AddDate(0, 0, 1)
+		partial = append(partial, e)
+	}
+	repo.On("GetPrices", mock.Anything, tomorrow, tomorrow.AddDate(0, 0, 1)).Return(partial, nil)
+	fetched := day.Add(12 * time.Hour)
+	repo.On("GetLatestInsertTime", mock.Anything).Return(&fetched, nil)
+	e := newTestExecutor(t, repo, nil)
+
+	result := e.Execute(context.Background(), Request{
+		Query: `{ ingestion { latestSlot { end } tomorrowSlots tomorrowAvailable lastNordPoolFetch } }`,
+	})
+
+	var data struct {
+		Ingestion struct {
+			LatestSlot        struct{ End time.Time }
+			TomorrowSlots     int
+			TomorrowAvailable bool
+			LastNordPoolFetch *time.Time
+		}
+	}
+	decode(t, result, &data)
+	assert.True(t, data.Ingestion.LatestSlot.End.Equal(tomorrow))
+	assert.Equal(t, 48, data.Ingestion.TomorrowSlots)
+	assert.False(t, data.Ingestion.TomorrowAvailable)
+	assert.True(t, data.Ingestion.LastNordPoolFetch.Equal(fetched))
+}
+
+func TestExecutor_Limits(t *testing.T) {
+	repo := new(testutil.MockPriceRepository)
+	e := newTestExecutor(t, repo, &config.Config{GraphQLMaxDepth: 8, GraphQLMaxComplexity: 100})
+
+	result := e.Execute(context.Background(), Request{
+		Query: `{ areas { prices(from: "2025-03-10", to: "2025-03-11") { price } } }`,
+	})
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "query complexity 194 exceeds the limit of 100", result.Errors[0].Message)
+	assert.Equal(t, CodeQueryTooComplex, result.Errors[0].Extensions["code"])
+
+	e = newTestExecutor(t, repo, &config.Config{GraphQLMaxDepth: 2, GraphQLMaxComplexity: 100})
+	result = e.Execute(context.Background(), Request{
+		Query: `{ ingestion { latestSlot { ...slot } } } fragment slot on PriceSlot { start }`,
+	})
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "query depth 3 exceeds the limit of 2", result.Errors[0].Message)
+
+	// Introspection is free, however deep
+	result = e.Execute(context.Background(), Request{
+		Query: `{ __schema { types { name fields { name type { name ofType { name } } } } } }`,
+	})
+	assert.Empty(t, result.Errors)
+	repo.AssertNotCalled(t, "GetPrices", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAnalyze(t *testing.T) {
+	query := `
+		query Prices($from: String!, $to: String!) {
+			areas { name ...stats prices(from: $from, to: $to) { price } }
+		}
+		query Status { ingestion { tomorrowSlots } }
+		fragment stats on Area { dailyStats(from: $from, to: $to) { min max } }`
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	require.NoError(t, err)
+
+	week := map[string]any{"from": "2025-03-10", "to": "2025-03-16"}
+	// areas: 1 + (name 1 + dailyStats (1 + 7*2) + prices (1 + 7*96*1))
+	assert.Equal(t, cost{depth: 3, complexity: 1 + 1 + 15 + 673}, analyze(doc, "Prices", week))
+	assert.Equal(t, cost{depth: 2, complexity: 2}, analyze(doc, "Status", week))
+	// Invalid ranges count as the longest allowed
+	assert.Equal(t, 1+1+(1+366*2)+(1+366*96), analyze(doc, "", nil).complexity)
+}
+
+func TestExecutor_PersistedQueries(t *testing.T) {
+	repo := new(testutil.MockPriceRepository)
+	repo.On("GetPrices", mock.Anything, day, day.AddDate(0, 0, 1)).Return(dayEntries(), nil)
+	e := newTestExecutor(t, repo, nil)
+
+	query := `{ areas { cheapestWindow(from: "2025-03-10", to: "2025-03-10", minutes: 30) { averagePrice } } }`
+	sum := sha256.Sum256([]byte(query))
+	hash := hex.EncodeToString(sum[:])
+	persisted := Extensions{PersistedQuery: &PersistedQuery{Version: 1, SHA256Hash: hash}}
+
+	result := e.Execute(context.Background(), Request{Extensions: persisted})
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "PersistedQueryNotFound", result.Errors[0].Message)
+	assert.Equal(t, CodePersistedQueryNotFound, result.Errors[0].Extensions["code"])
+
+	result = e.Execute(context.Background(), Request{Query: query + " ", Extensions: persisted})
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "provided sha does not match query", result.Errors[0].Message)
+
+	result = e.Execute(context.Background(), Request{Query: query, Extensions: persisted})
+	assert.Empty(t, result.Errors)
+
+	result = e.Execute(context.Background(), Request{Extensions: persisted})
+	var data struct {
+		Areas []struct {
+			CheapestWindow struct{ AveragePrice float64 }
+		}
+	}
+	decode(t, result, &data)
+	assert.InDelta(t, 0.5, data.Areas[0].CheapestWindow.AveragePrice, 1e-9)
+
+	// Queries that fail validation or exceed the limits are not stored
+	for _, invalid := range []string{`{ nope }`, `{ areas { a: prices(from: "2025-01-01", to: "2025-12-31") { price } b: prices(from: "2024-01-01", to: "2024-12-31") { price } } }`} {
+		sum := sha256.Sum256([]byte(invalid))
+		pq := Extensions{PersistedQuery: &PersistedQuery{Version: 1, SHA256Hash: hex.EncodeToString(sum[:])}}
+		result = e.Execute(context.Background(), Request{Query: invalid, Extensions: pq})
+		require.NotEmpty(t, result.Errors, invalid)
+		result = e.Execute(context.Background(), Request{Extensions: pq})
+		require.Len(t, result.Errors, 1)
+		assert.Equal(t, CodePersistedQueryNotFound, result.Errors[0].Extensions["code"], invalid)
+	}
+
+	disabled := newTestExecutor(t, repo, &config.Config{GraphQLMaxDepth: 8, GraphQLMaxComplexity: 50000})
+	result = disabled.Execute(context.Background(), Request{Query: query, Extensions: persisted})
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, CodePersistedQueryNotSupported, result.Errors[0].Extensions["code"])
+}
+
+func TestQueryStore_Evicts(t *testing.T) {
+	s := newQueryStore(2)
+	s.put("a", "1")
+	s.put("b", "2")
+	s.put("a", "3")
+	s.put("c", "4")
+
+	_, ok := s.get("a")
+	assert.False(t, ok, "Expected the oldest query to be evicted")
+	q, ok := s.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "4", q)
+}
@@ -0,0 +1,133 @@
+package gql
+
+import (
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/samlof/ehin/internal/service"
+)
+
+// cost is the static estimate of what running a query takes.
+type cost struct {
+	// Deepest nesting of fields
+	depth int
+	// Estimated number of values resolved
+	complexity int
+}
+
+// analyze estimates the cost of the operation named operationName in doc, or
+// of the costliest operation when no name is given. Each field costs one, and
+// the fields under a list cost as many times as the list is expected to have
+// items. Introspection fields are free so tools can always load the schema.
+func analyze(doc *ast.Document, operationName string, variables map[string]any) cost {
+	a := analyzer{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+	}
+	var operations []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operations = append(operations, def)
+			}
+		}
+	}
+
+	var c cost
+	for _, op := range operations {
+		opCost := a.selectionSet(op.SelectionSet, 0, nil)
+		c.depth = max(c.depth, opCost.depth)
+		c.complexity = max(c.complexity, opCost.complexity)
+	}
+	return c
+}
+
+type analyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+// selectionSet returns the cost of set at depth. visited holds the fragments
+// being expanded, so cyclic spreads, which validation rejects anyway, end.
+func (a *analyzer) selectionSet(set *ast.SelectionSet, depth int, visited map[string]bool) cost {
+	c := cost{depth: depth}
+	if set == nil {
+		return c
+	}
+	add := func(sub cost) {
+		c.depth = max(c.depth, sub.depth)
+		c.complexity += sub.complexity
+	}
+
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name.Value, "__") {
+				continue
+			}
+			children := a.selectionSet(sel.SelectionSet, depth+1, visited)
+			children.complexity = 1 + a.multiplier(sel)*children.complexity
+			add(children)
+		case *ast.InlineFragment:
+			add(a.selectionSet(sel.SelectionSet, depth, visited))
+		case *ast.FragmentSpread:
+			name := sel.Name.Value
+			frag, ok := a.fragments[name]
+			if !ok || visited[name] {
+				continue
+			}
+			next := map[string]bool{name: true}
+			for k := range visited {
+				next[k] = true
+			}
+			add(a.selectionSet(frag.SelectionSet, depth, next))
+		}
+	}
+	return c
+}
+
+// multiplier is the expected number of items a field returns.
+func (a *analyzer) multiplier(field *ast.Field) int {
+	switch field.Name.Value {
+	case "areas":
+		return len(service.StoredAreas)
+	case "prices":
+		return a.days(field) * slotsPerDay
+	case "dailyStats":
+		return a.days(field)
+	}
+	return 1
+}
+
+// days is the number of days between the from and to arguments of field, or
+// the most that can be requested when they are invalid.
+func (a *analyzer) days(field *ast.Field) int {
+	from, fromOK := a.date(field, "from")
+	to, toOK := a.date(field, "to")
+	if !fromOK || !toOK || to.Before(from) {
+		return maxRangeDays
+	}
+	return min(rangeDays(from, to), maxRangeDays)
+}
+
+func (a *analyzer) date(field *ast.Field, name string) (time.Time, bool) {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != name {
+			continue
+		}
+		var s string
+		switch v := arg.Value.(type) {
+		case *ast.StringValue:
+			s = v.Value
+		case *ast.Variable:
+			s, _ = a.variables[v.Name.Value].(string)
+		}
+		t, err := time.Parse(time.DateOnly, s)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,39 @@
+package gql
+
+import "sync"
+
+// queryStore keeps persisted queries by their hash, dropping the oldest when
+// full.
+type queryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	queries    map[string]string
+	order      []string
+}
+
+func newQueryStore(maxEntries int) *queryStore {
+	return &queryStore{
+		maxEntries: maxEntries,
+		queries:    make(map[string]string, maxEntries),
+	}
+}
+
+func (s *queryStore) get(hash string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query, ok := s.queries[hash]
+	return query, ok
+}
+
+func (s *queryStore) put(hash, query string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.queries[hash]; !ok {
+		if len(s.order) >= s.maxEntries {
+			delete(s.queries, s.order[0])
+			s.order = s.order[1:]
+		}
+		s.order = append(s.order, hash)
+	}
+	s.queries[hash] = query
+}
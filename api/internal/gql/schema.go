@@ -0,0 +1,422 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/service"
+)
+
+const (
+	priceCurrency = "EUR"
+	priceUnit     = "EUR/MWh"
+	// Longest range that a single field can request, as in /api/prices
+	maxRangeDays = 366
+	// Slots in a day at 15 minute resolution, used to estimate list sizes
+	slotsPerDay = 96
+)
+
+var helsinki = loadHelsinki()
+
+func loadHelsinki() *time.Location {
+	loc, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// resolver holds what the schema resolves fields from.
+type resolver struct {
+	priceRepository repository.PriceRepository
+	timeProvider    service.TimeProvider
+}
+
+// area is the value behind the Area type.
+type area struct {
+	name string
+}
+
+// dailyStats is the value behind the DailyStats type.
+type dailyStats struct {
+	date     time.Time
+	min, max float64
+	// Weighted by slot length
+	average  float64
+	slots    int
+	complete bool
+}
+
+// ingestion is the value behind the IngestionStatus type.
+type ingestion struct {
+	latest            *model.PriceHistoryEntry
+	tomorrowSlots     int
+	tomorrowAvailable bool
+	lastNordPoolFetch *time.Time
+}
+
+func newSchema(res *resolver) (graphql.Schema, error) {
+	dateArgs := func(extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+		args := graphql.FieldConfigArgument{
+			"from": &graphql.ArgumentConfig{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "First day, YYYY-MM-DD in Helsinki time",
+			},
+			"to": &graphql.ArgumentConfig{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "Last day, inclusive",
+			},
+		}
+		for k, v := range extra {
+			args[k] = v
+		}
+		return args
+	}
+
+	priceSlot := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "PriceSlot",
+		Description: "One delivery slot, VAT 0%",
+		Fields: graphql.Fields{
+			"start": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: slotField(func(e model.PriceHistoryEntry) any { return e.DeliveryStart })},
+			"end":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: slotField(func(e model.PriceHistoryEntry) any { return e.DeliveryEnd })},
+			"price": &graphql.Field{Type: graphql.NewNonNull(graphql.Float), Description: "In EUR/MWh", Resolve: slotField(func(e model.PriceHistoryEntry) any { return e.Price })},
+			"resolution": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "ISO 8601 duration of the slot, e.g. PT15M",
+				Resolve:     slotField(func(e model.PriceHistoryEntry) any { return service.ISODuration(e.DeliveryEnd.Sub(e.DeliveryStart)) }),
+			},
+		},
+	})
+
+	stats := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "DailyStats",
+		Description: "Aggregates of one day. Prices are null for days without slots.",
+		Fields: graphql.Fields{
+			"date":     &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: statsField(func(s dailyStats) any { return s.date.Format(time.DateOnly) })},
+			"min":      &graphql.Field{Type: graphql.Float, Resolve: statsPrice(func(s dailyStats) float64 { return s.min })},
+			"max":      &graphql.Field{Type: graphql.Float, Resolve: statsPrice(func(s dailyStats) float64 { return s.max })},
+			"average":  &graphql.Field{Type: graphql.Float, Description: "Weighted by slot length", Resolve: statsPrice(func(s dailyStats) float64 { return s.average })},
+			"slots":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: statsField(func(s dailyStats) any { return s.slots })},
+			"complete": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Description: "Whether the slots cover the whole day", Resolve: statsField(func(s dailyStats) any { return s.complete })},
+		},
+	})
+
+	window := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PriceWindow",
+		Fields: graphql.Fields{
+			"start":        &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: windowField(func(p service.PricePeriod) any { return p.Start })},
+			"end":          &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: windowField(func(p service.PricePeriod) any { return p.End })},
+			"averagePrice": &graphql.Field{Type: graphql.NewNonNull(graphql.Float), Description: "In EUR/MWh", Resolve: windowField(func(p service.PricePeriod) any { return p.AveragePrice })},
+		},
+	})
+
+	areaType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Area",
+		Description: "A Nord Pool delivery area",
+		Fields: graphql.Fields{
+			"name":     &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: areaField(func(a area) any { return a.name })},
+			"currency": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: areaField(func(a area) any { return priceCurrency })},
+			"unit":     &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: areaField(func(a area) any { return priceUnit })},
+			"timezone": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: areaField(func(a area) any { return helsinki.String() })},
+			"prices": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(priceSlot))),
+				Args:    dateArgs(nil),
+				Resolve: res.prices,
+			},
+			"dailyStats": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(stats))),
+				Args:    dateArgs(nil),
+				Resolve: res.dailyStats,
+			},
+			"cheapestWindow": &graphql.Field{
+				Type:        window,
+				Description: "The continuous window with the lowest average price, null if the prices don't cover one",
+				Args: dateArgs(graphql.FieldConfigArgument{
+					"minutes": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "Length of the window, a multiple of 15",
+					},
+				}),
+				Resolve: res.cheapestWindow,
+			},
+		},
+	})
+
+	ingestionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "IngestionStatus",
+		Fields: graphql.Fields{
+			"latestSlot": &graphql.Field{
+				Type:        priceSlot,
+				Description: "The last stored slot, null when no prices are stored",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if s := p.Source.(ingestion); s.latest != nil {
+						return *s.latest, nil
+					}
+					return nil, nil
+				},
+			},
+			"tomorrowSlots": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(ingestion).tomorrowSlots, nil
+				},
+			},
+			"tomorrowAvailable": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Whether tomorrow's prices cover the whole day. Should be true from around 14:00 Helsinki time onwards",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(ingestion).tomorrowAvailable, nil
+				},
+			},
+			"lastNordPoolFetch": &graphql.Field{
+				Type:        graphql.DateTime,
+				Description: "When the latest prices from Nord Pool were stored, null when no prices are stored",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if t := p.Source.(ingestion).lastNordPoolFetch; t != nil {
+						return *t, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"areas": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(areaType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					areas := make([]area, len(service.StoredAreas))
+					for i, name := range service.StoredAreas {
+						areas[i] = area{name: name}
+					}
+					return areas, nil
+				},
+			},
+			"area": &graphql.Field{
+				Type:        areaType,
+				Description: "The area by name, null if it has no prices",
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					name, ok := service.NormalizeArea(p.Args["name"].(string))
+					if !ok {
+						return nil, nil
+					}
+					return area{name: name}, nil
+				},
+			},
+			"ingestion": &graphql.Field{
+				Type:    graphql.NewNonNull(ingestionType),
+				Resolve: res.ingestion,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+func slotField(f func(model.PriceHistoryEntry) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return f(p.Source.(model.PriceHistoryEntry)), nil
+	}
+}
+
+func statsField(f func(dailyStats) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return f(p.Source.(dailyStats)), nil
+	}
+}
+
+// statsPrice resolves to null for days without slots.
+func statsPrice(f func(dailyStats) float64) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		s := p.Source.(dailyStats)
+		if s.slots == 0 {
+			return nil, nil
+		}
+		return f(s), nil
+	}
+}
+
+func windowField(f func(service.PricePeriod) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return f(p.Source.(service.PricePeriod)), nil
+	}
+}
+
+func areaField(f func(area) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return f(p.Source.(area)), nil
+	}
+}
+
+func (res *resolver) prices(p graphql.ResolveParams) (any, error) {
+	_, _, prices, err := res.pricesFor(p)
+	return prices, err
+}
+
+func (res *resolver) dailyStats(p graphql.ResolveParams) (any, error) {
+	from, to, prices, err := res.pricesFor(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []dailyStats
+	i := 0
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		s := dailyStats{date: day}
+		var covered time.Duration
+		var weighted float64
+		for ; i < len(prices) && prices[i].DeliveryStart.Before(next); i++ {
+			e := prices[i]
+			slot := e.DeliveryEnd.Sub(e.DeliveryStart)
+			if s.slots == 0 || e.Price < s.min {
+				s.min = e.Price
+			}
+			if s.slots == 0 || e.Price > s.max {
+				s.max = e.Price
+			}
+			s.slots++
+			covered += slot
+			weighted += e.Price * slot.Hours()
+		}
+		if covered > 0 {
+			s.average = weighted / covered.Hours()
+		}
+		s.complete = covered >= next.Sub(day)
+		days = append(days, s)
+	}
+	return days, nil
+}
+
+func (res *resolver) cheapestWindow(p graphql.ResolveParams) (any, error) {
+	minutes := p.Args["minutes"].(int)
+	if minutes <= 0 || minutes%15 != 0 {
+		return nil, errors.New("minutes must be a positive multiple of 15")
+	}
+	_, _, prices, err := res.pricesFor(p)
+	if err != nil {
+		return nil, err
+	}
+	period, ok := service.CheapestWindow(prices, time.Duration(minutes)*time.Minute)
+	if !ok {
+		return nil, nil
+	}
+	return period, nil
+}
+
+func (res *resolver) ingestion(p graphql.ResolveParams) (any, error) {
+	ctx := p.Context
+	var s ingestion
+	latest, err := res.priceRepository.GetLatestPrice(ctx)
+	if err != nil {
+		return nil, internalError(ctx, "Error getting latest price", err)
+	}
+	s.latest = latest
+
+	now := res.timeProvider.Now().In(helsinki)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, helsinki)
+	prices, err := loaderFrom(ctx).load(ctx, res.priceRepository, tomorrow, tomorrow.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, internalError(ctx, "Error getting tomorrow's prices", err)
+	}
+	s.tomorrowSlots = len(prices)
+	s.tomorrowAvailable = service.Covers(prices, tomorrow, tomorrow.AddDate(0, 0, 1))
+
+	s.lastNordPoolFetch, err = res.priceRepository.GetLatestInsertTime(ctx)
+	if err != nil {
+		return nil, internalError(ctx, "Error getting latest insert time", err)
+	}
+	return s, nil
+}
+
+// pricesFor returns the prices of the area field being resolved between its
+// from and to arguments.
+func (res *resolver) pricesFor(p graphql.ResolveParams) (time.Time, time.Time, []model.PriceHistoryEntry, error) {
+	fromStr, _ := p.Args["from"].(string)
+	toStr, _ := p.Args["to"].(string)
+	from, to, err := parseDateRange(fromStr, toStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, err
+	}
+	// Only the default area is stored, so every area shares the same prices
+	prices, err := loaderFrom(p.Context).load(p.Context, res.priceRepository, from, to)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, internalError(p.Context, "Error fetching prices from repository", err)
+	}
+	return from, to, prices, nil
+}
+
+// parseDateRange parses inclusive YYYY-MM-DD dates into the start of the first
+// and the end of the last day in Helsinki time.
+func parseDateRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	fromDate, err := time.Parse(time.DateOnly, fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid from date format, use YYYY-MM-DD")
+	}
+	toDate, err := time.Parse(time.DateOnly, toStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid to date format, use YYYY-MM-DD")
+	}
+	if toDate.Before(fromDate) {
+		return time.Time{}, time.Time{}, errors.New("to must not be before from")
+	}
+	if rangeDays(fromDate, toDate) > maxRangeDays {
+		return time.Time{}, time.Time{}, fmt.Errorf("at most %d days can be requested", maxRangeDays)
+	}
+
+	from := time.Date(fromDate.Year(), fromDate.Month(), fromDate.Day(), 0, 0, 0, 0, helsinki)
+	to := time.Date(toDate.Year(), toDate.Month(), toDate.Day(), 0, 0, 0, 0, helsinki).AddDate(0, 0, 1)
+	return from, to, nil
+}
+
+// rangeDays counts the days from from to to inclusive, both UTC dates.
+func rangeDays(from, to time.Time) int {
+	return int(to.Sub(from)/(24*time.Hour)) + 1
+}
+
+type loaderKey struct{}
+
+// loader remembers the prices fetched during one request, so that fields asking
+// for the same range, e.g. prices and dailyStats of several areas, share a
+// single query.
+type loader struct {
+	mu     sync.Mutex
+	ranges map[[2]time.Time][]model.PriceHistoryEntry
+}
+
+func withLoader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loaderKey{}, &loader{ranges: make(map[[2]time.Time][]model.PriceHistoryEntry)})
+}
+
+func loaderFrom(ctx context.Context) *loader {
+	if l, ok := ctx.Value(loaderKey{}).(*loader); ok {
+		return l
+	}
+	return &loader{ranges: make(map[[2]time.Time][]model.PriceHistoryEntry)}
+}
+
+func (l *loader) load(ctx context.Context, repo repository.PriceRepository, from, to time.Time) ([]model.PriceHistoryEntry, error) {
+	key := [2]time.Time{from, to}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if prices, ok := l.ranges[key]; ok {
+		return prices, nil
+	}
+	prices, err := repo.GetPrices(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	l.ranges[key] = prices
+	return prices, nil
+}
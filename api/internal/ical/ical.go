@@ -0,0 +1,131 @@
+// Package ical writes minimal RFC 5545 iCalendar documents.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/samlof/ehin/internal/service"
+)
+
+// Lines longer than this many octets are folded (RFC 5545 section 3.1).
+const maxLineOctets = 75
+
+const utcFormat = "20060102T150405Z"
+
+// Calendar is a VCALENDAR containing VEVENTs.
+type Calendar struct {
+	ProdID string
+	Name   string
+	// RefreshInterval hints subscribed clients how often to refetch the feed.
+	RefreshInterval time.Duration
+	Events          []Event
+}
+
+// Event is a single VEVENT. Clients use UID to update an existing event
+// instead of creating a duplicate, so it must be stable between fetches.
+type Event struct {
+	UID         string
+	Stamp       time.Time
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+}
+
+// WriteTo writes the calendar with CRLF line endings and folded long lines.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &writer{w: bufio.NewWriter(w)}
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.property("PRODID", c.ProdID)
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		cw.property("X-WR-CALNAME", escapeText(c.Name))
+		cw.property("NAME", escapeText(c.Name))
+	}
+	if c.RefreshInterval > 0 {
+		d := service.ISODuration(c.RefreshInterval)
+		cw.property("REFRESH-INTERVAL;VALUE=DURATION", d)
+		cw.property("X-PUBLISHED-TTL", d)
+	}
+
+	for _, e := range c.Events {
+		cw.line("BEGIN:VEVENT")
+		cw.property("UID", e.UID)
+		cw.property("DTSTAMP", e.Stamp.UTC().Format(utcFormat))
+		cw.property("DTSTART", e.Start.UTC().Format(utcFormat))
+		cw.property("DTEND", e.End.UTC().Format(utcFormat))
+		cw.property("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			cw.property("DESCRIPTION", escapeText(e.Description))
+		}
+		cw.line("TRANSP:TRANSPARENT")
+		cw.line("END:VEVENT")
+	}
+
+	cw.line("END:VCALENDAR")
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+type writer struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *writer) property(name, value string) {
+	cw.line(name + ":" + value)
+}
+
+// line writes a content line, folding it so that no physical line exceeds
+// 75 octets. Folds never split a multi-byte UTF-8 sequence.
+func (cw *writer) line(s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+		cw.write(s[:cut])
+		cw.write("\r\n ")
+		s = s[cut:]
+		// The leading space of a continuation line counts towards its length
+		limit = maxLineOctets - 1
+	}
+	cw.write(s)
+	cw.write("\r\n")
+}
+
+func (cw *writer) write(s string) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.WriteString(s)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// escapeText escapes a TEXT property value (RFC 5545 section 3.3.11).
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
@@ -0,0 +1,86 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar_WriteTo(t *testing.T) {
+	stamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cal := Calendar{
+		ProdID:          "-//ehin.fi//Prices//EN",
+		Name:            "Cheapest hours",
+		RefreshInterval: time.Hour,
+		Events: []Event{{
+			UID:         "cheapest-3h-20250102@ehin.fi",
+			Stamp:       stamp,
+			Start:       time.Date(2025, 1, 2, 1, 0, 0, 0, time.UTC),
+			End:         time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC),
+			Summary:     "Cheapest 3 h, 1.23 c/kWh",
+			Description: "Line one\nLine; two",
+		}},
+	}
+
+	var buf bytes.Buffer
+	n, err := cal.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+	}
+
+	expected := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//ehin.fi//Prices//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:Cheapest hours",
+		"NAME:Cheapest hours",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT1H",
+		"X-PUBLISHED-TTL:PT1H",
+		"BEGIN:VEVENT",
+		"UID:cheapest-3h-20250102@ehin.fi",
+		"DTSTAMP:20250101T120000Z",
+		"DTSTART:20250102T010000Z",
+		"DTEND:20250102T040000Z",
+		`SUMMARY:Cheapest 3 h\, 1.23 c/kWh`,
+		`DESCRIPTION:Line one\nLine\; two`,
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+	if buf.String() != expected {
+		t.Errorf("Unexpected calendar:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	var buf bytes.Buffer
+	cal := Calendar{
+		ProdID: "-//ehin.fi//Prices//EN",
+		Events: []Event{{Summary: strings.Repeat("ä", 100)}},
+	}
+	if _, err := cal.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var unfolded strings.Builder
+	for i, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("Line %d is %d octets long", i, len(line))
+		}
+		if strings.HasPrefix(line, " ") {
+			unfolded.WriteString(line[1:])
+		} else {
+			unfolded.WriteString("\n" + line)
+		}
+	}
+	if !strings.Contains(unfolded.String(), "SUMMARY:"+strings.Repeat("ä", 100)+"\n") {
+		t.Errorf("Folded summary doesn't unfold to the original value")
+	}
+}
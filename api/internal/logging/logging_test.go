@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("Expected default logger without a request logger")
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil)).With("requestId", "abc")
+	FromContext(WithLogger(context.Background(), logger)).Info("hello")
+
+	if !strings.Contains(buf.String(), "requestId=abc") {
+		t.Errorf("Expected log line with request ID, got %q", buf.String())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	if id := RequestID(context.Background()); id != "" {
+		t.Errorf("Expected no request ID, got %q", id)
+	}
+	if id := RequestID(WithRequestID(context.Background(), "abc")); id != "abc" {
+		t.Errorf("Expected request ID abc, got %q", id)
+	}
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/service"
+)
+
+// scrapeQueryTimeout bounds each database query made on a scrape.
+const scrapeQueryTimeout = 5 * time.Second
+
+var (
+	dbAcquiredConnsDesc = prometheus.NewDesc(namespace+"_db_pool_acquired_conns", "Connections currently in use.", nil, nil)
+	dbIdleConnsDesc     = prometheus.NewDesc(namespace+"_db_pool_idle_conns", "Idle connections in the pool.", nil, nil)
+	dbTotalConnsDesc    = prometheus.NewDesc(namespace+"_db_pool_total_conns", "Connections in the pool.", nil, nil)
+	dbMaxConnsDesc      = prometheus.NewDesc(namespace+"_db_pool_max_conns", "Maximum size of the pool.", nil, nil)
+	dbAcquiresDesc      = prometheus.NewDesc(namespace+"_db_pool_acquires_total", "Successful connection acquires.", nil, nil)
+	dbEmptyAcquiresDesc = prometheus.NewDesc(namespace+"_db_pool_empty_acquires_total", "Acquires that had to wait for a connection.", nil, nil)
+	dbCanceledDesc      = prometheus.NewDesc(namespace+"_db_pool_canceled_acquires_total", "Acquires canceled by their context.", nil, nil)
+	dbAcquireTimeDesc   = prometheus.NewDesc(namespace+"_db_pool_acquire_duration_seconds_total", "Total time spent acquiring connections.", nil, nil)
+
+	tomorrowSlotsDesc = prometheus.NewDesc(namespace+"_tomorrow_slots", "Stored price slots of tomorrow in Helsinki time, by area.", []string{"area"}, nil)
+	lastIngestionDesc = prometheus.NewDesc(namespace+"_last_ingestion_timestamp_seconds", "Unix time when the prices with the latest delivery were stored, by area.", []string{"area"}, nil)
+)
+
+// dbPoolCollector reads the pgxpool statistics on every scrape.
+type dbPoolCollector struct {
+	stat func() *pgxpool.Stat
+}
+
+func newDBPoolCollector(stat func() *pgxpool.Stat) *dbPoolCollector {
+	return &dbPoolCollector{stat: stat}
+}
+
+func (c *dbPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbAcquiredConnsDesc
+	ch <- dbIdleConnsDesc
+	ch <- dbTotalConnsDesc
+	ch <- dbMaxConnsDesc
+	ch <- dbAcquiresDesc
+	ch <- dbEmptyAcquiresDesc
+	ch <- dbCanceledDesc
+	ch <- dbAcquireTimeDesc
+}
+
+func (c *dbPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stat()
+	ch <- prometheus.MustNewConstMetric(dbAcquiredConnsDesc, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(dbIdleConnsDesc, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(dbTotalConnsDesc, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(dbMaxConnsDesc, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(dbAcquiresDesc, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbEmptyAcquiresDesc, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbCanceledDesc, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbAcquireTimeDesc, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
+
+// tomorrowSlotsCollector counts tomorrow's stored prices on every scrape. The
+// count is 0 until the day's prices have been ingested.
+type tomorrowSlotsCollector struct {
+	priceRepository repository.PriceRepository
+	timeProvider    service.TimeProvider
+}
+
+func newTomorrowSlotsCollector(priceRepository repository.PriceRepository, timeProvider service.TimeProvider) *tomorrowSlotsCollector {
+	return &tomorrowSlotsCollector{priceRepository: priceRepository, timeProvider: timeProvider}
+}
+
+func (c *tomorrowSlotsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tomorrowSlotsDesc
+}
+
+func (c *tomorrowSlotsCollector) Collect(ch chan<- prometheus.Metric) {
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		slog.Error("Failed to load Europe/Helsinki", "error", err)
+		return
+	}
+	now := c.timeProvider.Now().In(helsinki)
+	from := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, helsinki)
+	to := from.AddDate(0, 0, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeQueryTimeout)
+	defer cancel()
+	prices, err := c.priceRepository.GetPrices(ctx, from, to)
+	if err != nil {
+		// Leaving the metric out makes the gap visible instead of reporting 0 slots
+		slog.Error("Error counting tomorrow's prices for metrics", "error", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(tomorrowSlotsDesc, prometheus.GaugeValue, float64(len(prices)), service.DefaultArea)
+}
+
+// lastIngestionCollector reads when the latest prices were stored on every
+// scrape. It comes from the database, so every instance reports the same time
+// no matter which one ran the ingestion.
+type lastIngestionCollector struct {
+	priceRepository repository.PriceRepository
+}
+
+func newLastIngestionCollector(priceRepository repository.PriceRepository) *lastIngestionCollector {
+	return &lastIngestionCollector{priceRepository: priceRepository}
+}
+
+func (c *lastIngestionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastIngestionDesc
+}
+
+func (c *lastIngestionCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeQueryTimeout)
+	defer cancel()
+	inserted, err := c.priceRepository.GetLatestInsertTime(ctx)
+	if err != nil {
+		slog.Error("Error reading the last ingestion time for metrics", "error", err)
+		return
+	}
+	if inserted == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(lastIngestionDesc, prometheus.GaugeValue, float64(inserted.Unix()), service.DefaultArea)
+}
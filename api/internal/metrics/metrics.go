@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/service"
+)
+
+const namespace = "ehin"
+
+// UnmatchedRoute labels requests that didn't match any route, so random paths
+// don't create new time series.
+const UnmatchedRoute = "unmatched"
+
+// Metrics holds the application's Prometheus collectors.
+type Metrics struct {
+	registry     *prometheus.Registry
+	timeProvider service.TimeProvider
+
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+	nordPoolFetches  *prometheus.CounterVec
+	nordPoolDuration prometheus.Histogram
+}
+
+func New(timeProvider service.TimeProvider) *Metrics {
+	m := &Metrics{
+		registry:     prometheus.NewRegistry(),
+		timeProvider: timeProvider,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern and status code.",
+		}, []string{"route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route"}),
+		nordPoolFetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "nordpool_fetches_total",
+			Help:      "Nord Pool day-ahead price fetches by outcome.",
+		}, []string{"outcome"}),
+		nordPoolDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "nordpool_fetch_duration_seconds",
+			Help:      "Duration of Nord Pool day-ahead price fetches.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.nordPoolFetches,
+		m.nordPoolDuration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served HTTP request.
+func (m *Metrics) ObserveRequest(route string, status int, duration time.Duration) {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	m.httpRequests.WithLabelValues(route, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(route).Observe(duration.Seconds())
+}
+
+// RegisterDBPool adds the connection pool statistics of pool.
+func (m *Metrics) RegisterDBPool(pool *pgxpool.Pool) {
+	m.registry.MustRegister(newDBPoolCollector(pool.Stat))
+}
+
+// RegisterPrices adds the number of stored slots of tomorrow and the time of
+// the last ingestion. They are queried from priceRepository on every scrape.
+func (m *Metrics) RegisterPrices(priceRepository repository.PriceRepository) {
+	m.registry.MustRegister(
+		newTomorrowSlotsCollector(priceRepository, m.timeProvider),
+		newLastIngestionCollector(priceRepository),
+	)
+}
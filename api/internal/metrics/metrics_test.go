@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/nordpool"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type fakeNordPoolClient struct {
+	err error
+}
+
+func (c fakeNordPoolClient) GetDayAheadPrices(ctx context.Context, date time.Time, market, deliveryArea, currency string) (*nordpool.PriceDataResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &nordpool.PriceDataResponse{}, nil
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rr.Body)
+	return string(body)
+}
+
+func TestMetrics_Requests(t *testing.T) {
+	m := New(testutil.FixedTime{})
+	m.ObserveRequest("GET /api/prices", 200, 30*time.Millisecond)
+	m.ObserveRequest("", 404, time.Millisecond)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `ehin_http_requests_total{code="200",route="GET /api/prices"} 1`)
+	assert.Contains(t, body, `ehin_http_requests_total{code="404",route="unmatched"} 1`)
+	assert.Contains(t, body, `ehin_http_request_duration_seconds_bucket{route="GET /api/prices",le="0.05"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestMetrics_NordPool(t *testing.T) {
+	m := New(testutil.FixedTime{})
+	_, _ = m.InstrumentNordPool(fakeNordPoolClient{}).GetDayAheadPrices(context.Background(), time.Now(), "DayAhead", "FI", "EUR")
+	_, err := m.InstrumentNordPool(fakeNordPoolClient{err: errors.New("boom")}).GetDayAheadPrices(context.Background(), time.Now(), "DayAhead", "FI", "EUR")
+	assert.Error(t, err)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `ehin_nordpool_fetches_total{outcome="success"} 1`)
+	assert.Contains(t, body, `ehin_nordpool_fetches_total{outcome="error"} 1`)
+	assert.Contains(t, body, "ehin_nordpool_fetch_duration_seconds_count 2")
+}
+
+func TestMetrics_Ingestion(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	tomorrow := time.Date(2025, 1, 2, 0, 0, 0, 0, helsinki)
+
+	// Stored by another instance
+	inserted := now.Add(-2 * time.Hour)
+	repo := new(testutil.MockPriceRepository)
+	repo.On("GetPrices", mock.Anything, tomorrow, tomorrow.AddDate(0, 0, 1)).
+		Return(make([]model.PriceHistoryEntry, 96), nil)
+	repo.On("GetLatestInsertTime", mock.Anything).Return(&inserted, nil)
+
+	m := New(testutil.FixedTime{Time: now})
+	m.RegisterPrices(repo)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `ehin_last_ingestion_timestamp_seconds{area="FI"} 1.7357256e+09`)
+	assert.Contains(t, body, `ehin_tomorrow_slots{area="FI"} 96`)
+}
+
+func TestMetrics_IngestionError(t *testing.T) {
+	repo := new(testutil.MockPriceRepository)
+	repo.On("GetPrices", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("db down"))
+	repo.On("GetLatestInsertTime", mock.Anything).Return(nil, errors.New("db down"))
+
+	m := New(testutil.FixedTime{Time: time.Now()})
+	m.RegisterPrices(repo)
+
+	body := scrape(t, m)
+	assert.NotContains(t, body, "ehin_tomorrow_slots{")
+	assert.NotContains(t, body, "ehin_last_ingestion_timestamp_seconds{")
+}
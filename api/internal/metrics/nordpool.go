@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/samlof/ehin/internal/nordpool"
+)
+
+// Nord Pool fetch outcomes.
+const (
+	outcomeSuccess = "success"
+	outcomeError   = "error"
+)
+
+type instrumentedNordPoolClient struct {
+	next    nordpool.NordPoolClient
+	metrics *Metrics
+}
+
+// InstrumentNordPool returns a client that records the outcome and duration of
+// every fetch made with client.
+func (m *Metrics) InstrumentNordPool(client nordpool.NordPoolClient) nordpool.NordPoolClient {
+	return &instrumentedNordPoolClient{next: client, metrics: m}
+}
+
+func (c *instrumentedNordPoolClient) GetDayAheadPrices(ctx context.Context, date time.Time, market, deliveryArea, currency string) (*nordpool.PriceDataResponse, error) {
+	start := time.Now()
+	prices, err := c.next.GetDayAheadPrices(ctx, date, market, deliveryArea, currency)
+	c.metrics.nordPoolDuration.Observe(time.Since(start).Seconds())
+
+	outcome := outcomeSuccess
+	if err != nil {
+		outcome = outcomeError
+	}
+	c.metrics.nordPoolFetches.WithLabelValues(outcome).Inc()
+	return prices, err
+}
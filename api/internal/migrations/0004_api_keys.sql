@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS api_key(
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    requests_per_minute INT NOT NULL,
+    burst INT NOT NULL,
+    request_count BIGINT NOT NULL DEFAULT 0,
+    last_used timestamptz,
+    created timestamptz  NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_key;
+-- +goose StatementEnd
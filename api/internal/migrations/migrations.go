@@ -0,0 +1,29 @@
+// Package migrations holds the goose SQL migrations of the database schema.
+package migrations
+
+import (
+	"embed"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Version returns the version of the newest migration, i.e. the schema version
+// this build expects the database to be at.
+func Version() int64 {
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		return 0
+	}
+	var latest int64
+	for _, e := range entries {
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+		v, err := strconv.ParseInt(prefix, 10, 64)
+		if err == nil && v > latest {
+			latest = v
+		}
+	}
+	return latest
+}
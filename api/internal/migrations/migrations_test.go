@@ -0,0 +1,9 @@
+package migrations
+
+import "testing"
+
+func TestVersion(t *testing.T) {
+	if v := Version(); v != 4 {
+		t.Errorf("Expected version 4, got %d", v)
+	}
+}
@@ -0,0 +1,195 @@
+// Package mqtt publishes live prices to an MQTT broker for home automation setups.
+//
+// Topics, all relative to the configured prefix:
+//
+//	<prefix>/<area>/current   retained JSON of the slot being delivered, sent at every slot boundary
+//	<prefix>/<area>/negative  retained "true" or "false" for the current slot
+//	<prefix>/<area>/tomorrow  retained JSON array of tomorrow's prices, sent when they are ingested
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/service"
+)
+
+const (
+	// Used when there is no current slot in the database to tell when the next one starts.
+	fallbackSlotLength = 15 * time.Minute
+	// How long to wait before retrying after the database couldn't be read.
+	retryDelay = time.Minute
+)
+
+// Client is the subset of an MQTT client used for publishing.
+type Client interface {
+	Publish(topic string, qos byte, retained bool, payload []byte) error
+	Disconnect()
+}
+
+// CurrentPriceMessage is the payload of the current topic. Prices are in EUR/MWh.
+type CurrentPriceMessage struct {
+	Area     string    `json:"area"`
+	Price    float64   `json:"price"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Negative bool      `json:"negative"`
+}
+
+type Publisher struct {
+	client          Client
+	prefix          string
+	qos             byte
+	priceRepository repository.PriceRepository
+	timeProvider    service.TimeProvider
+
+	// Background publishes of tomorrow's prices, which Run waits for on shutdown
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewPublisher(
+	client Client,
+	prefix string,
+	qos byte,
+	priceRepository repository.PriceRepository,
+	timeProvider service.TimeProvider,
+) *Publisher {
+	return &Publisher{
+		client:          client,
+		prefix:          prefix,
+		qos:             qos,
+		priceRepository: priceRepository,
+		timeProvider:    timeProvider,
+	}
+}
+
+func (p *Publisher) topic(area, name string) string {
+	return p.prefix + "/" + area + "/" + name
+}
+
+// PricesIngested publishes newly ingested prices when they are tomorrow's.
+// Publishing happens in the background so a slow broker can't hold up ingestion.
+// Nothing is published once Run has returned.
+func (p *Publisher) PricesIngested(_ context.Context, area string, entries []model.PriceHistoryEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		slog.Warn("Not publishing tomorrow's prices to MQTT after shutdown", "area", area)
+		return
+	}
+	p.wg.Go(func() {
+		if err := p.PublishTomorrow(area, entries); err != nil {
+			slog.Error("Error publishing tomorrow's prices to MQTT", "error", err)
+		}
+	})
+}
+
+// PublishTomorrow publishes entries as tomorrow's prices. Entries for any other
+// day, e.g. from re-ingesting an old date, are ignored.
+func (p *Publisher) PublishTomorrow(area string, entries []model.PriceHistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		return fmt.Errorf("failed to load Europe/Helsinki: %w", err)
+	}
+	tomorrow := p.timeProvider.Now().In(helsinki).AddDate(0, 0, 1)
+	first := entries[0].DeliveryStart.In(helsinki)
+	if first.Year() != tomorrow.Year() || first.YearDay() != tomorrow.YearDay() {
+		slog.Info("Not publishing prices to MQTT, they are not tomorrow's", "date", first.Format("2006-01-02"))
+		return nil
+	}
+
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode prices: %w", err)
+	}
+	slog.Info("Publishing tomorrow's prices to MQTT", "area", area, "priceCount", len(entries))
+	return p.client.Publish(p.topic(area, "tomorrow"), p.qos, true, payload)
+}
+
+// PublishCurrent publishes the slot being delivered now and returns when the
+// next slot starts.
+func (p *Publisher) PublishCurrent(ctx context.Context, area string) (time.Time, error) {
+	now := p.timeProvider.Now()
+	prices, err := p.priceRepository.GetPrices(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return now.Add(retryDelay), err
+	}
+
+	i := service.SlotAt(prices, now)
+	if i < 0 {
+		slog.Warn("No current price to publish to MQTT", "area", area)
+		return now.Truncate(fallbackSlotLength).Add(fallbackSlotLength), nil
+	}
+	current := prices[i]
+
+	msg := CurrentPriceMessage{
+		Area:     area,
+		Price:    current.Price,
+		Start:    current.DeliveryStart,
+		End:      current.DeliveryEnd,
+		Negative: current.Price < 0,
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return current.DeliveryEnd, fmt.Errorf("failed to encode current price: %w", err)
+	}
+	if err := p.client.Publish(p.topic(area, "current"), p.qos, true, payload); err != nil {
+		return current.DeliveryEnd, err
+	}
+	if err := p.client.Publish(p.topic(area, "negative"), p.qos, true, []byte(strconv.FormatBool(msg.Negative))); err != nil {
+		return current.DeliveryEnd, err
+	}
+	return current.DeliveryEnd, nil
+}
+
+// Run publishes the current price of every stored area at each slot boundary until ctx is done.
+// It then waits for background publishes, so it must return before the client disconnects.
+func (p *Publisher) Run(ctx context.Context) {
+	defer p.stop()
+	for {
+		next := p.timeProvider.Now().Add(fallbackSlotLength)
+		for _, area := range service.StoredAreas {
+			areaNext, err := p.PublishCurrent(ctx, area)
+			if err != nil {
+				slog.Error("Error publishing current price to MQTT", "area", area, "error", err)
+			}
+			next = minTime(next, areaNext)
+		}
+
+		timer := time.NewTimer(max(time.Until(next), time.Second))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// stop stops PricesIngested from publishing and waits for publishes in progress.
+func (p *Publisher) stop() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
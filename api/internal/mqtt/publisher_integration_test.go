@@ -0,0 +1,74 @@
+//go:build integration
+
+package mqtt
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+)
+
+// Run against a local broker:
+//
+//	docker run --rm -p 1883:1883 eclipse-mosquitto:2 mosquitto -c /mosquitto-no-auth.conf
+//	go test -tags integration ./internal/mqtt
+func brokerURL() string {
+	if url := os.Getenv("MQTT_TEST_BROKER_URL"); url != "" {
+		return url
+	}
+	return "tcp://localhost:1883"
+}
+
+func TestIntegration_PublishTomorrowIsRetained(t *testing.T) {
+	client, err := Connect(brokerURL())
+	if err != nil {
+		t.Fatalf("failed to connect to broker: %v", err)
+	}
+	defer client.Disconnect()
+
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	now := time.Now().In(helsinki)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, helsinki)
+	entries := []model.PriceHistoryEntry{
+		{Price: 42.5, DeliveryStart: tomorrow, DeliveryEnd: tomorrow.Add(15 * time.Minute)},
+	}
+
+	prefix := "ehin-test/" + time.Now().Format("150405.000000")
+	p := NewPublisher(client, prefix, 1, nil, testutil.FixedTime{Time: now})
+	if err := p.PublishTomorrow("FI", entries); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	// A subscriber connecting afterwards receives the retained message
+	received := make(chan paho.Message, 1)
+	sub := paho.NewClient(paho.NewClientOptions().AddBroker(brokerURL()).SetClientID("ehin-test-sub"))
+	if token := sub.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("subscriber failed to connect: %v", token.Error())
+	}
+	defer sub.Disconnect(250)
+	sub.Subscribe(prefix+"/FI/tomorrow", 1, func(_ paho.Client, m paho.Message) { received <- m })
+
+	select {
+	case m := <-received:
+		if !m.Retained() {
+			t.Errorf("expected a retained message")
+		}
+		var decoded []model.PriceHistoryEntry
+		if err := json.Unmarshal(m.Payload(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded) != 1 || decoded[0].Price != 42.5 {
+			t.Errorf("unexpected payload %s", m.Payload())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not receive retained message")
+	}
+
+	// Clear the retained message
+	_ = client.Publish(prefix+"/FI/tomorrow", 1, true, nil)
+}
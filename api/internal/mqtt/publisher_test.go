@@ -0,0 +1,149 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type published struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  string
+}
+
+type fakeClient struct {
+	mu       sync.Mutex
+	messages []published
+	err      error
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.messages = append(c.messages, published{topic, qos, retained, string(payload)})
+	return nil
+}
+
+func (c *fakeClient) Disconnect() {}
+
+func TestPublisher_PublishCurrent(t *testing.T) {
+	now := time.Date(2025, 1, 1, 10, 20, 0, 0, time.UTC)
+	slotStart := time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)
+	entries := []model.PriceHistoryEntry{
+		{Price: -0.5, DeliveryStart: slotStart, DeliveryEnd: slotStart.Add(15 * time.Minute)},
+	}
+
+	repo := new(testutil.MockPriceRepository)
+	repo.On("GetPrices", mock.Anything, now.Add(-time.Hour), now.Add(time.Hour)).Return(entries, nil)
+	client := &fakeClient{}
+	p := NewPublisher(client, "ehin", 1, repo, testutil.FixedTime{Time: now})
+
+	next, err := p.PublishCurrent(context.Background(), "FI")
+	assert.NoError(t, err)
+	assert.Equal(t, slotStart.Add(15*time.Minute), next)
+
+	assert.Len(t, client.messages, 2)
+	assert.Equal(t, "ehin/FI/current", client.messages[0].topic)
+	assert.Equal(t, byte(1), client.messages[0].qos)
+	assert.True(t, client.messages[0].retained)
+
+	var msg CurrentPriceMessage
+	assert.NoError(t, json.Unmarshal([]byte(client.messages[0].payload), &msg))
+	assert.Equal(t, -0.5, msg.Price)
+	assert.True(t, msg.Negative)
+	assert.True(t, msg.Start.Equal(slotStart))
+
+	assert.Equal(t, published{"ehin/FI/negative", 1, true, "true"}, client.messages[1])
+}
+
+func TestPublisher_PublishCurrent_NoSlot(t *testing.T) {
+	now := time.Date(2025, 1, 1, 10, 20, 0, 0, time.UTC)
+	repo := new(testutil.MockPriceRepository)
+	repo.On("GetPrices", mock.Anything, mock.Anything, mock.Anything).Return([]model.PriceHistoryEntry{}, nil)
+	client := &fakeClient{}
+	p := NewPublisher(client, "ehin", 0, repo, testutil.FixedTime{Time: now})
+
+	next, err := p.PublishCurrent(context.Background(), "FI")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC), next)
+	assert.Empty(t, client.messages)
+}
+
+func TestPublisher_PublishCurrent_RepositoryError(t *testing.T) {
+	now := time.Date(2025, 1, 1, 10, 20, 0, 0, time.UTC)
+	repo := new(testutil.MockPriceRepository)
+	repo.On("GetPrices", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("db down"))
+	p := NewPublisher(&fakeClient{}, "ehin", 0, repo, testutil.FixedTime{Time: now})
+
+	next, err := p.PublishCurrent(context.Background(), "FI")
+	assert.Error(t, err)
+	assert.Equal(t, now.Add(retryDelay), next)
+}
+
+func TestPublisher_PublishTomorrow(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	now := time.Date(2025, 1, 1, 14, 0, 0, 0, helsinki)
+	tomorrow := time.Date(2025, 1, 2, 0, 0, 0, 0, helsinki)
+	entries := []model.PriceHistoryEntry{
+		{Price: 12.5, DeliveryStart: tomorrow, DeliveryEnd: tomorrow.Add(15 * time.Minute)},
+	}
+
+	client := &fakeClient{}
+	p := NewPublisher(client, "home/prices", 2, nil, testutil.FixedTime{Time: now})
+
+	assert.NoError(t, p.PublishTomorrow("FI", entries))
+	assert.Len(t, client.messages, 1)
+	assert.Equal(t, "home/prices/FI/tomorrow", client.messages[0].topic)
+	assert.Equal(t, byte(2), client.messages[0].qos)
+	assert.True(t, client.messages[0].retained)
+
+	var decoded []model.PriceHistoryEntry
+	assert.NoError(t, json.Unmarshal([]byte(client.messages[0].payload), &decoded))
+	assert.Len(t, decoded, 1)
+	assert.Equal(t, 12.5, decoded[0].Price)
+
+	// Re-ingesting an old day doesn't overwrite tomorrow's prices
+	old := tomorrow.AddDate(0, 0, -30)
+	assert.NoError(t, p.PublishTomorrow("FI", []model.PriceHistoryEntry{{DeliveryStart: old, DeliveryEnd: old.Add(time.Hour)}}))
+	assert.Len(t, client.messages, 1)
+}
+
+func TestPublisher_RunWaitsForPricesIngested(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	now := time.Date(2025, 1, 1, 14, 0, 0, 0, helsinki)
+	tomorrow := time.Date(2025, 1, 2, 0, 0, 0, 0, helsinki)
+	entries := []model.PriceHistoryEntry{
+		{Price: 12.5, DeliveryStart: tomorrow, DeliveryEnd: tomorrow.Add(15 * time.Minute)},
+	}
+
+	repo := new(testutil.MockPriceRepository)
+	repo.On("GetPrices", mock.Anything, mock.Anything, mock.Anything).Return([]model.PriceHistoryEntry{}, nil)
+	client := &fakeClient{}
+	p := NewPublisher(client, "home/prices", 1, repo, testutil.FixedTime{Time: now})
+
+	p.PricesIngested(context.Background(), "FI", entries)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Run(ctx)
+
+	// The publish in progress finished before Run returned
+	assert.Len(t, client.messages, 1)
+
+	// Prices ingested after shutdown are not published
+	p.PricesIngested(context.Background(), "FI", entries)
+	p.wg.Wait()
+	assert.Len(t, client.messages, 1)
+}
@@ -1,14 +1,26 @@
 package nordpool
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// The tracer is looked up per span so tests can swap the global provider.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/samlof/ehin/internal/nordpool")
+}
+
 type NordPoolClient interface {
-	GetDayAheadPrices(date time.Time, market, deliveryArea, currency string) (*PriceDataResponse, error)
+	GetDayAheadPrices(ctx context.Context, date time.Time, market, deliveryArea, currency string) (*PriceDataResponse, error)
 }
 
 type client struct {
@@ -21,6 +33,8 @@ func NewClient(baseURL string) NordPoolClient {
 		baseURL: baseURL,
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
+			// Adds a client span and the traceparent header to each request
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
 		},
 	}
 }
@@ -47,12 +61,31 @@ type PriceDataResponse struct {
 	AreaStates       []AreaState      `json:"areaStates"`
 }
 
-func (c *client) GetDayAheadPrices(date time.Time, market, deliveryArea, currency string) (*PriceDataResponse, error) {
+func (c *client) GetDayAheadPrices(ctx context.Context, date time.Time, market, deliveryArea, currency string) (*PriceDataResponse, error) {
 	dateStr := date.Format("2006-01-02")
+	ctx, span := tracer().Start(ctx, "nordpool.GetDayAheadPrices", trace.WithAttributes(
+		attribute.String("nordpool.date", dateStr),
+		attribute.String("nordpool.delivery_area", deliveryArea),
+	))
+	defer span.End()
+
+	prices, err := c.getDayAheadPrices(ctx, dateStr, market, deliveryArea, currency)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return prices, err
+}
+
+func (c *client) getDayAheadPrices(ctx context.Context, dateStr, market, deliveryArea, currency string) (*PriceDataResponse, error) {
 	url := fmt.Sprintf("%s/api/DayAheadPrices?date=%s&market=%s&deliveryArea=%s&currency=%s",
 		c.baseURL, dateStr, market, deliveryArea, currency)
 
-	resp, err := c.httpClient.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NordPool request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch prices from NordPool: %w", err)
 	}
@@ -1,12 +1,21 @@
 package nordpool
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestGetDayAheadPrices(t *testing.T) {
@@ -58,7 +67,7 @@ func TestGetDayAheadPrices(t *testing.T) {
 
 	client := NewClient(server.URL)
 	date, _ := time.Parse("2006-01-02", "2025-09-30")
-	prices, err := client.GetDayAheadPrices(date, "DayAhead", "FI", "EUR")
+	prices, err := client.GetDayAheadPrices(context.Background(), date, "DayAhead", "FI", "EUR")
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -86,7 +95,7 @@ func TestGetDayAheadPrices_ErrorResponse(t *testing.T) {
 
 	client := NewClient(server.URL)
 	date := time.Now()
-	_, err := client.GetDayAheadPrices(date, "DayAhead", "FI", "EUR")
+	_, err := client.GetDayAheadPrices(context.Background(), date, "DayAhead", "FI", "EUR")
 
 	if err == nil {
 		t.Error("expected error, got nil")
@@ -102,9 +111,50 @@ func TestGetDayAheadPrices_InvalidJSON(t *testing.T) {
 
 	client := NewClient(server.URL)
 	date := time.Now()
-	_, err := client.GetDayAheadPrices(date, "DayAhead", "FI", "EUR")
+	_, err := client.GetDayAheadPrices(context.Background(), date, "DayAhead", "FI", "EUR")
 
 	if err == nil {
 		t.Error("expected error, got nil")
 	}
 }
+
+func TestGetDayAheadPrices_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	date := time.Date(2025, 9, 30, 0, 0, 0, 0, time.UTC)
+	if _, err := client.GetDayAheadPrices(context.Background(), date, "DayAhead", "FI", "EUR"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	// Child spans end first
+	httpSpan, fetchSpan := spans[0], spans[1]
+	if fetchSpan.Name != "nordpool.GetDayAheadPrices" {
+		t.Errorf("expected fetch span, got %s", fetchSpan.Name)
+	}
+	if fetchSpan.Status.Code != codes.Error {
+		t.Errorf("expected fetch span to have error status, got %v", fetchSpan.Status.Code)
+	}
+	if httpSpan.Parent.SpanID() != fetchSpan.SpanContext.SpanID() {
+		t.Error("expected HTTP span to be a child of the fetch span")
+	}
+	if httpSpan.SpanKind != trace.SpanKindClient {
+		t.Errorf("expected client span, got %v", httpSpan.SpanKind)
+	}
+	if !strings.Contains(traceparent, httpSpan.SpanContext.TraceID().String()) {
+		t.Errorf("expected traceparent with trace %s, got %q", httpSpan.SpanContext.TraceID(), traceparent)
+	}
+}
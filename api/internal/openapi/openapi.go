@@ -0,0 +1,20 @@
+// Package openapi holds the OpenAPI 3.1 document of the API. Routes added to
+// cmd/api must be described in openapi.json, which is checked by a test there.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/samlof/ehin/internal/utils"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+// Handler serves the document at GET /openapi.json.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(utils.CACHE_CONTROL_HEADER, utils.CACHE_VAR+", max-age=3600")
+	_, _ = w.Write(Spec)
+}
@@ -0,0 +1,85 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSpec(t *testing.T) {
+	var doc map[string]any
+	if err := json.Unmarshal(Spec, &doc); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("Expected OpenAPI 3.1.0, got %v", doc["openapi"])
+	}
+
+	// Every local reference must point at something in the document
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok && !resolves(doc, ref) {
+				t.Errorf("Unresolved reference %s", ref)
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+
+	operationIDs := map[string]bool{}
+	for path, item := range doc["paths"].(map[string]any) {
+		for method, op := range item.(map[string]any) {
+			id, _ := op.(map[string]any)["operationId"].(string)
+			if id == "" {
+				t.Errorf("Missing operationId for %s %s", method, path)
+			}
+			if operationIDs[id] {
+				t.Errorf("Duplicate operationId %s", id)
+			}
+			operationIDs[id] = true
+		}
+	}
+}
+
+func resolves(doc map[string]any, ref string) bool {
+	name, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return false
+	}
+	var v any = doc
+	for _, part := range strings.Split(name, "/") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+		if v, ok = m[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Handler(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected application/json, got %s", ct)
+	}
+	if rr.Body.Len() != len(Spec) {
+		t.Errorf("Expected the embedded document, got %d bytes", rr.Body.Len())
+	}
+}
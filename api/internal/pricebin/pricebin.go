@@ -0,0 +1,164 @@
+// Package pricebin encodes prices in a compact fixed-width binary layout for
+// clients that can't afford to parse JSON, such as microcontroller displays.
+//
+// All integers are big-endian. The 18 byte header is followed by one int16
+// per slot:
+//
+//	offset  size  field
+//	0       4     magic "EHPB"
+//	4       1     version, currently 1
+//	5       1     reserved, 0
+//	6       2     uint16 slot length in minutes
+//	8       8     int64 start of the first slot in Unix seconds
+//	16      2     uint16 slot count
+//	18      2*n   int16 prices in 0.01 c/kWh (0.1 EUR/MWh), VAT 0%
+//
+// Slot i starts at start + i*slot length. Slots without a price hold Missing.
+// Prices outside the int16 range are clamped to ±32767.
+package pricebin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+const (
+	MediaType = "application/vnd.ehin.prices"
+	Version   = 1
+	// Marks a slot without a price
+	Missing int16 = math.MinInt16
+
+	magic      = "EHPB"
+	headerSize = 18
+	// Prices are stored in units of 0.1 EUR/MWh
+	unitsPerEURMWh = 10
+)
+
+// Prices is the decoded form of the layout.
+type Prices struct {
+	Start      time.Time
+	SlotLength time.Duration
+	// In units of 0.1 EUR/MWh, or Missing
+	Values []int16
+}
+
+// Entries returns the slots that have a price, with prices in EUR/MWh.
+func (p Prices) Entries() []model.PriceHistoryEntry {
+	entries := make([]model.PriceHistoryEntry, 0, len(p.Values))
+	for i, v := range p.Values {
+		if v == Missing {
+			continue
+		}
+		start := p.Start.Add(time.Duration(i) * p.SlotLength)
+		entries = append(entries, model.PriceHistoryEntry{
+			Price:         float64(v) / unitsPerEURMWh,
+			DeliveryStart: start,
+			DeliveryEnd:   start.Add(p.SlotLength),
+		})
+	}
+	return entries
+}
+
+// FromEntries lays entries out on a grid of their shortest slot length.
+// Longer slots, such as hourly prices before the switch to 15 minute
+// resolution, are repeated for each slot they cover. entries must be sorted by
+// start time.
+func FromEntries(entries []model.PriceHistoryEntry) (Prices, error) {
+	if len(entries) == 0 {
+		return Prices{}, nil
+	}
+
+	slotLength := entries[0].DeliveryEnd.Sub(entries[0].DeliveryStart)
+	for _, e := range entries {
+		slotLength = min(slotLength, e.DeliveryEnd.Sub(e.DeliveryStart))
+	}
+	if slotLength < time.Minute || slotLength%time.Minute != 0 || slotLength > math.MaxUint16*time.Minute {
+		return Prices{}, fmt.Errorf("unsupported slot length %s", slotLength)
+	}
+
+	start := entries[0].DeliveryStart
+	end := entries[len(entries)-1].DeliveryEnd
+	count := int(end.Sub(start) / slotLength)
+	if count > math.MaxUint16 {
+		return Prices{}, fmt.Errorf("too many slots: %d", count)
+	}
+
+	values := make([]int16, count)
+	for i := range values {
+		values[i] = Missing
+	}
+	for _, e := range entries {
+		v := toUnits(e.Price)
+		for t := e.DeliveryStart; t.Before(e.DeliveryEnd); t = t.Add(slotLength) {
+			i := int(t.Sub(start) / slotLength)
+			if i >= 0 && i < count {
+				values[i] = v
+			}
+		}
+	}
+
+	return Prices{Start: start, SlotLength: slotLength, Values: values}, nil
+}
+
+func toUnits(price float64) int16 {
+	v := math.Round(price * unitsPerEURMWh)
+	return int16(max(-math.MaxInt16, min(math.MaxInt16, v)))
+}
+
+// Size returns the encoded length of p in bytes.
+func (p Prices) Size() int {
+	return headerSize + 2*len(p.Values)
+}
+
+// Encode writes p in the binary layout.
+func Encode(w io.Writer, p Prices) error {
+	buf := make([]byte, p.Size())
+	copy(buf, magic)
+	buf[4] = Version
+	binary.BigEndian.PutUint16(buf[6:], uint16(p.SlotLength/time.Minute))
+	var start int64
+	if !p.Start.IsZero() {
+		start = p.Start.Unix()
+	}
+	binary.BigEndian.PutUint64(buf[8:], uint64(start))
+	binary.BigEndian.PutUint16(buf[16:], uint16(len(p.Values)))
+	for i, v := range p.Values {
+		binary.BigEndian.PutUint16(buf[headerSize+2*i:], uint16(v))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// Decode reads prices in the binary layout.
+func Decode(r io.Reader) (Prices, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Prices{}, fmt.Errorf("reading header: %w", err)
+	}
+	if string(header[:4]) != magic {
+		return Prices{}, errors.New("not an ehin price document")
+	}
+	if header[4] != Version {
+		return Prices{}, fmt.Errorf("unsupported version %d", header[4])
+	}
+
+	p := Prices{
+		SlotLength: time.Duration(binary.BigEndian.Uint16(header[6:])) * time.Minute,
+		Start:      time.Unix(int64(binary.BigEndian.Uint64(header[8:])), 0).UTC(),
+		Values:     make([]int16, binary.BigEndian.Uint16(header[16:])),
+	}
+	body := make([]byte, 2*len(p.Values))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Prices{}, fmt.Errorf("reading prices: %w", err)
+	}
+	for i := range p.Values {
+		p.Values[i] = int16(binary.BigEndian.Uint16(body[2*i:]))
+	}
+	return p, nil
+}
@@ -0,0 +1,162 @@
+package pricebin
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+func slots(start time.Time, length time.Duration, prices ...float64) []model.PriceHistoryEntry {
+	entries := make([]model.PriceHistoryEntry, len(prices))
+	for i, p := range prices {
+		s := start.Add(time.Duration(i) * length)
+		entries[i] = model.PriceHistoryEntry{Price: p, DeliveryStart: s, DeliveryEnd: s.Add(length)}
+	}
+	return entries
+}
+
+// roundTrip encodes entries and decodes them back.
+func roundTrip(t *testing.T, entries []model.PriceHistoryEntry) Prices {
+	t.Helper()
+	p, err := FromEntries(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, p); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != p.Size() {
+		t.Errorf("Expected %d bytes, got %d", p.Size(), buf.Len())
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// fromJSON returns entries as a client of the JSON API sees them.
+func fromJSON(t *testing.T, entries []model.PriceHistoryEntry) []model.PriceHistoryEntry {
+	t.Helper()
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []model.PriceHistoryEntry
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func assertSameEntries(t *testing.T, want, got []model.PriceHistoryEntry) {
+	t.Helper()
+	if len(want) != len(got) {
+		t.Fatalf("Expected %d entries, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !want[i].DeliveryStart.Equal(got[i].DeliveryStart) || !want[i].DeliveryEnd.Equal(got[i].DeliveryEnd) {
+			t.Errorf("Entry %d: expected %v-%v, got %v-%v", i, want[i].DeliveryStart, want[i].DeliveryEnd, got[i].DeliveryStart, got[i].DeliveryEnd)
+		}
+		// Prices are stored to 0.1 EUR/MWh
+		if math.Abs(want[i].Price-got[i].Price) > 0.05+1e-9 {
+			t.Errorf("Entry %d: expected price %v, got %v", i, want[i].Price, got[i].Price)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	// 2025-10-26 is the 25 hour DST day
+	start := time.Date(2025, 10, 26, 0, 0, 0, 0, helsinki)
+	prices := make([]float64, 100)
+	for i := range prices {
+		prices[i] = float64(i)*3.21 - 40.55
+	}
+	entries := slots(start, 15*time.Minute, prices...)
+
+	decoded := roundTrip(t, entries)
+	if decoded.SlotLength != 15*time.Minute || len(decoded.Values) != 100 || !decoded.Start.Equal(start) {
+		t.Errorf("Unexpected layout %v %v %d", decoded.Start, decoded.SlotLength, len(decoded.Values))
+	}
+	assertSameEntries(t, fromJSON(t, entries), decoded.Entries())
+}
+
+func TestRoundTrip_MixedResolution(t *testing.T) {
+	start := time.Date(2025, 9, 30, 22, 0, 0, 0, time.UTC)
+	entries := slots(start.Add(-2*time.Hour), time.Hour, 10, 20)
+	entries = append(entries, slots(start, 15*time.Minute, 1, 2, 3, 4)...)
+
+	decoded := roundTrip(t, entries)
+	if len(decoded.Values) != 12 {
+		t.Fatalf("Expected hourly slots to be split into 12 quarter hours, got %d", len(decoded.Values))
+	}
+	got := decoded.Entries()
+	if got[0].Price != 10 || got[3].Price != 10 || got[4].Price != 20 || got[8].Price != 1 {
+		t.Errorf("Unexpected prices %v", got)
+	}
+	if !got[11].DeliveryEnd.Equal(entries[len(entries)-1].DeliveryEnd) {
+		t.Errorf("Expected last slot to end at %v, got %v", entries[len(entries)-1].DeliveryEnd, got[11].DeliveryEnd)
+	}
+}
+
+func TestRoundTrip_Gaps(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := slots(start, 15*time.Minute, 1, 2)
+	entries = append(entries, slots(start.Add(time.Hour), 15*time.Minute, 5)...)
+
+	decoded := roundTrip(t, entries)
+	if len(decoded.Values) != 5 || decoded.Values[2] != Missing || decoded.Values[3] != Missing {
+		t.Errorf("Expected missing slots in the gap, got %v", decoded.Values)
+	}
+	assertSameEntries(t, fromJSON(t, entries), decoded.Entries())
+}
+
+func TestRoundTrip_Clamped(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	decoded := roundTrip(t, slots(start, time.Hour, 5000, -5000, -3276.7))
+
+	want := []int16{math.MaxInt16, -math.MaxInt16, -32767}
+	for i, v := range want {
+		if decoded.Values[i] != v {
+			t.Errorf("Slot %d: expected %d, got %d", i, v, decoded.Values[i])
+		}
+	}
+}
+
+func TestEncode_Layout(t *testing.T) {
+	start := time.Unix(1735689600, 0)
+	var buf bytes.Buffer
+	if err := Encode(&buf, Prices{Start: start, SlotLength: 15 * time.Minute, Values: []int16{105, -1}}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		'E', 'H', 'P', 'B', 1, 0,
+		0, 15,
+		0, 0, 0, 0, 0x67, 0x74, 0x85, 0x80,
+		0, 2,
+		0, 105,
+		0xff, 0xff,
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Expected % x, got % x", want, buf.Bytes())
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"Empty":     nil,
+		"Magic":     []byte("NOPE\x01\x00\x00\x0f\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+		"Version":   []byte("EHPB\x02\x00\x00\x0f\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+		"Truncated": []byte("EHPB\x01\x00\x00\x0f\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00"),
+	} {
+		if _, err := Decode(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
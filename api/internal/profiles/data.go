@@ -0,0 +1,79 @@
+package profiles
+
+// Relative consumption per hour of the day, from 00-01 local time. Hourly
+// values are spread evenly over the quarter hours.
+var (
+	apartmentWeekday = [24]float64{2.5, 2, 2, 2, 2, 2.5, 3.5, 4.5, 4, 3, 3, 3.5, 3.5, 3, 3, 3.5, 4.5, 6, 6.5, 6.5, 6, 5, 4, 3}
+	apartmentWeekend = [24]float64{3, 2.5, 2, 2, 2, 2, 2.5, 3, 4, 4.5, 5, 5, 5, 4.5, 4, 4, 4.5, 5.5, 6, 6, 5.5, 5, 4.5, 3.5}
+
+	houseWeekday = [24]float64{2.5, 2.5, 2.5, 2.5, 2.5, 3, 4, 5, 4.5, 3.5, 3.5, 3.5, 3.5, 3.5, 3.5, 4, 5, 6, 7, 7, 6.5, 5.5, 4, 3}
+	houseWeekend = [24]float64{3, 2.5, 2.5, 2.5, 2.5, 2.5, 3, 3.5, 4.5, 5, 5.5, 5.5, 5.5, 5, 4.5, 4.5, 5, 6, 7, 7, 6.5, 5.5, 4.5, 3.5}
+
+	// Heating runs around the clock, with most of it in the night when
+	// storage heaters are charged
+	heatingWeekday = [24]float64{4.5, 4.5, 4.5, 4.5, 4.5, 4.5, 4.5, 5, 4.5, 4, 3.5, 3.5, 3.5, 3.5, 3.5, 4, 4.5, 5, 5, 5, 5, 4.5, 5, 4.5}
+	heatingWeekend = [24]float64{4.5, 4.5, 4.5, 4.5, 4.5, 4.5, 4.5, 4.5, 4.5, 4.5, 4, 4, 4, 4, 4, 4, 4.5, 5, 5.5, 5.5, 5, 4.5, 5, 4.5}
+)
+
+// Relative consumption per month, from January
+var (
+	apartmentMonths = [12]float64{10, 9, 9, 8, 7.5, 7, 7, 7, 7.5, 8.5, 9, 10.5}
+	houseMonths     = [12]float64{10.5, 9.5, 9, 8, 7, 6.5, 6.5, 7, 7.5, 8.5, 9.5, 10.5}
+	heatingMonths   = [12]float64{15, 13, 11.5, 8, 5, 3.5, 3, 3.5, 5, 8.5, 11, 13}
+	// Batteries need more energy in the cold
+	evMonths = [12]float64{10.5, 9.5, 9, 8, 7.5, 7, 7, 7, 7.5, 8.5, 9, 10.5}
+)
+
+// evCharging is the relative charging power of an EV plugged in after work
+// and scheduled to start at 22:00, in quarter hours. Most cars are full by
+// 01:00 and the last ones by 04:00.
+func evCharging() shape {
+	var s shape
+	for q := 18 * 4; q < 22*4; q++ {
+		// Cars charging right away when plugged in
+		s[q] = 1
+	}
+	for q := 22 * 4; q < 24*4; q++ {
+		s[q] = 10
+	}
+	for q := range 4 * 4 {
+		s[q] = 10 * float64(4*4-q) / (4 * 4)
+	}
+	return s
+}
+
+var all = []*Profile{
+	{
+		Name:        "apartment",
+		Description: "Apartment without electric heating",
+		AnnualKWh:   2000,
+		months:      apartmentMonths,
+		weekday:     hourly(apartmentWeekday),
+		weekend:     hourly(apartmentWeekend),
+	},
+	{
+		Name:        "detached-house",
+		Description: "Detached house without electric heating",
+		AnnualKWh:   5000,
+		months:      houseMonths,
+		weekday:     hourly(houseWeekday),
+		weekend:     hourly(houseWeekend),
+	},
+	{
+		Name:        "detached-house-electric-heating",
+		Description: "Detached house with direct electric heating",
+		AnnualKWh:   18000,
+		months:      heatingMonths,
+		weekday:     hourly(heatingWeekday),
+		weekend:     hourly(heatingWeekend),
+	},
+	{
+		Name:        "ev-owner",
+		Description: "Detached house without electric heating, charging an electric car at night",
+		AnnualKWh:   8000,
+		months:      evMonths,
+		// 5000 kWh of household use and 3000 kWh of charging
+		weekday: mix(hourly(houseWeekday), 5, evCharging(), 3),
+		weekend: mix(hourly(houseWeekend), 5, evCharging(), 3),
+	},
+}
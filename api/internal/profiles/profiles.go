@@ -0,0 +1,191 @@
+// Package profiles has typical Finnish household load profiles for estimating
+// costs without meter data. A profile is the share of the yearly consumption
+// in each month and the shape of the consumption over a weekday and a weekend
+// day in 15 minute resolution, all in Helsinki time.
+//
+// Each day gets its month's share of the consumption divided evenly between
+// its days, spread over the quarter hours the day actually has. The days DST
+// starts and ends have 92 and 100 quarter hours, so the quarter hours 03:00-04:00
+// are left out of the first and counted twice on the second.
+package profiles
+
+import (
+	"errors"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+const quarter = 15 * time.Minute
+
+var ErrResolution = errors.New("resolution must be a multiple of 15 minutes")
+
+// shape is relative consumption in each quarter hour of a day.
+type shape [96]float64
+
+// Profile is the typical consumption of a kind of household.
+type Profile struct {
+	Name        string
+	Description string
+	// Typical yearly consumption, used when no other is given
+	AnnualKWh float64
+
+	months  [12]float64
+	weekday shape
+	weekend shape
+}
+
+// Slot is the consumption of one interval.
+type Slot struct {
+	Start time.Time
+	End   time.Time
+	KWh   float64
+}
+
+// All returns the profiles.
+func All() []*Profile {
+	return all
+}
+
+// Get returns the profile called name.
+func Get(name string) (*Profile, bool) {
+	for _, p := range all {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Series returns the consumption from from to to in slots of resolution,
+// scaled to annualKWh or the typical consumption of the profile when it's
+// zero. Slots start from from rounded down to 15 minutes, and the last one
+// ends at to.
+func (p *Profile) Series(annualKWh float64, from, to time.Time, resolution time.Duration) ([]Slot, error) {
+	if resolution <= 0 || resolution%quarter != 0 {
+		return nil, ErrResolution
+	}
+	g, err := p.generator(annualKWh)
+	if err != nil {
+		return nil, err
+	}
+	var slots []Slot
+	for start := from.Truncate(quarter); start.Before(to); start = start.Add(resolution) {
+		end := start.Add(resolution)
+		if end.After(to) {
+			end = to
+		}
+		slots = append(slots, Slot{Start: start, End: end, KWh: g.between(start, end)})
+	}
+	return slots, nil
+}
+
+// ForPrices returns the consumption in each price slot, scaled like Series.
+func (p *Profile) ForPrices(annualKWh float64, prices []model.PriceHistoryEntry) ([]float64, error) {
+	g, err := p.generator(annualKWh)
+	if err != nil {
+		return nil, err
+	}
+	kwh := make([]float64, len(prices))
+	for i, price := range prices {
+		kwh[i] = g.between(price.DeliveryStart, price.DeliveryEnd)
+	}
+	return kwh, nil
+}
+
+// generator calculates the consumption of quarter hours, caching the sum of
+// each day's shape.
+type generator struct {
+	profile   *Profile
+	annualKWh float64
+	loc       *time.Location
+	monthSum  float64
+	dayShapes map[time.Time]float64
+}
+
+func (p *Profile) generator(annualKWh float64) (*generator, error) {
+	loc, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		return nil, err
+	}
+	if annualKWh == 0 {
+		annualKWh = p.AnnualKWh
+	}
+	g := &generator{profile: p, annualKWh: annualKWh, loc: loc, dayShapes: map[time.Time]float64{}}
+	for _, v := range p.months {
+		g.monthSum += v
+	}
+	return g, nil
+}
+
+// between returns the consumption from start to end. Partial quarter hours
+// count in proportion to their length.
+func (g *generator) between(start, end time.Time) float64 {
+	var kwh float64
+	for q := start.Truncate(quarter); q.Before(end); q = q.Add(quarter) {
+		qEnd := q.Add(quarter)
+		if end.Before(qEnd) {
+			qEnd = end
+		}
+		overlap := qEnd.Sub(q)
+		if start.After(q) {
+			overlap = qEnd.Sub(start)
+		}
+		kwh += g.quarter(q) * float64(overlap) / float64(quarter)
+	}
+	return kwh
+}
+
+// quarter returns the consumption of the quarter hour starting at t.
+func (g *generator) quarter(t time.Time) float64 {
+	local := t.In(g.loc)
+	date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, g.loc)
+	s := g.profile.shapeOn(date)
+
+	sum, ok := g.dayShapes[date]
+	if !ok {
+		for q := date; q.Before(date.AddDate(0, 0, 1)); q = q.Add(quarter) {
+			sum += s[index(q.In(g.loc))]
+		}
+		g.dayShapes[date] = sum
+	}
+
+	days := date.AddDate(0, 1, -date.Day()).Day()
+	day := g.annualKWh * g.profile.months[date.Month()-1] / g.monthSum / float64(days)
+	return day * s[index(local)] / sum
+}
+
+func (p *Profile) shapeOn(date time.Time) *shape {
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return &p.weekend
+	}
+	return &p.weekday
+}
+
+// index returns the quarter hour of the day of a local time by the clock.
+func index(local time.Time) int {
+	return local.Hour()*4 + local.Minute()/15
+}
+
+// hourly spreads hourly values evenly over the quarter hours.
+func hourly(hours [24]float64) shape {
+	var s shape
+	for i := range s {
+		s[i] = hours[i/4] / 4
+	}
+	return s
+}
+
+// mix adds up shapes scaled to the weights, for combining loads.
+func mix(a shape, aWeight float64, b shape, bWeight float64) shape {
+	var aSum, bSum float64
+	for i := range a {
+		aSum += a[i]
+		bSum += b[i]
+	}
+	var s shape
+	for i := range s {
+		s[i] = a[i]/aSum*aWeight + b[i]/bSum*bWeight
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+package profiles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var helsinki, _ = time.LoadLocation("Europe/Helsinki")
+
+func sum(slots []Slot) float64 {
+	var kwh float64
+	for _, s := range slots {
+		kwh += s.KWh
+	}
+	return kwh
+}
+
+func TestSeries_Year(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, helsinki)
+	to := from.AddDate(1, 0, 0)
+	for _, p := range All() {
+		t.Run(p.Name, func(t *testing.T) {
+			quarters, err := p.Series(0, from, to, 15*time.Minute)
+			require.NoError(t, err)
+			assert.Len(t, quarters, 365*96)
+			assert.InDelta(t, p.AnnualKWh, sum(quarters), 1e-6)
+
+			hours, err := p.Series(3000, from, to, time.Hour)
+			require.NoError(t, err)
+			assert.Len(t, hours, 365*24)
+			assert.InDelta(t, 3000, sum(hours), 1e-6)
+			assert.InDelta(t, quarters[4].KWh+quarters[5].KWh+quarters[6].KWh+quarters[7].KWh, hours[1].KWh*p.AnnualKWh/3000, 1e-9)
+		})
+	}
+}
+
+func TestSeries_DST(t *testing.T) {
+	p, ok := Get("detached-house")
+	require.True(t, ok)
+
+	for _, tc := range []struct {
+		date     time.Time
+		quarters int
+	}{
+		{time.Date(2025, 3, 30, 0, 0, 0, 0, helsinki), 92},
+		{time.Date(2025, 10, 26, 0, 0, 0, 0, helsinki), 100},
+	} {
+		next := tc.date.AddDate(0, 0, 1)
+		slots, err := p.Series(0, tc.date, next, 15*time.Minute)
+		require.NoError(t, err)
+		require.Len(t, slots, tc.quarters)
+		// The day has its month's share whatever its length
+		month, err := p.Series(0, time.Date(2025, tc.date.Month(), 1, 0, 0, 0, 0, helsinki), time.Date(2025, tc.date.Month()+1, 1, 0, 0, 0, 0, helsinki), 15*time.Minute)
+		require.NoError(t, err)
+		assert.InDelta(t, sum(month)/31, sum(slots), 1e-9, tc.date)
+		for i := 1; i < len(slots); i++ {
+			assert.Equal(t, slots[i-1].End, slots[i].Start)
+		}
+	}
+
+	// 03:00-04:00 happens twice when DST ends, using the same shape both times
+	slots, err := p.Series(0, time.Date(2025, 10, 26, 0, 0, 0, 0, helsinki), time.Date(2025, 10, 27, 0, 0, 0, 0, helsinki), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, slots, 25)
+	assert.Equal(t, slots[3].Start.In(helsinki).Hour(), slots[4].Start.In(helsinki).Hour())
+	assert.InDelta(t, slots[3].KWh, slots[4].KWh, 1e-12)
+}
+
+func TestForPrices(t *testing.T) {
+	p, ok := Get("ev-owner")
+	require.True(t, ok)
+	start := time.Date(2025, 1, 15, 22, 0, 0, 0, helsinki)
+	var prices []model.PriceHistoryEntry
+	for i := range 4 {
+		s := start.Add(time.Duration(i) * 15 * time.Minute)
+		prices = append(prices, model.PriceHistoryEntry{DeliveryStart: s, DeliveryEnd: s.Add(15 * time.Minute)})
+	}
+	prices = append(prices, model.PriceHistoryEntry{DeliveryStart: start.Add(time.Hour), DeliveryEnd: start.Add(2 * time.Hour)})
+
+	kwh, err := p.ForPrices(0, prices)
+	require.NoError(t, err)
+	series, err := p.Series(0, start, start.Add(2*time.Hour), 15*time.Minute)
+	require.NoError(t, err)
+	require.Len(t, kwh, 5)
+	for i := range 4 {
+		assert.InDelta(t, series[i].KWh, kwh[i], 1e-12)
+	}
+	assert.InDelta(t, series[4].KWh+series[5].KWh+series[6].KWh+series[7].KWh, kwh[4], 1e-12)
+
+	// Charging at night uses more than the afternoon
+	afternoon, err := p.Series(0, start.Add(-8*time.Hour), start.Add(-7*time.Hour), time.Hour)
+	require.NoError(t, err)
+	assert.Greater(t, kwh[4], 2*afternoon[0].KWh)
+}
+
+func TestSeries_PartialSlots(t *testing.T) {
+	p, _ := Get("apartment")
+	from := time.Date(2025, 5, 5, 10, 0, 0, 0, helsinki)
+
+	slots, err := p.Series(0, from, from.Add(50*time.Minute), 30*time.Minute)
+	require.NoError(t, err)
+	require.Len(t, slots, 2)
+	assert.Equal(t, from.Add(50*time.Minute), slots[1].End)
+	quarters, err := p.Series(0, from, from.Add(time.Hour), 15*time.Minute)
+	require.NoError(t, err)
+	assert.InDelta(t, quarters[2].KWh+quarters[3].KWh*5/15, slots[1].KWh, 1e-12)
+
+	_, err = p.Series(0, from, from.Add(time.Hour), 20*time.Minute)
+	assert.ErrorIs(t, err, ErrResolution)
+}
+
+func TestGet(t *testing.T) {
+	p, ok := Get("detached-house-electric-heating")
+	require.True(t, ok)
+	assert.Equal(t, 18000.0, p.AnnualKWh)
+
+	_, ok = Get("castle")
+	assert.False(t, ok)
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/samlof/ehin/internal/datahub"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+)
+
+// Longest consumption period whose cost can be calculated at once.
+const maxConsumptionDays = 370
+
+var (
+	ErrNoConsumption     = errors.New("no consumption rows")
+	ErrConsumptionPeriod = fmt.Errorf("consumption period longer than %d days", maxConsumptionDays)
+)
+
+// ConsumptionCost is the spot price cost of metered consumption. Prices are
+// in c/kWh and costs in euros, without margins or transfer fees.
+type ConsumptionCost struct {
+	From           time.Time
+	To             time.Time
+	ConsumptionKWh float64
+	Cost           float64
+	// Cost divided by the priced consumption
+	AveragePaid float64
+	// Time weighted average of the spot prices over the period
+	AverageSpot float64
+	// Consumption in slots without a stored price, left out of Cost
+	UnpricedKWh float64
+	Days        []DayCost
+}
+
+// DayCost is the part of a ConsumptionCost on one day in Helsinki time.
+type DayCost struct {
+	Date           time.Time
+	ConsumptionKWh float64
+	Cost           float64
+	AveragePaid    float64
+	AverageSpot    float64
+	UnpricedKWh    float64
+}
+
+// ConsumptionService prices consumption with the stored spot prices.
+type ConsumptionService struct {
+	priceRepository repository.PriceRepository
+}
+
+func NewConsumptionService(priceRepository repository.PriceRepository) *ConsumptionService {
+	return &ConsumptionService{
+		priceRepository: priceRepository,
+	}
+}
+
+// Cost prices readings, which must be sorted by start time, with vatPercent
+// added to the spot prices.
+func (s *ConsumptionService) Cost(ctx context.Context, readings []datahub.Reading, vatPercent float64) (*ConsumptionCost, error) {
+	if len(readings) == 0 {
+		return nil, ErrNoConsumption
+	}
+	from, to := readingsPeriod(readings)
+	if to.Sub(from) > maxConsumptionDays*24*time.Hour {
+		return nil, ErrConsumptionPeriod
+	}
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		return nil, err
+	}
+
+	// From an hour earlier for an hourly slot that the first reading starts within
+	prices, err := s.priceRepository.GetPrices(ctx, from.Add(-time.Hour), to)
+	if err != nil {
+		return nil, fmt.Errorf("fetching prices: %w", err)
+	}
+	return consumptionCost(readings, prices, from, to, vatPercent, helsinki), nil
+}
+
+// consumptionCost splits each reading over the price slots it overlaps in
+// proportion to the overlap, so hourly readings work with 15 minute prices
+// and the other way round. Both readings and prices must be sorted.
+func consumptionCost(readings []datahub.Reading, prices []model.PriceHistoryEntry, from, to time.Time, vatPercent float64, loc *time.Location) *ConsumptionCost {
+	vat := 1 + vatPercent/100
+	// EUR/MWh to c/kWh
+	toCents := func(price float64) float64 { return price * vat / 10 }
+
+	total := &ConsumptionCost{From: from, To: to}
+	days := map[time.Time]*DayCost{}
+	var dayOrder []time.Time
+	dayOf := func(t time.Time) *DayCost {
+		local := t.In(loc)
+		date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		d, ok := days[date]
+		if !ok {
+			d = &DayCost{Date: date}
+			days[date] = d
+			dayOrder = append(dayOrder, date)
+		}
+		return d
+	}
+
+	// Priced kWh, for the paid averages
+	var pricedKWh float64
+	dayPricedKWh := map[time.Time]float64{}
+	for _, r := range readings {
+		day := dayOf(r.Start)
+		day.ConsumptionKWh += r.KWh
+		total.ConsumptionKWh += r.KWh
+	}
+	splitReadings(readings, prices, func(r datahub.Reading, kwh float64, price *model.PriceHistoryEntry) {
+		day := dayOf(r.Start)
+		if price == nil {
+			day.UnpricedKWh += kwh
+			total.UnpricedKWh += kwh
+			return
+		}
+		cost := kwh * toCents(price.Price) / 100
+		day.Cost += cost
+		total.Cost += cost
+		dayPricedKWh[day.Date] += kwh
+		pricedKWh += kwh
+	})
+
+	// Spot averages over the slots within the period
+	var hours float64
+	var weighted float64
+	dayHours := map[time.Time]float64{}
+	dayWeighted := map[time.Time]float64{}
+	for _, p := range prices {
+		overlap := earlier(p.DeliveryEnd, to).Sub(later(p.DeliveryStart, from)).Hours()
+		if overlap <= 0 {
+			continue
+		}
+		hours += overlap
+		weighted += toCents(p.Price) * overlap
+		date := dayOf(later(p.DeliveryStart, from)).Date
+		dayHours[date] += overlap
+		dayWeighted[date] += toCents(p.Price) * overlap
+	}
+
+	if pricedKWh != 0 {
+		total.AveragePaid = total.Cost * 100 / pricedKWh
+	}
+	if hours > 0 {
+		total.AverageSpot = weighted / hours
+	}
+	total.Days = make([]DayCost, 0, len(dayOrder))
+	slices.SortFunc(dayOrder, time.Time.Compare)
+	for _, date := range dayOrder {
+		d := days[date]
+		if kwh := dayPricedKWh[date]; kwh != 0 {
+			d.AveragePaid = d.Cost * 100 / kwh
+		}
+		if h := dayHours[date]; h > 0 {
+			d.AverageSpot = dayWeighted[date] / h
+		}
+		total.Days = append(total.Days, *d)
+	}
+	return total
+}
+
+// splitReadings calls fn with the part of each reading within each price slot
+// it overlaps, in proportion to the overlap, and with a nil price for the part
+// without a stored price. Both readings and prices must be sorted.
+func splitReadings(readings []datahub.Reading, prices []model.PriceHistoryEntry, fn func(r datahub.Reading, kwh float64, price *model.PriceHistoryEntry)) {
+	first := 0
+	for _, r := range readings {
+		length := r.End.Sub(r.Start)
+		var covered time.Duration
+		for first < len(prices) && !prices[first].DeliveryEnd.After(r.Start) {
+			first++
+		}
+		for i := first; i < len(prices) && prices[i].DeliveryStart.Before(r.End); i++ {
+			overlap := earlier(prices[i].DeliveryEnd, r.End).Sub(later(prices[i].DeliveryStart, r.Start))
+			if overlap <= 0 {
+				continue
+			}
+			covered += overlap
+			fn(r, r.KWh*float64(overlap)/float64(length), &prices[i])
+		}
+		if unpriced := r.KWh * float64(length-covered) / float64(length); unpriced > 0 {
+			fn(r, unpriced, nil)
+		}
+	}
+}
+
+// readingsPeriod returns the time from the first reading start to the last
+// reading end.
+func readingsPeriod(readings []datahub.Reading) (time.Time, time.Time) {
+	from, to := readings[0].Start, readings[0].End
+	for _, r := range readings {
+		to = later(to, r.End)
+	}
+	return from, to
+}
+
+func earlier(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/datahub"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumptionCost(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	start := time.Date(2025, 3, 10, 23, 0, 0, 0, helsinki)
+	// No price for the last hour
+	prices := hourlyEntries(start, 100, 200)
+
+	var readings []datahub.Reading
+	for i := range 4 {
+		s := start.Add(time.Duration(i) * 15 * time.Minute)
+		readings = append(readings, datahub.Reading{Start: s, End: s.Add(15 * time.Minute), KWh: 1})
+	}
+	readings = append(readings,
+		datahub.Reading{Start: start.Add(time.Hour), End: start.Add(2 * time.Hour), KWh: 2},
+		datahub.Reading{Start: start.Add(2 * time.Hour), End: start.Add(3 * time.Hour), KWh: 1},
+	)
+
+	cost := consumptionCost(readings, prices, start, start.Add(3*time.Hour), 0, helsinki)
+
+	assert.InDelta(t, 7, cost.ConsumptionKWh, 1e-9)
+	assert.InDelta(t, 0.8, cost.Cost, 1e-9)
+	assert.InDelta(t, 1, cost.UnpricedKWh, 1e-9)
+	assert.InDelta(t, 80.0/6, cost.AveragePaid, 1e-9)
+	assert.InDelta(t, 15, cost.AverageSpot, 1e-9)
+
+	require.Len(t, cost.Days, 2)
+	first, second := cost.Days[0], cost.Days[1]
+	assert.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, helsinki), first.Date)
+	assert.InDelta(t, 4, first.ConsumptionKWh, 1e-9)
+	assert.InDelta(t, 0.4, first.Cost, 1e-9)
+	assert.InDelta(t, 10, first.AveragePaid, 1e-9)
+	assert.InDelta(t, 10, first.AverageSpot, 1e-9)
+	assert.Equal(t, time.Date(2025, 3, 11, 0, 0, 0, 0, helsinki), second.Date)
+	assert.InDelta(t, 3, second.ConsumptionKWh, 1e-9)
+	assert.InDelta(t, 0.4, second.Cost, 1e-9)
+	assert.InDelta(t, 1, second.UnpricedKWh, 1e-9)
+	assert.InDelta(t, 20, second.AveragePaid, 1e-9)
+
+	withVAT := consumptionCost(readings, prices, start, start.Add(3*time.Hour), 25.5, helsinki)
+	assert.InDelta(t, 0.8*1.255, withVAT.Cost, 1e-9)
+	assert.InDelta(t, 15*1.255, withVAT.AverageSpot, 1e-9)
+}
+
+func TestConsumptionCost_HourlyReadingsQuarterHourPrices(t *testing.T) {
+	start := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	var prices []model.PriceHistoryEntry
+	for i, p := range []float64{10, 20, 30, 40} {
+		s := start.Add(time.Duration(i) * 15 * time.Minute)
+		prices = append(prices, model.PriceHistoryEntry{Price: p, DeliveryStart: s, DeliveryEnd: s.Add(15 * time.Minute)})
+	}
+	readings := []datahub.Reading{{Start: start, End: start.Add(time.Hour), KWh: 4}}
+
+	cost := consumptionCost(readings, prices, start, start.Add(time.Hour), 0, time.UTC)
+
+	// 1 kWh at each of 1, 2, 3 and 4 c/kWh
+	assert.InDelta(t, 0.1, cost.Cost, 1e-9)
+	assert.InDelta(t, 2.5, cost.AveragePaid, 1e-9)
+	assert.InDelta(t, 2.5, cost.AverageSpot, 1e-9)
+	assert.Zero(t, cost.UnpricedKWh)
+}
+
+func TestConsumptionService_Cost_Errors(t *testing.T) {
+	s := NewConsumptionService(nil)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := s.Cost(context.Background(), nil, 0)
+	assert.ErrorIs(t, err, ErrNoConsumption)
+
+	_, err = s.Cost(context.Background(), []datahub.Reading{
+		{Start: start, End: start.Add(time.Hour), KWh: 1},
+		{Start: start.AddDate(1, 1, 0), End: start.AddDate(1, 1, 0).Add(time.Hour), KWh: 1},
+	}, 0)
+	assert.ErrorIs(t, err, ErrConsumptionPeriod)
+}
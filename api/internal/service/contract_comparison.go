@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samlof/ehin/internal/datahub"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/profiles"
+)
+
+var ErrNoContracts = errors.New("no contracts to compare")
+
+type ContractType string
+
+const (
+	ContractFixed ContractType = "fixed"
+	ContractSpot  ContractType = "spot"
+)
+
+// Contract is an electricity contract as quoted to consumers, VAT included.
+type Contract struct {
+	Name string
+	Type ContractType
+	// c/kWh. The energy price of a fixed contract, or the margin added to the
+	// spot price of a spot contract.
+	Price float64
+	// Euros per month
+	MonthlyFee float64
+}
+
+// ContractComparison is what each contract would have cost for the same
+// consumption. Costs are in euros and prices in c/kWh.
+type ContractComparison struct {
+	From           time.Time
+	To             time.Time
+	Contracts      []Contract
+	ConsumptionKWh float64
+	// Consumption in slots without a stored price, left out of all contracts
+	// so that they are compared on the same consumption
+	UnpricedKWh float64
+	// Totals over the period in the order of Contracts
+	Totals []ContractCost
+	Months []MonthComparison
+}
+
+// MonthComparison is the part of a ContractComparison in one calendar month
+// in Helsinki time.
+type MonthComparison struct {
+	// Midnight on the first day of the month
+	Month          time.Time
+	ConsumptionKWh float64
+	UnpricedKWh    float64
+	Costs          []ContractCost
+}
+
+// ContractCost is the cost of consumption with one contract.
+type ContractCost struct {
+	Energy float64
+	// Monthly fees, prorated for months only partly within the period
+	Fees  float64
+	Total float64
+	// Total including fees per priced kWh
+	AveragePrice float64
+}
+
+// ComparisonService compares electricity contracts on stored spot prices.
+type ComparisonService struct {
+	priceRepository repository.PriceRepository
+}
+
+func NewComparisonService(priceRepository repository.PriceRepository) *ComparisonService {
+	return &ComparisonService{
+		priceRepository: priceRepository,
+	}
+}
+
+// Compare prices readings, which must be sorted by start time, with each of
+// contracts. vatPercent is added to the spot prices of spot contracts, whose
+// margins are VAT inclusive like fixed prices.
+func (s *ComparisonService) Compare(ctx context.Context, readings []datahub.Reading, contracts []Contract, vatPercent float64) (*ContractComparison, error) {
+	if len(contracts) == 0 {
+		return nil, ErrNoContracts
+	}
+	if len(readings) == 0 {
+		return nil, ErrNoConsumption
+	}
+	from, to := readingsPeriod(readings)
+	if to.Sub(from) > maxConsumptionDays*24*time.Hour {
+		return nil, ErrConsumptionPeriod
+	}
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		return nil, err
+	}
+
+	// From an hour earlier for an hourly slot that the first reading starts within
+	prices, err := s.priceRepository.GetPrices(ctx, from.Add(-time.Hour), to)
+	if err != nil {
+		return nil, fmt.Errorf("fetching prices: %w", err)
+	}
+	return compareContracts(readings, prices, contracts, from, to, vatPercent, helsinki), nil
+}
+
+// ProfileReadings returns the consumption of profile from from to to as 15
+// minute readings, scaled to annualKWh or its typical consumption when zero.
+func ProfileReadings(profile *profiles.Profile, annualKWh float64, from, to time.Time) ([]datahub.Reading, error) {
+	slots, err := profile.Series(annualKWh, from, to, 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	readings := make([]datahub.Reading, len(slots))
+	for i, s := range slots {
+		readings[i] = datahub.Reading{Start: s.Start, End: s.End, KWh: s.KWh}
+	}
+	return readings, nil
+}
+
+func compareContracts(readings []datahub.Reading, prices []model.PriceHistoryEntry, contracts []Contract, from, to time.Time, vatPercent float64, loc *time.Location) *ContractComparison {
+	vat := 1 + vatPercent/100
+
+	result := &ContractComparison{
+		From:      from,
+		To:        to,
+		Contracts: contracts,
+		Totals:    make([]ContractCost, len(contracts)),
+	}
+	monthStart := func(t time.Time) time.Time {
+		local := t.In(loc)
+		return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+	}
+	// Every month the period touches, even without readings, for the fees
+	index := map[time.Time]int{}
+	for m := monthStart(from); m.Before(to); m = m.AddDate(0, 1, 0) {
+		index[m] = len(result.Months)
+		result.Months = append(result.Months, MonthComparison{Month: m, Costs: make([]ContractCost, len(contracts))})
+	}
+	monthOf := func(t time.Time) *MonthComparison {
+		return &result.Months[index[monthStart(t)]]
+	}
+
+	for _, r := range readings {
+		monthOf(r.Start).ConsumptionKWh += r.KWh
+		result.ConsumptionKWh += r.KWh
+	}
+	pricedKWh := make([]float64, len(result.Months))
+	splitReadings(readings, prices, func(r datahub.Reading, kwh float64, price *model.PriceHistoryEntry) {
+		month := monthOf(r.Start)
+		if price == nil {
+			month.UnpricedKWh += kwh
+			result.UnpricedKWh += kwh
+			return
+		}
+		pricedKWh[index[month.Month]] += kwh
+		for i, c := range contracts {
+			cents := c.Price
+			if c.Type == ContractSpot {
+				// EUR/MWh to c/kWh
+				cents += price.Price * vat / 10
+			}
+			month.Costs[i].Energy += kwh * cents / 100
+		}
+	})
+
+	var totalKWh float64
+	for m := range result.Months {
+		month := &result.Months[m]
+		end := month.Month.AddDate(0, 1, 0)
+		covered := float64(earlier(end, to).Sub(later(month.Month, from))) / float64(end.Sub(month.Month))
+		for i, c := range contracts {
+			cost := &month.Costs[i]
+			cost.Fees = c.MonthlyFee * covered
+			cost.Total = cost.Energy + cost.Fees
+			if pricedKWh[m] != 0 {
+				cost.AveragePrice = cost.Total * 100 / pricedKWh[m]
+			}
+			result.Totals[i].Energy += cost.Energy
+			result.Totals[i].Fees += cost.Fees
+			result.Totals[i].Total += cost.Total
+		}
+		totalKWh += pricedKWh[m]
+	}
+	if totalKWh != 0 {
+		for i := range result.Totals {
+			result.Totals[i].AveragePrice = result.Totals[i].Total * 100 / totalKWh
+		}
+	}
+	return result
+}
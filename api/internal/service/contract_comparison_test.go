@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/datahub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareContracts(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	start := time.Date(2025, 1, 31, 23, 0, 0, 0, helsinki)
+	// No price for the last hour
+	prices := hourlyEntries(start, 100, 200)
+	var readings []datahub.Reading
+	for i := range 3 {
+		s := start.Add(time.Duration(i) * time.Hour)
+		readings = append(readings, datahub.Reading{Start: s, End: s.Add(time.Hour), KWh: 1})
+	}
+	contracts := []Contract{
+		{Name: "Fixed", Type: ContractFixed, Price: 15, MonthlyFee: 31},
+		{Name: "Spot", Type: ContractSpot, Price: 0.5},
+	}
+
+	c := compareContracts(readings, prices, contracts, start, start.Add(3*time.Hour), 0, helsinki)
+
+	assert.InDelta(t, 3, c.ConsumptionKWh, 1e-9)
+	assert.InDelta(t, 1, c.UnpricedKWh, 1e-9)
+	require.Len(t, c.Months, 2)
+
+	jan, feb := c.Months[0], c.Months[1]
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, helsinki), jan.Month)
+	assert.InDelta(t, 1, jan.ConsumptionKWh, 1e-9)
+	assert.InDelta(t, 0.15, jan.Costs[0].Energy, 1e-9)
+	// An hour of January
+	assert.InDelta(t, 31.0/(31*24), jan.Costs[0].Fees, 1e-9)
+	assert.InDelta(t, 0.105, jan.Costs[1].Energy, 1e-9)
+	assert.Zero(t, jan.Costs[1].Fees)
+	assert.InDelta(t, 10.5, jan.Costs[1].AveragePrice, 1e-9)
+
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, helsinki), feb.Month)
+	assert.InDelta(t, 2, feb.ConsumptionKWh, 1e-9)
+	assert.InDelta(t, 1, feb.UnpricedKWh, 1e-9)
+	assert.InDelta(t, 0.15, feb.Costs[0].Energy, 1e-9)
+	assert.InDelta(t, 31.0*2/(28*24), feb.Costs[0].Fees, 1e-9)
+	assert.InDelta(t, 0.205, feb.Costs[1].Energy, 1e-9)
+
+	fixed, spot := c.Totals[0], c.Totals[1]
+	assert.InDelta(t, 0.3, fixed.Energy, 1e-9)
+	assert.InDelta(t, jan.Costs[0].Fees+feb.Costs[0].Fees, fixed.Fees, 1e-9)
+	assert.InDelta(t, fixed.Energy+fixed.Fees, fixed.Total, 1e-9)
+	assert.InDelta(t, 0.31, spot.Total, 1e-9)
+	assert.InDelta(t, 15.5, spot.AveragePrice, 1e-9)
+
+	withVAT := compareContracts(readings, prices, contracts, start, start.Add(3*time.Hour), 25.5, helsinki)
+	assert.InDelta(t, 0.3, withVAT.Totals[0].Energy, 1e-9)
+	assert.InDelta(t, 0.3*1.255+0.01, withVAT.Totals[1].Energy, 1e-9)
+}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"context"
+
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+// PriceListener is notified after new prices have been stored in the database.
+type PriceListener interface {
+	// PricesIngested is called with the entries of a successful ingestion that stored
+	// new rows. ctx is only valid for the duration of the call, so implementations
+	// doing slow work must do it in the background.
+	PricesIngested(ctx context.Context, area string, entries []model.PriceHistoryEntry)
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+// PricePeriod is a continuous span of one or more price slots.
+type PricePeriod struct {
+	Start time.Time
+	End   time.Time
+	// AveragePrice is weighted by slot length, in EUR/MWh.
+	AveragePrice float64
+}
+
+// Covers reports whether the slots of entries add up to the whole time between
+// from and to, so it works with hourly and 15 minute prices and on DST days.
+// Entries must not overlap.
+func Covers(entries []model.PriceHistoryEntry, from, to time.Time) bool {
+	var covered time.Duration
+	for _, e := range entries {
+		start, end := later(e.DeliveryStart, from), earlier(e.DeliveryEnd, to)
+		if end.After(start) {
+			covered += end.Sub(start)
+		}
+	}
+	return covered >= to.Sub(from)
+}
+
+// CheapestWindow finds the continuous window of the given length with the lowest
+// average price. Entries must be sorted by DeliveryStart. Windows can't span gaps
+// in the data. It returns false if no such window exists.
+func CheapestWindow(entries []model.PriceHistoryEntry, length time.Duration) (PricePeriod, bool) {
+	var best PricePeriod
+	found := false
+	if length <= 0 {
+		return best, false
+	}
+
+	for i := range entries {
+		var covered time.Duration
+		var weighted float64
+		for j := i; j < len(entries) && covered < length; j++ {
+			if j > i && !entries[j].DeliveryStart.Equal(entries[j-1].DeliveryEnd) {
+				break
+			}
+			slot := entries[j].DeliveryEnd.Sub(entries[j].DeliveryStart)
+			covered += slot
+			weighted += entries[j].Price * slot.Hours()
+		}
+		if covered != length {
+			continue
+		}
+
+		avg := weighted / length.Hours()
+		if !found || avg < best.AveragePrice {
+			best = PricePeriod{
+				Start:        entries[i].DeliveryStart,
+				End:          entries[i].DeliveryStart.Add(length),
+				AveragePrice: avg,
+			}
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// PeriodsAbove merges consecutive slots priced above threshold into periods.
+// Entries must be sorted by DeliveryStart.
+func PeriodsAbove(entries []model.PriceHistoryEntry, threshold float64) []PricePeriod {
+	var periods []PricePeriod
+	var current *PricePeriod
+	var weighted float64
+
+	closeCurrent := func() {
+		if current == nil {
+			return
+		}
+		current.AveragePrice = weighted / current.End.Sub(current.Start).Hours()
+		periods = append(periods, *current)
+		current = nil
+	}
+
+	for _, entry := range entries {
+		if entry.Price <= threshold {
+			closeCurrent()
+			continue
+		}
+		if current != nil && !current.End.Equal(entry.DeliveryStart) {
+			closeCurrent()
+		}
+		if current == nil {
+			current = &PricePeriod{Start: entry.DeliveryStart}
+			weighted = 0
+		}
+		current.End = entry.DeliveryEnd
+		weighted += entry.Price * entry.DeliveryEnd.Sub(entry.DeliveryStart).Hours()
+	}
+	closeCurrent()
+
+	return periods
+}
+
+// SlotAt returns the index of the entry delivering at t, or -1 if there is none.
+func SlotAt(entries []model.PriceHistoryEntry, t time.Time) int {
+	for i, e := range entries {
+		if !t.Before(e.DeliveryStart) && t.Before(e.DeliveryEnd) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ISODuration formats slot lengths as ISO 8601 durations such as PT15M and PT1H.
+func ISODuration(d time.Duration) string {
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case h > 0 && m > 0:
+		return fmt.Sprintf("PT%dH%dM", h, m)
+	case h > 0:
+		return fmt.Sprintf("PT%dH", h)
+	default:
+		return fmt.Sprintf("PT%dM", m)
+	}
+}
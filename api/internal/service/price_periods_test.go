@@ -0,0 +1,108 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func hourlyEntries(start time.Time, prices ...float64) []model.PriceHistoryEntry {
+	entries := make([]model.PriceHistoryEntry, len(prices))
+	for i, p := range prices {
+		s := start.Add(time.Duration(i) * time.Hour)
+		entries[i] = model.PriceHistoryEntry{Price: p, DeliveryStart: s, DeliveryEnd: s.Add(time.Hour)}
+	}
+	return entries
+}
+
+func TestCovers(t *testing.T) {
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	// 23 hours long
+	day := time.Date(2025, 3, 30, 0, 0, 0, 0, helsinki)
+	next := day.AddDate(0, 0, 1)
+	entries := hourlyEntries(day, make([]float64, 23)...)
+
+	assert.True(t, Covers(entries, day, next))
+	assert.False(t, Covers(entries[:22], day, next))
+	assert.False(t, Covers(nil, day, next))
+	// Slots outside the range don't count
+	assert.False(t, Covers(append(entries[1:], hourlyEntries(next, 1)...), day, next))
+}
+
+func TestCheapestWindow(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := hourlyEntries(start, 50, 10, 20, 5, 40, 60)
+
+	period, ok := CheapestWindow(entries, 2*time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(2*time.Hour), period.Start)
+	assert.Equal(t, start.Add(4*time.Hour), period.End)
+	assert.InDelta(t, 12.5, period.AveragePrice, 0.0001)
+
+	period, ok = CheapestWindow(entries, 3*time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(time.Hour), period.Start)
+	assert.InDelta(t, 35.0/3, period.AveragePrice, 0.0001)
+
+	_, ok = CheapestWindow(entries, 7*time.Hour)
+	assert.False(t, ok)
+}
+
+func TestCheapestWindow_QuarterHours(t *testing.T) {
+	start := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	prices := []float64{40, 30, 1, 2, 3, 4, 50}
+	entries := make([]model.PriceHistoryEntry, len(prices))
+	for i, p := range prices {
+		s := start.Add(time.Duration(i) * 15 * time.Minute)
+		entries[i] = model.PriceHistoryEntry{Price: p, DeliveryStart: s, DeliveryEnd: s.Add(15 * time.Minute)}
+	}
+
+	period, ok := CheapestWindow(entries, time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(30*time.Minute), period.Start)
+	assert.InDelta(t, 2.5, period.AveragePrice, 0.0001)
+}
+
+func TestCheapestWindow_Gap(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := append(hourlyEntries(start, 1), hourlyEntries(start.Add(2*time.Hour), 1, 100)...)
+
+	period, ok := CheapestWindow(entries, 2*time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(2*time.Hour), period.Start)
+	assert.InDelta(t, 50.5, period.AveragePrice, 0.0001)
+}
+
+func TestPeriodsAbove(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := hourlyEntries(start, 150, 120, 50, 200, 10, 101)
+
+	periods := PeriodsAbove(entries, 100)
+	assert.Equal(t, []PricePeriod{
+		{Start: start, End: start.Add(2 * time.Hour), AveragePrice: 135},
+		{Start: start.Add(3 * time.Hour), End: start.Add(4 * time.Hour), AveragePrice: 200},
+		{Start: start.Add(5 * time.Hour), End: start.Add(6 * time.Hour), AveragePrice: 101},
+	}, periods)
+
+	assert.Empty(t, PeriodsAbove(entries, 500))
+}
+
+func TestSlotAt(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := hourlyEntries(start, 1, 2, 3)
+
+	assert.Equal(t, 0, SlotAt(entries, start))
+	assert.Equal(t, 1, SlotAt(entries, start.Add(90*time.Minute)))
+	assert.Equal(t, 2, SlotAt(entries, start.Add(3*time.Hour-time.Nanosecond)))
+	assert.Equal(t, -1, SlotAt(entries, start.Add(3*time.Hour)))
+	assert.Equal(t, -1, SlotAt(entries, start.Add(-time.Minute)))
+}
+
+func TestISODuration(t *testing.T) {
+	assert.Equal(t, "PT15M", ISODuration(15*time.Minute))
+	assert.Equal(t, "PT1H", ISODuration(time.Hour))
+	assert.Equal(t, "PT1H30M", ISODuration(90*time.Minute))
+	assert.Equal(t, "PT6H5M", ISODuration(6*time.Hour+5*time.Minute))
+}
@@ -1,14 +1,33 @@
 package service
 
 import (
+	"context"
 	"log/slog"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/samlof/ehin/internal/db/model"
 	"github.com/samlof/ehin/internal/nordpool"
 )
 
+// DefaultArea is the Nord Pool delivery area whose prices are fetched and stored.
+const DefaultArea = "FI"
+
+// StoredAreas lists the delivery areas that have prices in the database.
+var StoredAreas = []string{DefaultArea}
+
+// NormalizeArea returns the stored area matching name case-insensitively.
+// It returns false if prices aren't stored for the area.
+func NormalizeArea(name string) (string, bool) {
+	for _, area := range StoredAreas {
+		if strings.EqualFold(area, name) {
+			return area, true
+		}
+	}
+	return "", false
+}
+
 type PricesService struct {
 	nordPoolClient nordpool.NordPoolClient
 	timeProvider   TimeProvider
@@ -21,13 +40,13 @@ func NewPricesService(nordPoolClient nordpool.NordPoolClient, timeProvider TimeP
 	}
 }
 
-func (s *PricesService) GetTomorrowsPrices() (*nordpool.PriceDataResponse, error) {
+func (s *PricesService) GetTomorrowsPrices(ctx context.Context) (*nordpool.PriceDataResponse, error) {
 	tomorrow := s.timeProvider.Now().AddDate(0, 0, 1)
-	return s.GetPrices(tomorrow)
+	return s.GetPrices(ctx, tomorrow)
 }
 
-func (s *PricesService) GetPrices(date time.Time) (*nordpool.PriceDataResponse, error) {
-	prices, err := s.nordPoolClient.GetDayAheadPrices(date, "DayAhead", "FI", "EUR")
+func (s *PricesService) GetPrices(ctx context.Context, date time.Time) (*nordpool.PriceDataResponse, error) {
+	prices, err := s.nordPoolClient.GetDayAheadPrices(ctx, date, "DayAhead", DefaultArea, "EUR")
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +65,7 @@ func (s *PricesService) ToPriceHistoryEntries(prices *nordpool.PriceDataResponse
 
 	entries := make([]model.PriceHistoryEntry, 0, len(prices.MultiAreaEntries))
 	for _, entry := range prices.MultiAreaEntries {
-		if fiPrice, ok := entry.EntryPerArea["FI"]; ok {
+		if fiPrice, ok := entry.EntryPerArea[DefaultArea]; ok {
 			entries = append(entries, model.PriceHistoryEntry{
 				Price:         fiPrice,
 				DeliveryStart: entry.DeliveryStart,
@@ -77,7 +96,7 @@ func (s *PricesService) invalidPrices(prices *nordpool.PriceDataResponse) bool {
 
 	var fiState *nordpool.AreaState
 	for _, state := range prices.AreaStates {
-		if slices.Contains(state.Areas, "FI") {
+		if slices.Contains(state.Areas, DefaultArea) {
 			fiState = &state
 		}
 		if fiState != nil {
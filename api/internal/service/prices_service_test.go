@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -15,7 +16,7 @@ type MockNordPoolClient struct {
 	mock.Mock
 }
 
-func (m *MockNordPoolClient) GetDayAheadPrices(date time.Time, market, deliveryArea, currency string) (*nordpool.PriceDataResponse, error) {
+func (m *MockNordPoolClient) GetDayAheadPrices(ctx context.Context, date time.Time, market, deliveryArea, currency string) (*nordpool.PriceDataResponse, error) {
 	args := m.Called(date, market, deliveryArea, currency)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -151,7 +152,7 @@ func TestPricesService_GetPrices(t *testing.T) {
 
 			mockClient.On("GetDayAheadPrices", date, "DayAhead", "FI", "EUR").Return(tt.mockResponse, tt.mockError)
 
-			resp, err := service.GetPrices(date)
+			resp, err := service.GetPrices(context.Background(), date)
 
 			if tt.expectedError != nil {
 				assert.EqualError(t, err, tt.expectedError.Error())
@@ -183,7 +184,7 @@ func TestPricesService_GetTomorrowsPrices(t *testing.T) {
 
 	mockClient.On("GetDayAheadPrices", tomorrow, "DayAhead", "FI", "EUR").Return(expectedResp, nil)
 
-	resp, err := service.GetTomorrowsPrices()
+	resp, err := service.GetTomorrowsPrices(context.Background())
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedResp, resp)
@@ -191,3 +192,12 @@ func TestPricesService_GetTomorrowsPrices(t *testing.T) {
 	mockTime.AssertExpectations(t)
 	mockClient.AssertExpectations(t)
 }
+
+func TestNormalizeArea(t *testing.T) {
+	area, ok := NormalizeArea("fi")
+	assert.True(t, ok)
+	assert.Equal(t, "FI", area)
+
+	_, ok = NormalizeArea("SE3")
+	assert.False(t, ok)
+}
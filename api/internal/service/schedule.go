@@ -0,0 +1,323 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+// Limits of a schedule, which keep the optimizer's state space small.
+const (
+	ScheduleStep      = 15 * time.Minute
+	MaxScheduleWindow = 48 * time.Hour
+	MaxScheduleMinRun = 6 * time.Hour
+	MaxScheduleStarts = 8
+)
+
+var ErrScheduleInfeasible = errors.New("no schedule meets the constraints")
+
+// ScheduleConstraints describe a device, such as a water heater or a heat
+// pump, that has to take EnergyKWh between Earliest and Deadline.
+type ScheduleConstraints struct {
+	EnergyKWh  float64
+	MaxPowerKW float64
+	Earliest   time.Time
+	Deadline   time.Time
+	// Shortest time the device runs once started, 0 for no limit
+	MinRun time.Duration
+	// Most times the device may be started, 0 for no limit
+	MaxStarts int
+}
+
+// ScheduleSlot is the power of a device in one 15 minute slot.
+type ScheduleSlot struct {
+	Start time.Time
+	End   time.Time
+	// EUR/MWh
+	Price float64
+	// 0 when the device is off
+	PowerKW float64
+}
+
+func (s ScheduleSlot) EnergyKWh() float64 {
+	return s.PowerKW * s.End.Sub(s.Start).Hours()
+}
+
+// Schedule is the cheapest way to run a device under its constraints.
+type Schedule struct {
+	Slots     []ScheduleSlot
+	EnergyKWh float64
+	// In euros, without VAT
+	Cost   float64
+	Starts int
+}
+
+// Actions of the optimizer that lead to a state. Blocks start a run with
+// minRun slots at once.
+const (
+	actionOff uint8 = iota + 1
+	actionFull
+	actionPartial
+	actionBlockFull
+	actionBlockPartial
+)
+
+// OptimizeSchedule finds the cheapest schedule for a device in 15 minute slots
+// between c.Earliest and c.Deadline, rounded in to whole slots. Entries must be
+// sorted by DeliveryStart, and longer slots are split into 15 minute ones.
+//
+// The device runs at full power when on, except for one slot that takes the
+// rest of the energy. Each run lasts at least c.MinRun, and runs can't span
+// gaps in the data. When the energy takes less than one minimum run at full
+// power, it's spread evenly over the cheapest run instead. Dynamic programming
+// over the slots keeps track of the full power slots used, whether the partial
+// slot is used, the starts used and whether the device is running, so the
+// result is the optimum and not a greedy guess. Starting a run takes its first
+// c.MinRun slots at once, so the length of the current run doesn't have to be
+// part of the state.
+func OptimizeSchedule(entries []model.PriceHistoryEntry, c ScheduleConstraints) (*Schedule, error) {
+	if c.EnergyKWh <= 0 || c.MaxPowerKW <= 0 || !c.Deadline.After(c.Earliest) {
+		return nil, errors.New("energy, power and window must be positive")
+	}
+	if c.Deadline.Sub(c.Earliest) > MaxScheduleWindow || c.MinRun > MaxScheduleMinRun || c.MaxStarts < 0 || c.MaxStarts > MaxScheduleStarts {
+		return nil, errors.New("schedule constraints over the limits")
+	}
+
+	slots := scheduleSlots(entries, c.Earliest, c.Deadline)
+	n := len(slots)
+	if n == 0 {
+		return nil, fmt.Errorf("%w: no prices between the earliest start and the deadline", ErrScheduleInfeasible)
+	}
+	slotKWh := c.MaxPowerKW * ScheduleStep.Hours()
+	// Slots on, the last of which takes the remainder
+	on := int(math.Ceil(c.EnergyKWh/slotKWh - 1e-9))
+	remainder := c.EnergyKWh - float64(on-1)*slotKWh
+	if on > n {
+		return nil, fmt.Errorf("%w: %.2f kWh takes %d slots at full power but only %d have prices", ErrScheduleInfeasible, c.EnergyKWh, on, n)
+	}
+	minRun := max(1, int((c.MinRun+ScheduleStep-1)/ScheduleStep))
+
+	// Price sums for the cost of a block, and the continuous slots from each
+	// slot on for where a block fits
+	sums := make([]float64, n+1)
+	continuous := make([]int, n+1)
+	for i, slot := range slots {
+		sums[i+1] = sums[i] + slot.Price
+	}
+	for i := n - 1; i >= 0; i-- {
+		continuous[i] = 1
+		if i+1 < n && slots[i+1].Start.Equal(slots[i].End) {
+			continuous[i] += continuous[i+1]
+		}
+	}
+	if on < minRun {
+		return spreadSchedule(slots, sums, continuous, minRun, c.EnergyKWh)
+	}
+	dearest := func(from, to int) int {
+		best := from
+		for i := from + 1; i < to; i++ {
+			if slots[i].Price > slots[best].Price {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// State (full slots, partial used, starts, running)
+	starts := 1
+	if c.MaxStarts > 0 {
+		starts = c.MaxStarts + 1
+	}
+	states := on * 2 * starts * 2
+	encode := func(full, partial, start, running int) int {
+		return ((full*2+partial)*starts+start)*2 + running
+	}
+	decode := func(state int) (full, partial, start, running int) {
+		running = state % 2
+		state /= 2
+		start = state % starts
+		state /= starts
+		return state / 2, state % 2, start, running
+	}
+
+	// Costs of the states before slot i and the next minRun slots, which
+	// blocks reach, in a ring
+	rows := minRun + 1
+	costs := make([]float64, rows*states)
+	for i := range costs {
+		costs[i] = math.Inf(1)
+	}
+	row := func(i int) []float64 {
+		r := i % rows
+		return costs[r*states : (r+1)*states]
+	}
+	row(0)[encode(0, 0, 0, 0)] = 0
+	// The action that led to each state before each slot in the low bits,
+	// and whether the device was running before it
+	choices := make([]uint8, (n+1)*states)
+	relax := func(i, state int, value float64, action uint8, running int) {
+		if next := row(i); value < next[state] {
+			next[state] = value
+			choices[i*states+state] = action | uint8(running)<<3
+		}
+	}
+
+	for i := range n {
+		gap := i == 0 || !slots[i].Start.Equal(slots[i-1].End)
+		fullCost := slots[i].Price / 1000 * slotKWh
+		partialCost := slots[i].Price / 1000 * remainder
+		block := i+minRun <= n && continuous[i] >= minRun
+		var blockCost, blockPartialCost float64
+		if block {
+			blockCost = (sums[i+minRun] - sums[i]) / 1000 * slotKWh
+			blockPartialCost = blockCost - slots[dearest(i, i+minRun)].Price/1000*(slotKWh-remainder)
+		}
+
+		current := row(i)
+		for state, value := range current {
+			if math.IsInf(value, 1) {
+				continue
+			}
+			full, partial, start, running := decode(state)
+			relax(i+1, encode(full, partial, start, 0), value, actionOff, running)
+
+			if running == 1 && !gap {
+				if full < on-1 {
+					relax(i+1, encode(full+1, partial, start, 1), value+fullCost, actionFull, running)
+				}
+				if partial == 0 {
+					relax(i+1, encode(full, 1, start, 1), value+partialCost, actionPartial, running)
+				}
+				continue
+			}
+
+			nextStart := start
+			if c.MaxStarts > 0 {
+				if nextStart++; nextStart > c.MaxStarts {
+					continue
+				}
+			}
+			if !block {
+				continue
+			}
+			if full+minRun <= on-1 {
+				relax(i+minRun, encode(full+minRun, partial, nextStart, 1), value+blockCost, actionBlockFull, running)
+			}
+			if partial == 0 && full+minRun-1 <= on-1 {
+				relax(i+minRun, encode(full+minRun-1, 1, nextStart, 1), value+blockPartialCost, actionBlockPartial, running)
+			}
+		}
+		for j := range current {
+			current[j] = math.Inf(1)
+		}
+	}
+
+	best, bestCost := -1, math.Inf(1)
+	last := row(n)
+	for start := range starts {
+		for running := range 2 {
+			state := encode(on-1, 1, start, running)
+			if last[state] < bestCost {
+				best, bestCost = state, last[state]
+			}
+		}
+	}
+	if best < 0 {
+		return nil, fmt.Errorf("%w: runs of the minimum length don't fit in the allowed starts", ErrScheduleInfeasible)
+	}
+
+	schedule := &Schedule{Slots: slots}
+	partialPower := remainder / ScheduleStep.Hours()
+	state := best
+	for i := n; i > 0; {
+		choice := choices[i*states+state]
+		action, running := choice&7, int(choice>>3)
+		full, partial, start, _ := decode(state)
+		switch action {
+		case actionOff:
+			i--
+		case actionFull:
+			i--
+			schedule.Slots[i].PowerKW = c.MaxPowerKW
+			full--
+		case actionPartial:
+			i--
+			schedule.Slots[i].PowerKW = partialPower
+			partial--
+		case actionBlockFull, actionBlockPartial:
+			i -= minRun
+			for j := i; j < i+minRun; j++ {
+				schedule.Slots[j].PowerKW = c.MaxPowerKW
+			}
+			full -= minRun
+			if action == actionBlockPartial {
+				schedule.Slots[dearest(i, i+minRun)].PowerKW = partialPower
+				full++
+				partial--
+			}
+			if c.MaxStarts > 0 {
+				start--
+			}
+		}
+		state = encode(full, partial, start, running)
+	}
+
+	schedule.total()
+	return schedule, nil
+}
+
+// spreadSchedule runs the device in the cheapest continuous minRun slots at
+// the power that takes energy over them, for when the energy is less than one
+// minimum run at full power.
+func spreadSchedule(slots []ScheduleSlot, sums []float64, continuous []int, minRun int, energy float64) (*Schedule, error) {
+	best := -1
+	for i := 0; i+minRun <= len(slots); i++ {
+		if continuous[i] >= minRun && (best < 0 || sums[i+minRun]-sums[i] < sums[best+minRun]-sums[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, fmt.Errorf("%w: no continuous prices for the minimum run", ErrScheduleInfeasible)
+	}
+
+	schedule := &Schedule{Slots: slots}
+	power := energy / (float64(minRun) * ScheduleStep.Hours())
+	for i := best; i < best+minRun; i++ {
+		schedule.Slots[i].PowerKW = power
+	}
+	schedule.total()
+	return schedule, nil
+}
+
+// total sums the energy, cost and starts of the slots.
+func (s *Schedule) total() {
+	for i, slot := range s.Slots {
+		if slot.PowerKW == 0 {
+			continue
+		}
+		s.EnergyKWh += slot.EnergyKWh()
+		s.Cost += slot.Price / 1000 * slot.EnergyKWh()
+		if i == 0 || s.Slots[i-1].PowerKW == 0 || !slot.Start.Equal(s.Slots[i-1].End) {
+			s.Starts++
+		}
+	}
+}
+
+// scheduleSlots splits the entries between from and to into 15 minute slots.
+func scheduleSlots(entries []model.PriceHistoryEntry, from, to time.Time) []ScheduleSlot {
+	from = from.Add(ScheduleStep - 1).Truncate(ScheduleStep)
+	to = to.Truncate(ScheduleStep)
+	var slots []ScheduleSlot
+	for _, e := range entries {
+		for start := later(e.DeliveryStart.Truncate(ScheduleStep), from); start.Before(earlier(e.DeliveryEnd, to)); start = start.Add(ScheduleStep) {
+			if start.Before(e.DeliveryStart) || start.Add(ScheduleStep).After(e.DeliveryEnd) {
+				continue
+			}
+			slots = append(slots, ScheduleSlot{Start: start, End: start.Add(ScheduleStep), Price: e.Price})
+		}
+	}
+	return slots
+}
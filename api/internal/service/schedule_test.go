@@ -0,0 +1,269 @@
+package service
+
+import (
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func quarterEntries(start time.Time, prices ...float64) []model.PriceHistoryEntry {
+	entries := make([]model.PriceHistoryEntry, len(prices))
+	for i, p := range prices {
+		s := start.Add(time.Duration(i) * 15 * time.Minute)
+		entries[i] = model.PriceHistoryEntry{Price: p, DeliveryStart: s, DeliveryEnd: s.Add(15 * time.Minute)}
+	}
+	return entries
+}
+
+// powers returns the power of each slot of a schedule.
+func powers(s *Schedule) []float64 {
+	p := make([]float64, len(s.Slots))
+	for i, slot := range s.Slots {
+		p[i] = slot.PowerKW
+	}
+	return p
+}
+
+func TestOptimizeSchedule(t *testing.T) {
+	start := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+	entries := quarterEntries(start, 50, 10, 40, 20, 30, 15, 60, 35)
+	c := ScheduleConstraints{EnergyKWh: 1.5, MaxPowerKW: 2, Earliest: start, Deadline: start.Add(2 * time.Hour)}
+
+	t.Run("Cheapest slots", func(t *testing.T) {
+		s, err := OptimizeSchedule(entries, c)
+		require.NoError(t, err)
+		assert.Equal(t, []float64{0, 2, 0, 2, 0, 2, 0, 0}, powers(s))
+		assert.InDelta(t, 1.5, s.EnergyKWh, 1e-9)
+		// 0.5 kWh at 10, 20 and 15 EUR/MWh
+		assert.InDelta(t, 0.0225, s.Cost, 1e-9)
+		assert.Equal(t, 3, s.Starts)
+	})
+
+	t.Run("Partial slot", func(t *testing.T) {
+		c := c
+		c.EnergyKWh = 1.2
+		s, err := OptimizeSchedule(entries, c)
+		require.NoError(t, err)
+		// The 0.2 kWh left over goes to the dearest slot used
+		assert.InDeltaSlice(t, []float64{0, 2, 0, 0.8, 0, 2, 0, 0}, powers(s), 1e-9)
+		assert.InDelta(t, 1.2, s.EnergyKWh, 1e-9)
+	})
+
+	t.Run("Minimum run and one start", func(t *testing.T) {
+		c := c
+		c.MinRun = 45 * time.Minute
+		c.MaxStarts = 1
+		s, err := OptimizeSchedule(entries, c)
+		require.NoError(t, err)
+		// 20+30+15 is the cheapest three in a row
+		assert.Equal(t, []float64{0, 0, 0, 2, 2, 2, 0, 0}, powers(s))
+		assert.Equal(t, 1, s.Starts)
+	})
+
+	t.Run("Less than one run", func(t *testing.T) {
+		c := c
+		c.EnergyKWh = 0.3
+		c.MinRun = 45 * time.Minute
+		s, err := OptimizeSchedule(entries, c)
+		require.NoError(t, err)
+		// 0.3 kWh over 20+30+15, the cheapest three in a row, at 0.4 kW
+		assert.InDeltaSlice(t, []float64{0, 0, 0, 0.4, 0.4, 0.4, 0, 0}, powers(s), 1e-9)
+		assert.InDelta(t, 0.3, s.EnergyKWh, 1e-9)
+		assert.InDelta(t, 0.0065, s.Cost, 1e-9)
+		assert.Equal(t, 1, s.Starts)
+	})
+
+	t.Run("Two starts", func(t *testing.T) {
+		c := c
+		c.EnergyKWh = 2
+		c.MinRun = 30 * time.Minute
+		c.MaxStarts = 2
+		s, err := OptimizeSchedule(entries, c)
+		require.NoError(t, err)
+		// Greedy would take 10, 15, 20 and 30, leaving 10 in a run of one
+		assert.Equal(t, []float64{0, 2, 2, 0, 2, 2, 0, 0}, powers(s))
+		assert.Equal(t, 2, s.Starts)
+		assert.InDelta(t, 2, s.EnergyKWh, 1e-9)
+	})
+
+	t.Run("Window", func(t *testing.T) {
+		c := c
+		// Rounded in to 00:30-01:30
+		c.Earliest = start.Add(20 * time.Minute)
+		c.Deadline = start.Add(100 * time.Minute)
+		s, err := OptimizeSchedule(entries, c)
+		require.NoError(t, err)
+		require.Len(t, s.Slots, 4)
+		assert.Equal(t, start.Add(30*time.Minute), s.Slots[0].Start)
+		assert.Equal(t, []float64{0, 2, 2, 2}, powers(s))
+	})
+}
+
+func TestOptimizeSchedule_HourlyPricesAndGaps(t *testing.T) {
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	// Hourly prices with the third hour missing
+	entries := append(hourlyEntries(start, 10, 40), hourlyEntries(start.Add(3*time.Hour), 20)...)
+	c := ScheduleConstraints{EnergyKWh: 3, MaxPowerKW: 2, Earliest: start, Deadline: start.Add(4 * time.Hour), MinRun: 90 * time.Minute, MaxStarts: 2}
+
+	s, err := OptimizeSchedule(entries, c)
+	require.NoError(t, err)
+	require.Len(t, s.Slots, 12)
+	for i, slot := range s.Slots {
+		assert.Equal(t, 15*time.Minute, slot.End.Sub(slot.Start))
+		if i > 0 && i != 8 {
+			assert.Equal(t, s.Slots[i-1].End, slot.Start)
+		}
+	}
+	// Six slots in one run, which can't continue over the gap into the cheaper last hour
+	assert.Equal(t, []float64{2, 2, 2, 2, 2, 2, 0, 0, 0, 0, 0, 0}, powers(s))
+	assert.InDelta(t, 0.06, s.Cost, 1e-9)
+}
+
+func TestOptimizeSchedule_Limits(t *testing.T) {
+	start := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+	rng := rand.New(rand.NewPCG(3, 4))
+	prices := make([]float64, MaxScheduleWindow/ScheduleStep)
+	for i := range prices {
+		prices[i] = float64(rng.IntN(300) - 20)
+	}
+	// On in every slot, which makes the state space the largest
+	c := ScheduleConstraints{
+		EnergyKWh:  float64(len(prices)) * 2 / 4,
+		MaxPowerKW: 2,
+		Earliest:   start,
+		Deadline:   start.Add(MaxScheduleWindow),
+		MinRun:     MaxScheduleMinRun,
+		MaxStarts:  MaxScheduleStarts,
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	began := time.Now()
+	s, err := OptimizeSchedule(quarterEntries(start, prices...), c)
+	elapsed := time.Since(began)
+	runtime.ReadMemStats(&after)
+
+	require.NoError(t, err)
+	assert.LessOrEqual(t, s.Starts, MaxScheduleStarts)
+	assert.InDelta(t, c.EnergyKWh, s.EnergyKWh, 1e-9)
+	allocated := after.TotalAlloc - before.TotalAlloc
+	t.Logf("Allocated %d bytes in %v", allocated, elapsed)
+	assert.Less(t, allocated, uint64(4<<20), "allocated bytes")
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestOptimizeSchedule_Infeasible(t *testing.T) {
+	start := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+	entries := append(quarterEntries(start, 10, 20), quarterEntries(start.Add(time.Hour), 30, 40)...)
+	base := ScheduleConstraints{MaxPowerKW: 4, Earliest: start, Deadline: start.Add(2 * time.Hour)}
+
+	for name, c := range map[string]ScheduleConstraints{
+		"Not enough slots":     {EnergyKWh: 5, MaxPowerKW: 4, Earliest: start, Deadline: start.Add(2 * time.Hour)},
+		"Gap splits short run": {EnergyKWh: 1, MaxPowerKW: 4, Earliest: start, Deadline: start.Add(2 * time.Hour), MinRun: 45 * time.Minute},
+		"Gap splits run":       {EnergyKWh: 3, MaxPowerKW: 4, Earliest: start, Deadline: start.Add(2 * time.Hour), MinRun: 45 * time.Minute},
+		"Too few starts":       {EnergyKWh: 4, MaxPowerKW: 4, Earliest: start, Deadline: start.Add(2 * time.Hour), MinRun: 30 * time.Minute, MaxStarts: 1},
+		"No prices in time":    {EnergyKWh: 1, MaxPowerKW: 4, Earliest: start.Add(3 * time.Hour), Deadline: start.Add(4 * time.Hour)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := OptimizeSchedule(entries, c)
+			assert.ErrorIs(t, err, ErrScheduleInfeasible)
+		})
+	}
+
+	base.EnergyKWh = 1
+	base.MaxStarts = MaxScheduleStarts + 1
+	_, err := OptimizeSchedule(entries, base)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrScheduleInfeasible)
+}
+
+// bruteForceCost tries every set of slots and returns the lowest cost, or
+// +Inf when no set meets the constraints. Slots are continuous.
+func bruteForceCost(prices []float64, c ScheduleConstraints) float64 {
+	slotKWh := c.MaxPowerKW / 4
+	on := int(math.Ceil(c.EnergyKWh/slotKWh - 1e-9))
+	remainder := c.EnergyKWh - float64(on-1)*slotKWh
+	minRun := max(1, int(c.MinRun/ScheduleStep))
+
+	best := math.Inf(1)
+	if on < minRun {
+		// Spread over the cheapest minRun slots in a row
+		for i := 0; i+minRun <= len(prices); i++ {
+			var sum float64
+			for _, p := range prices[i : i+minRun] {
+				sum += p
+			}
+			best = min(best, sum/1000*c.EnergyKWh/float64(minRun))
+		}
+		return best
+	}
+	for mask := range uint(1) << len(prices) {
+		if bits.OnesCount(mask) != on {
+			continue
+		}
+		valid := true
+		starts, run := 0, 0
+		var total, dearest float64
+		dearest = math.Inf(-1)
+		for i, p := range prices {
+			if mask&(1<<i) != 0 {
+				if run == 0 {
+					starts++
+				}
+				run++
+				total += p / 1000 * slotKWh
+				dearest = max(dearest, p)
+				continue
+			}
+			if run > 0 && run < minRun {
+				valid = false
+			}
+			run = 0
+		}
+		if run > 0 && run < minRun || c.MaxStarts > 0 && starts > c.MaxStarts || !valid {
+			continue
+		}
+		best = min(best, total-dearest/1000*(slotKWh-remainder))
+	}
+	return best
+}
+
+func TestOptimizeSchedule_MatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	start := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	for range 300 {
+		prices := make([]float64, 4+rng.IntN(7))
+		for i := range prices {
+			prices[i] = float64(rng.IntN(200) - 20)
+		}
+		c := ScheduleConstraints{
+			EnergyKWh:  0.1 + rng.Float64()*float64(len(prices))/2,
+			MaxPowerKW: 2,
+			Earliest:   start,
+			Deadline:   start.Add(time.Duration(len(prices)) * ScheduleStep),
+			MinRun:     time.Duration(rng.IntN(5)) * ScheduleStep,
+			MaxStarts:  rng.IntN(4),
+		}
+
+		want := bruteForceCost(prices, c)
+		s, err := OptimizeSchedule(quarterEntries(start, prices...), c)
+		if math.IsInf(want, 1) {
+			assert.ErrorIs(t, err, ErrScheduleInfeasible, "prices %v, constraints %+v", prices, c)
+			continue
+		}
+		require.NoError(t, err, "prices %v, constraints %+v", prices, c)
+		assert.InDelta(t, want, s.Cost, 1e-9, "prices %v, constraints %+v", prices, c)
+		assert.InDelta(t, c.EnergyKWh, s.EnergyKWh, 1e-9)
+		if c.MaxStarts > 0 {
+			assert.LessOrEqual(t, s.Starts, c.MaxStarts)
+		}
+	}
+}
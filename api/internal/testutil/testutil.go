@@ -0,0 +1,132 @@
+// Package testutil has fakes shared by the tests of several packages.
+package testutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// FixedTime is a service.TimeProvider that returns Time until it's changed.
+type FixedTime struct {
+	Time time.Time
+}
+
+func (f FixedTime) Now() time.Time {
+	return f.Time
+}
+
+// MockPriceRepository is a mock implementation of repository.PriceRepository.
+// StreamPrices returns the entries and error it's given.
+type MockPriceRepository struct {
+	mock.Mock
+}
+
+func (m *MockPriceRepository) Select1(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockPriceRepository) GetPrices(ctx context.Context, from, to time.Time) ([]model.PriceHistoryEntry, error) {
+	args := m.Called(ctx, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.PriceHistoryEntry), args.Error(1)
+}
+
+func (m *MockPriceRepository) StreamPrices(ctx context.Context, from, to time.Time, fn func(model.PriceHistoryEntry) error) error {
+	args := m.Called(ctx, from, to)
+	if entries, ok := args.Get(0).([]model.PriceHistoryEntry); ok {
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockPriceRepository) GetCoverage(ctx context.Context, from, to time.Time) (time.Duration, error) {
+	args := m.Called(ctx, from, to)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockPriceRepository) InsertPrices(ctx context.Context, entries []model.PriceHistoryEntry) (int64, error) {
+	args := m.Called(ctx, entries)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockPriceRepository) GetLatestPrice(ctx context.Context) (*model.PriceHistoryEntry, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.PriceHistoryEntry), args.Error(1)
+}
+
+func (m *MockPriceRepository) GetLatestInsertTime(ctx context.Context) (*time.Time, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*time.Time), args.Error(1)
+}
+
+// FakePriceRepository is an in-memory repository.PriceRepository for tests that
+// serve whole routes, where mocking every call is impractical. Entries must be
+// sorted by DeliveryStart, and inserts are ignored.
+type FakePriceRepository struct {
+	Entries  []model.PriceHistoryEntry
+	Inserted *time.Time
+}
+
+func (r *FakePriceRepository) Select1(ctx context.Context) error {
+	return nil
+}
+
+func (r *FakePriceRepository) GetPrices(ctx context.Context, from, to time.Time) ([]model.PriceHistoryEntry, error) {
+	var prices []model.PriceHistoryEntry
+	for _, e := range r.Entries {
+		if !e.DeliveryStart.Before(from) && e.DeliveryStart.Before(to) {
+			prices = append(prices, e)
+		}
+	}
+	return prices, nil
+}
+
+func (r *FakePriceRepository) StreamPrices(ctx context.Context, from, to time.Time, fn func(model.PriceHistoryEntry) error) error {
+	prices, _ := r.GetPrices(ctx, from, to)
+	for _, e := range prices {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *FakePriceRepository) GetCoverage(ctx context.Context, from, to time.Time) (time.Duration, error) {
+	prices, _ := r.GetPrices(ctx, from, to)
+	var covered time.Duration
+	for _, e := range prices {
+		covered += e.DeliveryEnd.Sub(e.DeliveryStart)
+	}
+	return covered, nil
+}
+
+func (r *FakePriceRepository) InsertPrices(ctx context.Context, entries []model.PriceHistoryEntry) (int64, error) {
+	return 0, nil
+}
+
+func (r *FakePriceRepository) GetLatestPrice(ctx context.Context) (*model.PriceHistoryEntry, error) {
+	if len(r.Entries) == 0 {
+		return nil, nil
+	}
+	return &r.Entries[len(r.Entries)-1], nil
+}
+
+func (r *FakePriceRepository) GetLatestInsertTime(ctx context.Context) (*time.Time, error) {
+	return r.Inserted, nil
+}
@@ -0,0 +1,21 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "")
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	shutdown, err = Setup(context.Background(), ExporterStdout)
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), "zipkin")
+	assert.EqualError(t, err, `unknown tracing exporter "zipkin"`)
+}
@@ -0,0 +1,308 @@
+// Package webhook delivers price events to subscribed HTTP endpoints.
+//
+// Every delivery is a POST with a JSON Event body. The body is signed with the
+// subscription's secret and the signature sent as
+//
+//	X-Ehin-Signature: sha256=<hex HMAC-SHA256 of the body>
+//
+// Failed deliveries are retried with exponential backoff. Deliveries that still
+// fail are stored as dead letters.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/db/repository"
+	"github.com/samlof/ehin/internal/service"
+)
+
+const (
+	SignatureHeader = "X-Ehin-Signature"
+	EventHeader     = "X-Ehin-Event"
+	DeliveryHeader  = "X-Ehin-Delivery"
+
+	defaultMaxAttempts = 5
+	defaultBackoff     = 2 * time.Second
+	// Error messages from receivers are truncated to this length in dead letters.
+	maxErrorBody = 200
+)
+
+// Event is the body of a webhook delivery.
+type Event struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	Area      string    `json:"area"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      any       `json:"data"`
+}
+
+// PricesIngestedData is the data of a prices.ingested event. Prices are in EUR/MWh.
+type PricesIngestedData struct {
+	Prices []model.PriceHistoryEntry `json:"prices"`
+}
+
+// PeriodsData is the data of price.threshold and price.negative events.
+type PeriodsData struct {
+	Threshold *float64 `json:"threshold,omitempty"`
+	Periods   []Period `json:"periods"`
+}
+
+type Period struct {
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	AveragePrice float64   `json:"averagePrice"`
+}
+
+type Dispatcher struct {
+	webhookRepository repository.WebhookRepository
+	timeProvider      service.TimeProvider
+	httpClient        *http.Client
+	maxAttempts       int
+	backoff           time.Duration
+
+	// Cancelled by Run on shutdown, which cuts retries of background deliveries short
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewDispatcher(webhookRepository repository.WebhookRepository, timeProvider service.TimeProvider) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		webhookRepository: webhookRepository,
+		timeProvider:      timeProvider,
+		httpClient:        &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:       defaultMaxAttempts,
+		backoff:           defaultBackoff,
+		ctx:               ctx,
+		cancel:            cancel,
+	}
+}
+
+// Sign returns the signature header value of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// PricesIngested delivers the events triggered by newly stored prices in the background.
+// Nothing is delivered once Run has returned.
+func (d *Dispatcher) PricesIngested(_ context.Context, area string, entries []model.PriceHistoryEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		slog.Warn("Not delivering webhooks after shutdown", "area", area)
+		return
+	}
+	d.wg.Go(func() {
+		d.Dispatch(d.ctx, area, entries)
+	})
+}
+
+// Run waits until ctx is done, then cancels the retries of background deliveries
+// and waits for them. Deliveries that haven't succeeded by then are stored as
+// dead letters, so Run must return before the database is closed.
+func (d *Dispatcher) Run(ctx context.Context) {
+	<-ctx.Done()
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.cancel()
+	d.Wait()
+}
+
+// Wait blocks until all background deliveries have finished.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Dispatch delivers the events triggered by entries to all matching subscriptions
+// and waits for the deliveries to finish.
+func (d *Dispatcher) Dispatch(ctx context.Context, area string, entries []model.PriceHistoryEntry) {
+	var wg sync.WaitGroup
+	for _, eventType := range model.WebhookEvents {
+		subs, err := d.webhookRepository.ListSubscriptionsForEvent(ctx, eventType)
+		if err != nil {
+			slog.Error("Error listing webhook subscriptions", "event", eventType, "error", err)
+			continue
+		}
+		for _, sub := range subs {
+			data, ok := eventData(eventType, sub, entries)
+			if !ok {
+				continue
+			}
+			event := Event{
+				ID:        newDeliveryID(),
+				Event:     eventType,
+				Area:      area,
+				CreatedAt: d.timeProvider.Now().UTC(),
+				Data:      data,
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(ctx, sub, event)
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// eventData returns the data of eventType for sub, or false if the event doesn't fire.
+func eventData(eventType string, sub model.WebhookSubscription, entries []model.PriceHistoryEntry) (any, bool) {
+	switch eventType {
+	case model.WebhookEventPricesIngested:
+		return PricesIngestedData{Prices: entries}, true
+	case model.WebhookEventPriceThreshold:
+		if sub.Threshold == nil {
+			return nil, false
+		}
+		periods := service.PeriodsAbove(entries, *sub.Threshold)
+		if len(periods) == 0 {
+			return nil, false
+		}
+		return PeriodsData{Threshold: sub.Threshold, Periods: toPeriods(periods)}, true
+	case model.WebhookEventPriceNegative:
+		var negative []service.PricePeriod
+		for _, period := range service.PeriodsAbove(negate(entries), 0) {
+			period.AveragePrice = -period.AveragePrice
+			negative = append(negative, period)
+		}
+		if len(negative) == 0 {
+			return nil, false
+		}
+		return PeriodsData{Periods: toPeriods(negative)}, true
+	}
+	return nil, false
+}
+
+// negate flips the sign of prices so that negative periods can be found with PeriodsAbove.
+func negate(entries []model.PriceHistoryEntry) []model.PriceHistoryEntry {
+	negated := make([]model.PriceHistoryEntry, len(entries))
+	for i, e := range entries {
+		e.Price = -e.Price
+		negated[i] = e
+	}
+	return negated
+}
+
+func toPeriods(periods []service.PricePeriod) []Period {
+	out := make([]Period, len(periods))
+	for i, p := range periods {
+		out[i] = Period{Start: p.Start, End: p.End, AveragePrice: p.AveragePrice}
+	}
+	return out
+}
+
+// deliver sends event to sub, retrying with exponential backoff. If every attempt
+// fails the delivery is stored as a dead letter.
+func (d *Dispatcher) deliver(ctx context.Context, sub model.WebhookSubscription, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Error encoding webhook event", "event", event.Event, "error", err)
+		return
+	}
+
+	attempts := 0
+	for attempts < d.maxAttempts {
+		if attempts > 0 {
+			if err = sleep(ctx, d.backoff<<(attempts-1)); err != nil {
+				break
+			}
+		}
+		attempts++
+
+		var retry bool
+		retry, err = d.send(ctx, sub, event, body)
+		if err == nil {
+			slog.Info("Delivered webhook", "subscription", sub.ID, "event", event.Event, "attempts", attempts)
+			return
+		}
+		slog.Warn("Webhook delivery failed", "subscription", sub.ID, "event", event.Event, "attempt", attempts, "error", err)
+		if !retry {
+			break
+		}
+	}
+
+	deadLetter := model.WebhookDeadLetter{
+		SubscriptionID: sub.ID,
+		Event:          event.Event,
+		Payload:        body,
+		Attempts:       attempts,
+		LastError:      err.Error(),
+	}
+	// Store the dead letter even if ctx was cancelled during a retry
+	if err := d.webhookRepository.InsertDeadLetter(context.WithoutCancel(ctx), deadLetter); err != nil {
+		slog.Error("Error storing webhook dead letter", "subscription", sub.ID, "error", err)
+	}
+}
+
+// send makes a single delivery attempt. It reports whether a failed attempt is worth retrying.
+func (d *Dispatcher) send(ctx context.Context, sub model.WebhookSubscription, event Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ehin-webhooks/1")
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, body))
+	req.Header.Set(EventHeader, event.Event)
+	req.Header.Set(DeliveryHeader, event.ID)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	// Client errors other than rate limiting won't fix themselves
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+	return retry, err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewSecret returns a random secret for signing deliveries.
+func NewSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) CreateSubscription(ctx context.Context, sub *model.WebhookSubscription) error {
+	args := m.Called(ctx, sub)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ListSubscriptionsForEvent(ctx context.Context, event string) ([]model.WebhookSubscription, error) {
+	args := m.Called(ctx, event)
+	return args.Get(0).([]model.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookRepository) DeleteSubscription(ctx context.Context, id int64) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWebhookRepository) InsertDeadLetter(ctx context.Context, deadLetter model.WebhookDeadLetter) error {
+	args := m.Called(ctx, deadLetter)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ListDeadLetters(ctx context.Context, limit int) ([]model.WebhookDeadLetter, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).([]model.WebhookDeadLetter), args.Error(1)
+}
+
+type receivedDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+func newTestDispatcher(repo *MockWebhookRepository) *Dispatcher {
+	d := NewDispatcher(repo, testutil.FixedTime{Time: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)})
+	d.backoff = time.Millisecond
+	return d
+}
+
+func testEntries() []model.PriceHistoryEntry {
+	start := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	prices := []float64{10, -2, -4, 50, 200, 210, 20}
+	entries := make([]model.PriceHistoryEntry, len(prices))
+	for i, p := range prices {
+		s := start.Add(time.Duration(i) * time.Hour)
+		entries[i] = model.PriceHistoryEntry{Price: p, DeliveryStart: s, DeliveryEnd: s.Add(time.Hour)}
+	}
+	return entries
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"a":1}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=aa9e2e3575f5d7098b6caccd790888c36d5fdb63342a73bada2d6a51747a8494", Sign("secret", []byte(`{"a":1}`)))
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]receivedDelivery{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.Header.Get(EventHeader)+r.URL.Path] = receivedDelivery{r.Header.Clone(), body}
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	threshold := 100.0
+	highThreshold := 1000.0
+	repo := new(MockWebhookRepository)
+	repo.On("ListSubscriptionsForEvent", mock.Anything, model.WebhookEventPricesIngested).
+		Return([]model.WebhookSubscription{{ID: 1, URL: server.URL + "/ingested", Secret: "one"}}, nil)
+	repo.On("ListSubscriptionsForEvent", mock.Anything, model.WebhookEventPriceThreshold).
+		Return([]model.WebhookSubscription{
+			{ID: 2, URL: server.URL + "/threshold", Secret: "two", Threshold: &threshold},
+			{ID: 3, URL: server.URL + "/never", Secret: "three", Threshold: &highThreshold},
+		}, nil)
+	repo.On("ListSubscriptionsForEvent", mock.Anything, model.WebhookEventPriceNegative).
+		Return([]model.WebhookSubscription{{ID: 4, URL: server.URL + "/negative", Secret: "four"}}, nil)
+
+	newTestDispatcher(repo).Dispatch(context.Background(), "FI", testEntries())
+
+	assert.Len(t, received, 3)
+	assert.NotContains(t, received, model.WebhookEventPriceThreshold+"/never")
+
+	ingested := received[model.WebhookEventPricesIngested+"/ingested"]
+	assert.Equal(t, Sign("one", ingested.body), ingested.header.Get(SignatureHeader))
+	assert.NotEmpty(t, ingested.header.Get(DeliveryHeader))
+	var ingestedEvent struct {
+		Event
+		Data PricesIngestedData `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(ingested.body, &ingestedEvent))
+	assert.Equal(t, "FI", ingestedEvent.Area)
+	assert.Len(t, ingestedEvent.Data.Prices, 7)
+
+	thresholdDelivery := received[model.WebhookEventPriceThreshold+"/threshold"]
+	assert.Equal(t, Sign("two", thresholdDelivery.body), thresholdDelivery.header.Get(SignatureHeader))
+	var thresholdEvent struct {
+		Data PeriodsData `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(thresholdDelivery.body, &thresholdEvent))
+	assert.Equal(t, 100.0, *thresholdEvent.Data.Threshold)
+	assert.Len(t, thresholdEvent.Data.Periods, 1)
+	assert.Equal(t, 205.0, thresholdEvent.Data.Periods[0].AveragePrice)
+
+	var negativeEvent struct {
+		Data PeriodsData `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(received[model.WebhookEventPriceNegative+"/negative"].body, &negativeEvent))
+	assert.Len(t, negativeEvent.Data.Periods, 1)
+	assert.Equal(t, -3.0, negativeEvent.Data.Periods[0].AveragePrice)
+	assert.Equal(t, time.Date(2025, 1, 2, 1, 0, 0, 0, time.UTC), negativeEvent.Data.Periods[0].Start.UTC())
+
+	repo.AssertNotCalled(t, "InsertDeadLetter", mock.Anything, mock.Anything)
+}
+
+func TestDispatcher_RetriesThenSucceeds(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	repo := new(MockWebhookRepository)
+	d := newTestDispatcher(repo)
+	d.deliver(context.Background(), model.WebhookSubscription{ID: 1, URL: server.URL, Secret: "s"}, Event{Event: model.WebhookEventPricesIngested})
+
+	assert.Equal(t, int32(3), calls.Load())
+	repo.AssertNotCalled(t, "InsertDeadLetter", mock.Anything, mock.Anything)
+}
+
+func TestDispatcher_DeadLetterAfterRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	repo := new(MockWebhookRepository)
+	repo.On("InsertDeadLetter", mock.Anything, mock.MatchedBy(func(dl model.WebhookDeadLetter) bool {
+		return dl.SubscriptionID == 5 && dl.Attempts == defaultMaxAttempts && dl.Event == model.WebhookEventPriceNegative &&
+			dl.LastError == "unexpected status 500 Internal Server Error: boom"
+	})).Return(nil).Once()
+
+	d := newTestDispatcher(repo)
+	d.deliver(context.Background(), model.WebhookSubscription{ID: 5, URL: server.URL, Secret: "s"}, Event{Event: model.WebhookEventPriceNegative})
+
+	assert.Equal(t, int32(defaultMaxAttempts), calls.Load())
+	repo.AssertExpectations(t)
+}
+
+func TestDispatcher_ClientErrorIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	repo := new(MockWebhookRepository)
+	repo.On("InsertDeadLetter", mock.Anything, mock.MatchedBy(func(dl model.WebhookDeadLetter) bool {
+		return dl.Attempts == 1
+	})).Return(nil).Once()
+
+	d := newTestDispatcher(repo)
+	d.deliver(context.Background(), model.WebhookSubscription{ID: 1, URL: server.URL, Secret: "s"}, Event{Event: model.WebhookEventPricesIngested})
+
+	assert.Equal(t, int32(1), calls.Load())
+	repo.AssertExpectations(t)
+}
+
+func TestDispatcher_PricesIngested(t *testing.T) {
+	delivered := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer server.Close()
+
+	repo := new(MockWebhookRepository)
+	repo.On("ListSubscriptionsForEvent", mock.Anything, model.WebhookEventPricesIngested).
+		Return([]model.WebhookSubscription{{ID: 1, URL: server.URL, Secret: "s"}}, nil)
+	repo.On("ListSubscriptionsForEvent", mock.Anything, mock.Anything).Return([]model.WebhookSubscription{}, nil)
+
+	d := newTestDispatcher(repo)
+	d.PricesIngested(context.Background(), "FI", testEntries())
+	d.Wait()
+
+	assert.Len(t, delivered, 1)
+}
+
+func TestDispatcher_RunCancelsRetries(t *testing.T) {
+	attempted := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempted <- struct{}{}
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	repo := new(MockWebhookRepository)
+	repo.On("ListSubscriptionsForEvent", mock.Anything, model.WebhookEventPricesIngested).
+		Return([]model.WebhookSubscription{{ID: 1, URL: server.URL, Secret: "s"}}, nil)
+	repo.On("ListSubscriptionsForEvent", mock.Anything, mock.Anything).Return([]model.WebhookSubscription{}, nil)
+	repo.On("InsertDeadLetter", mock.Anything, mock.MatchedBy(func(dl model.WebhookDeadLetter) bool {
+		return dl.SubscriptionID == 1 && dl.Attempts == 1
+	})).Return(nil).Once()
+
+	d := newTestDispatcher(repo)
+	d.backoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+
+	d.PricesIngested(context.Background(), "FI", testEntries())
+	<-attempted
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after its context was cancelled")
+	}
+	repo.AssertExpectations(t)
+
+	// Prices ingested after shutdown are not delivered
+	d.PricesIngested(context.Background(), "FI", testEntries())
+	d.Wait()
+	assert.Empty(t, attempted)
+	repo.AssertNumberOfCalls(t, "InsertDeadLetter", 1)
+}
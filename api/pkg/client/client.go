@@ -0,0 +1,283 @@
+// Package client is a Go client for the ehin API.
+//
+//	c := client.New("https://api.ehin.fi", client.WithAPIKey(key))
+//	prices, err := c.Prices(ctx, time.Now())
+//
+// Requests that fail with a network error, 429 or a 502-504 status are retried
+// with exponential backoff, honouring Retry-After. Responses with an ETag are
+// cached in memory and revalidated with If-None-Match.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultRetryWait  = 500 * time.Millisecond
+	// Upper bound for a single wait, whatever Retry-After says
+	maxRetryWait      = 30 * time.Second
+	cacheEntries      = 128
+	apiKeyHeader      = "X-API-Key"
+	userAgent         = "ehin-go-client"
+	problemMediaType  = "application/problem+json"
+	maxErrorBodyBytes = 64 * 1024
+)
+
+// Client calls the ehin API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	maxRetries int
+	retryWait  time.Duration
+	cache      *etagCache
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. Defaults to
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithAPIKey sends key with every request for its higher rate limit.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithRetries sets how many times a failed request is retried and the wait
+// before the first retry, which doubles for each further one. Zero retries
+// disables retrying.
+func WithRetries(maxRetries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryWait = wait
+	}
+}
+
+// WithoutCache disables the ETag cache.
+func WithoutCache() Option {
+	return func(c *Client) { c.cache = nil }
+}
+
+// New returns a client for the API at baseURL, e.g. https://api.ehin.fi.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		retryWait:  defaultRetryWait,
+		cache:      newETagCache(cacheEntries),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is returned for responses with an error status. The API describes
+// errors as RFC 9457 problem details, whose fields are copied here when present.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Detail     string `json:"detail"`
+	Instance   string `json:"instance"`
+	RequestID  string `json:"requestId"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("ehin: %d %s", e.StatusCode, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// getJSON sends a GET request for path and decodes the JSON response into v.
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, v any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	body, err := c.get(ctx, u)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("ehin: decoding response of %s: %w", path, err)
+	}
+	return nil
+}
+
+// get returns the body of a successful GET request, retrying and using the
+// ETag cache as configured.
+func (c *Client) get(ctx context.Context, u string) ([]byte, error) {
+	var cached *cacheEntry
+	if c.cache != nil {
+		cached = c.cache.get(u)
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		if c.apiKey != "" {
+			req.Header.Set(apiKeyHeader, c.apiKey)
+		}
+		if cached != nil {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+
+		body, resp, err := c.do(req)
+		if err == nil {
+			switch {
+			case resp.StatusCode == http.StatusNotModified && cached != nil:
+				return cached.body, nil
+			case resp.StatusCode == http.StatusOK:
+				if etag := resp.Header.Get("ETag"); etag != "" && c.cache != nil {
+					c.cache.put(u, &cacheEntry{etag: etag, body: body})
+				}
+				return body, nil
+			default:
+				err = responseError(resp, body)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt >= c.maxRetries || !retryable(err) {
+			return nil, err
+		}
+
+		wait := c.retryWait << attempt
+		if resp != nil {
+			if s, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+				wait = time.Duration(s) * time.Second
+			}
+		}
+		if err := sleep(ctx, min(wait, maxRetryWait)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// do sends req and reads the whole response body.
+func (c *Client) do(req *http.Request) ([]byte, *http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var r io.Reader = resp.Body
+	if resp.StatusCode >= 400 {
+		r = io.LimitReader(r, maxErrorBodyBytes)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, resp, fmt.Errorf("ehin: reading response: %w", err)
+	}
+	return body, resp, nil
+}
+
+func responseError(resp *http.Response, body []byte) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == problemMediaType {
+		_ = json.Unmarshal(body, e)
+	}
+	if e.Title == "" {
+		e.Title = http.StatusText(resp.StatusCode)
+	}
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	return e
+}
+
+// retryable reports whether a request that failed with err may succeed when
+// tried again.
+func retryable(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		// Network errors
+		return true
+	}
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type cacheEntry struct {
+	etag string
+	body []byte
+}
+
+// etagCache is a small FIFO cache of responses by URL.
+type etagCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*cacheEntry
+	order      []string
+}
+
+func newETagCache(maxEntries int) *etagCache {
+	return &etagCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*cacheEntry, maxEntries),
+	}
+}
+
+func (c *etagCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *etagCache) put(key string, e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		if len(c.order) >= c.maxEntries {
+			delete(c.entries, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = e
+}
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samlof/ehin/internal/api/middleware"
+	"github.com/samlof/ehin/internal/api/resource"
+	"github.com/samlof/ehin/internal/api/router"
+	"github.com/samlof/ehin/internal/config"
+	"github.com/samlof/ehin/internal/db/model"
+	"github.com/samlof/ehin/internal/metrics"
+	"github.com/samlof/ehin/internal/testutil"
+)
+
+// testServer serves the routes of cmd/api through the real middleware chain and records
+// the status of every response.
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	// Responses to send before handing requests to the mux
+	failures []int
+}
+
+func (s *testServer) recorded() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.statuses...)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+var helsinki, _ = time.LoadLocation("Europe/Helsinki")
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, helsinki)
+	repo := &testutil.FakePriceRepository{}
+	for i := range 3 * 96 {
+		start := day.AddDate(0, 0, -1).Add(time.Duration(i) * 15 * time.Minute)
+		repo.Entries = append(repo.Entries, model.PriceHistoryEntry{
+			Price:         float64(i) / 4,
+			DeliveryStart: start,
+			DeliveryEnd:   start.Add(15 * time.Minute),
+		})
+	}
+	now := testutil.FixedTime{Time: day.Add(12 * time.Hour)}
+	cfg := &config.Config{CompressionMinSize: 1024}
+	handler := router.New(cfg, router.Handlers{
+		Greeting:      resource.NewGreetingResource(),
+		Health:        resource.NewHealthResource(repo, nil, now, 0, "test"),
+		Price:         resource.NewPriceResource(repo, nil, now),
+		Calendar:      resource.NewCalendarResource(repo, now),
+		HomeAssistant: resource.NewHomeAssistantResource(repo, now),
+		Consumption:   resource.NewConsumptionResource(nil),
+		Contract:      resource.NewContractResource(nil, now),
+		Schedule:      resource.NewScheduleResource(repo, now),
+		Webhook:       resource.NewWebhookResource(nil),
+		APIKey:        resource.NewAPIKeyResource(nil),
+		Metrics:       metrics.New(now),
+		Authenticator: middleware.NewAuthenticator(cfg, nil, now),
+		RateLimiter:   middleware.NewRateLimiter(cfg, nil, now),
+	})
+
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		s.mu.Lock()
+		var fail int
+		if len(s.failures) > 0 {
+			fail, s.failures = s.failures[0], s.failures[1:]
+		}
+		s.mu.Unlock()
+
+		if fail != 0 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(rec, http.StatusText(fail), fail)
+		} else {
+			handler.ServeHTTP(rec, r)
+		}
+
+		s.mu.Lock()
+		s.statuses = append(s.statuses, rec.status)
+		s.mu.Unlock()
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestClient_Prices(t *testing.T) {
+	s := newTestServer(t)
+	c := New(s.URL + "/")
+
+	prices, err := c.Prices(context.Background(), time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 3*96 {
+		t.Fatalf("Expected %d prices, got %d", 3*96, len(prices))
+	}
+	first := prices[0]
+	if first.Price != 0 || !first.DeliveryStart.Equal(time.Date(2025, 3, 9, 0, 0, 0, 0, helsinki)) || first.DeliveryEnd.Sub(first.DeliveryStart) != 15*time.Minute {
+		t.Errorf("Unexpected first price %+v", first)
+	}
+	if prices[5].Price != 1.25 {
+		t.Errorf("Expected 1.25, got %v", prices[5].Price)
+	}
+}
+
+func TestClient_PriceRange(t *testing.T) {
+	s := newTestServer(t)
+	c := New(s.URL)
+
+	day := time.Date(2025, 3, 11, 0, 0, 0, 0, helsinki)
+	prices, err := c.PriceRange(context.Background(), day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 96 || !prices[0].DeliveryStart.Equal(day) {
+		t.Errorf("Expected the 96 slots of %s, got %d", day.Format(time.DateOnly), len(prices))
+	}
+}
+
+func TestClient_DailyStats(t *testing.T) {
+	s := newTestServer(t)
+	c := New(s.URL)
+
+	from := time.Date(2025, 3, 10, 0, 0, 0, 0, helsinki)
+	stats, err := c.DailyStats(context.Background(), from, from.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 days, got %d", len(stats))
+	}
+	// Slots of the day run from 96/4 to 191/4
+	day := stats[0]
+	if !day.Date.Equal(from) || day.Min != 24 || day.Max != 47.75 || day.Average != 35.875 || day.Slots != 96 {
+		t.Errorf("Unexpected stats %+v", day)
+	}
+	if !stats[1].Date.Equal(from.AddDate(0, 0, 1)) || stats[1].Min != 48 {
+		t.Errorf("Unexpected stats %+v", stats[1])
+	}
+}
+
+func TestClient_Status(t *testing.T) {
+	s := newTestServer(t)
+	c := New(s.URL)
+
+	status, err := c.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != "test" || !status.TomorrowAvailable || status.TomorrowPrices != 96 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if status.LatestSlot == nil || !status.LatestSlot.End.Equal(time.Date(2025, 3, 12, 0, 0, 0, 0, helsinki)) {
+		t.Errorf("Unexpected latest slot %+v", status.LatestSlot)
+	}
+}
+
+func TestClient_ETagCache(t *testing.T) {
+	s := newTestServer(t)
+	c := New(s.URL)
+	date := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	first, err := c.Prices(context.Background(), date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Prices(context.Background(), date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.recorded(); len(got) != 2 || got[0] != http.StatusOK || got[1] != http.StatusNotModified {
+		t.Errorf("Expected 200 then 304, got %v", got)
+	}
+	if len(second) != len(first) || second[10] != first[10] {
+		t.Error("Expected the cached prices on 304")
+	}
+
+	// Ranges are streamed and revalidate too
+	from, to := date.AddDate(0, 0, -1), date.AddDate(0, 0, 1)
+	firstRange, err := c.PriceRange(context.Background(), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondRange, err := c.PriceRange(context.Background(), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.recorded(); len(got) != 4 || got[2] != http.StatusOK || got[3] != http.StatusNotModified {
+		t.Errorf("Expected 200 then 304 for the range, got %v", got)
+	}
+	if len(firstRange) != 3*96 || len(secondRange) != len(firstRange) {
+		t.Errorf("Expected the cached range on 304, got %d and %d prices", len(firstRange), len(secondRange))
+	}
+
+	uncached := New(s.URL, WithoutCache())
+	if _, err := uncached.Prices(context.Background(), date); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.recorded(); got[len(got)-1] != http.StatusOK {
+		t.Errorf("Expected 200 without the cache, got %v", got)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	s := newTestServer(t)
+	s.failures = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	c := New(s.URL, WithRetries(2, time.Millisecond))
+
+	if _, err := c.Status(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.recorded(); len(got) != 3 || got[2] != http.StatusOK {
+		t.Errorf("Expected two failures and a success, got %v", got)
+	}
+
+	s.failures = []int{http.StatusBadGateway, http.StatusBadGateway}
+	c = New(s.URL, WithRetries(1, time.Millisecond))
+	var apiErr *Error
+	if _, err := c.Status(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected 502 after the retries ran out, got %v", err)
+	}
+}
+
+func TestClient_ProblemDetails(t *testing.T) {
+	s := newTestServer(t)
+	c := New(s.URL, WithRetries(3, time.Millisecond))
+
+	_, err := c.PriceRange(context.Background(), time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC))
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected *Error, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Title != "Bad Request" || apiErr.Detail != "Invalid range. to must not be before from" {
+		t.Errorf("Unexpected error %+v", apiErr)
+	}
+	if apiErr.RequestID == "" || apiErr.Instance != "/api/prices" {
+		t.Errorf("Expected request ID and instance, got %+v", apiErr)
+	}
+	if got := s.recorded(); len(got) != 1 {
+		t.Errorf("Expected client errors not to be retried, got %v", got)
+	}
+}
+
+func TestClient_ContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	c := New(server.URL, WithRetries(1, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Status(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded while waiting to retry, got %v", err)
+	}
+}
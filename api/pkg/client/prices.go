@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/samlof/ehin/internal/db/model"
+)
+
+// PriceEntry is the price of one delivery slot in EUR/MWh without VAT.
+type PriceEntry = model.PriceHistoryEntry
+
+// Prices returns the prices from the day before date to the days after it in
+// Helsinki time, as shown by the ehin.fi site. Only the year, month and day
+// of date are used.
+func (c *Client) Prices(ctx context.Context, date time.Time) ([]PriceEntry, error) {
+	var prices []PriceEntry
+	err := c.getJSON(ctx, "/api/prices/"+date.Format(time.DateOnly), nil, &prices)
+	return prices, err
+}
+
+// PriceRange returns the prices of the days from and to, inclusive, in
+// Helsinki time. The range can be at most 366 days.
+func (c *Client) PriceRange(ctx context.Context, from, to time.Time) ([]PriceEntry, error) {
+	query := url.Values{
+		"from": {from.Format(time.DateOnly)},
+		"to":   {to.Format(time.DateOnly)},
+	}
+	var prices []PriceEntry
+	err := c.getJSON(ctx, "/api/prices", query, &prices)
+	return prices, err
+}
+
+// DayStats summarises the prices of one day in Helsinki time, in EUR/MWh
+// without VAT.
+type DayStats struct {
+	// Midnight in Helsinki time
+	Date time.Time
+	Min  float64
+	Max  float64
+	// Weighted by slot length
+	Average float64
+	Slots   int
+}
+
+// DailyStats returns the price statistics of the days from and to,
+// inclusive, in Helsinki time, computed from PriceRange. Days without prices
+// are left out.
+func (c *Client) DailyStats(ctx context.Context, from, to time.Time) ([]DayStats, error) {
+	loc, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		return nil, err
+	}
+	prices, err := c.PriceRange(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []DayStats
+	var weighted, hours float64
+	for _, p := range prices {
+		start := p.DeliveryStart.In(loc)
+		date := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+		if len(days) == 0 || !days[len(days)-1].Date.Equal(date) {
+			days = append(days, DayStats{Date: date, Min: p.Price, Max: p.Price})
+			weighted, hours = 0, 0
+		}
+		day := &days[len(days)-1]
+		day.Min = min(day.Min, p.Price)
+		day.Max = max(day.Max, p.Price)
+		day.Slots++
+		h := p.DeliveryEnd.Sub(p.DeliveryStart).Hours()
+		weighted += p.Price * h
+		hours += h
+		if hours > 0 {
+			day.Average = weighted / hours
+		}
+	}
+	return days, nil
+}
+
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Status summarises the data the API has stored.
+type Status struct {
+	Version       string `json:"version"`
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+	// Nil when no prices are stored
+	LatestSlot     *Slot `json:"latestSlot"`
+	TomorrowPrices int   `json:"tomorrowPrices"`
+	// True when tomorrow's prices cover the whole day
+	TomorrowAvailable bool `json:"tomorrowAvailable"`
+	// When the latest prices were stored, nil when no prices are stored
+	LastNordPoolFetch         *time.Time `json:"lastNordPoolFetch"`
+	SecondsSinceNordPoolFetch *int64     `json:"secondsSinceNordPoolFetch"`
+}
+
+// Status returns the health of the service and its stored data from
+// GET /status. See DailyStats for price statistics.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.getJSON(ctx, "/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
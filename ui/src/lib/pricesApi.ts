@@ -27,6 +27,9 @@ export async function getPrices(fetch?: fetchType): Promise<PriceEntry[]> {
 	}
 
 	const res = await fetch(url + '/' + getDateForApi());
+	if (!res.ok) {
+		throw new Error(await errorMessage(res));
+	}
 	const prices: ResponsePriceEntry[] = await res.json();
 
 	return prices.map((p) => ({
@@ -36,6 +39,24 @@ export async function getPrices(fetch?: fetchType): Promise<PriceEntry[]> {
 	}));
 }
 
+/** Problem details (RFC 9457) sent by the API on errors. */
+export interface ProblemDetails {
+	type: string;
+	title: string;
+	status: number;
+	detail?: string;
+	instance?: string;
+	requestId?: string;
+}
+
+async function errorMessage(res: Response): Promise<string> {
+	if (res.headers.get('Content-Type')?.startsWith('application/problem+json')) {
+		const problem: ProblemDetails = await res.json();
+		return `${problem.title}: ${problem.detail ?? ''} (request ${problem.requestId ?? 'unknown'})`;
+	}
+	return `${res.status} ${res.statusText}`;
+}
+
 function getDateForApi() {
 	const today = new Date();
 	const offset = today.getTimezoneOffset();